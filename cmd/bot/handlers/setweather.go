@@ -129,6 +129,7 @@ func SetWeather(s *dg.Session, i *dg.InteractionCreate) {
 				data.Data[0].Wind = &weather.Wind{Degrees: option.FloatValue()}
 			} else {
 				data.Data[0].Wind.Degrees = option.FloatValue()
+				data.Data[0].Wind.Variable = false
 			}
 
 		case "wind-kt":
@@ -3,51 +3,78 @@ package main
 //go:generate goversioninfo -o resource.syso ../../versioninfo/versioninfo.json
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap/zapcore"
 
 	"github.com/evogelsa/DCS-real-weather/v2/config"
 	"github.com/evogelsa/DCS-real-weather/v2/logger"
 	"github.com/evogelsa/DCS-real-weather/v2/miz"
+	"github.com/evogelsa/DCS-real-weather/v2/theatre"
+	"github.com/evogelsa/DCS-real-weather/v2/util"
 	"github.com/evogelsa/DCS-real-weather/v2/versioninfo"
 	"github.com/evogelsa/DCS-real-weather/v2/weather"
 )
 
 // flag vars
 var (
+	dryRun       bool
 	enableCustom bool
 	validate     bool
 	version      bool
+	watchMode    bool
 
+	seed int64
+
+	// diffWriter is where dry run changes are written
+	diffWriter io.Writer = os.Stdout
+
+	archiveTime   string
 	configName    string
 	customFile    string
+	diffFormat    string
+	diffOutput    string
 	icao          string
 	inputMission  string
+	metarText     string
 	outputMission string
 )
 
 func init() {
 	const usage = `Usage of %s:
 	Boolean Flags:
+		-dry-run        print changes to the mission without writing it
 		-enable-custom  forcibly enable the custom weather provider
 		-help           prints this help message
 		-validate       validates your config the exits
 		-version        prints the Real Weather version then exits
+		-watch          keep running and update missions when the weather changes
 
 	String Flags:
+		-archive-time   use archived weather closest to this UTC time
 		-config         override default config file name
 		-custom-file    override file path for custom weather provider
+		-diff-format    format of the dry run changes, human or json
+		-diff-output    write the dry run changes to this file
 		-icao           override icao
 		-input          override input mission
+		-metar          use the given raw METAR text for weather
 		-output         override output mission
+
+	Integer Flags:
+		-seed           seed random choices to reproduce a previous run
 `
 
 	flag.Usage = func() {
@@ -58,16 +85,24 @@ func init() {
 		)
 	}
 
+	flag.BoolVar(&dryRun, "dry-run", false, "print changes to the mission without writing it")
 	flag.BoolVar(&enableCustom, "enable-custom", false, "forcibly enables the custom weather provider")
 	flag.BoolVar(&validate, "validate", false, "validates your config then exits")
 	flag.BoolVar(&version, "version", false, "prints out the real weather version and exits")
+	flag.BoolVar(&watchMode, "watch", false, "keep running and update missions when the weather changes")
 
+	flag.StringVar(&archiveTime, "archive-time", "", "use archived weather closest to this UTC time")
 	flag.StringVar(&configName, "config", "config.toml", "override default config file name")
 	flag.StringVar(&customFile, "custom-file", "", "override file path for custom weather provider")
+	flag.StringVar(&diffFormat, "diff-format", string(miz.DiffHuman), "format of the dry run changes, human or json")
+	flag.StringVar(&diffOutput, "diff-output", "", "write the dry run changes to this file")
 	flag.StringVar(&icao, "icao", "", "override icao in config")
 	flag.StringVar(&inputMission, "input", "", "override input mission in config")
+	flag.StringVar(&metarText, "metar", "", "use the given raw METAR text for weather")
 	flag.StringVar(&outputMission, "output", "", "override output mission in config")
 
+	flag.Int64Var(&seed, "seed", 0, "seed random choices to reproduce a previous run")
+
 	flag.Parse()
 }
 
@@ -82,11 +117,15 @@ func init() {
 
 	// set config overrides
 	overrides := config.Overrideable{
+		APIArchiveTime:     archiveTime,
 		APICustomEnable:    enableCustom,
 		APICustomFile:      customFile,
+		APIMETARText:       metarText,
 		MissionInput:       inputMission,
 		MissionOutput:      outputMission,
 		OptionsWeatherICAO: icao,
+		RealWeatherSeed:    seed,
+		RealWeatherWatch:   watchMode,
 	}
 
 	config.Init(configName, overrides)
@@ -138,21 +177,34 @@ func init() {
 
 	config.Validate()
 
+	if format := miz.DiffFormat(diffFormat); format != miz.DiffHuman && format != miz.DiffJSON {
+		logger.Errorf("diff format \"%s\" unrecognized (expecting human or json)", diffFormat)
+		diffFormat = string(miz.DiffHuman)
+		logger.Warnln("diff format defaulted to human")
+	}
+
 	if validate {
 		os.Exit(0)
 	}
+
+	// seed random choices, logging the seed so the run can be reproduced
+	randomSeed := config.Get().RealWeather.Seed
+	if randomSeed == 0 {
+		randomSeed = time.Now().UnixNano()
+	}
+	util.Seed(randomSeed)
+	logger.Infof("using random seed %d", randomSeed)
 }
 
 func init() {
-	// Clean up old temporary files if clean-on-start is enabled
+	// Clean up temporary files left by earlier versions if clean-on-start is
+	// enabled
 	if config.Get().RealWeather.Other.CleanOnStart {
-		miz.Clean()
+		miz.RemoveUnpacked()
 	}
 }
 
 func main() {
-	var err error
-
 	defer func() {
 		if r := recover(); r != nil {
 			_, fn, line, ok := runtime.Caller(4)
@@ -166,35 +218,227 @@ func main() {
 		}
 	}()
 
-	data := getWx()
+	// cache provider responses if enabled
+	if config.Get().API.Cache.Enable {
+		// validated with config
+		ttl, _ := time.ParseDuration(config.Get().API.Cache.TTL)
+		maxAge, _ := time.ParseDuration(config.Get().API.Cache.FallbackMaxAge)
+		weather.InitCache(
+			config.Get().API.Cache.Path,
+			ttl,
+			config.Get().API.Cache.Fallback,
+			maxAge,
+		)
+	}
+
+	// write the dry run changes of every mission to one file
+	if dryRun && diffOutput != "" {
+		f, err := os.Create(diffOutput)
+		if err != nil {
+			logger.Fatalf("error creating diff output: %v", err)
+		}
+		defer f.Close()
+		diffWriter = f
+	}
+
+	// create the output directory of the mission glob
+	if dir := config.Get().RealWeather.Mission.OutputDirectory; dir != "" &&
+		config.Get().RealWeather.Mission.Glob != "" && !dryRun {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			logger.Fatalf("error creating output directory: %v", err)
+		}
+	}
+
+	missions := config.Missions()
+
+	if config.Get().RealWeather.Watch.Enable {
+		// stop watching on interrupt, after the current run if one is going
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		watch(ctx, missions)
+		return
+	}
+
+	// weather is fetched for the first mission and used for all of them
+	wx, err := getMissionWeather(missions)
+	if err != nil {
+		logger.Fatalf("unable to get weather, %d missions not updated: %v", len(missions), err)
+	}
+
+	if failed := updateMissions(missions, wx); len(failed) > 0 {
+		logger.Fatalf("failed to update %s", strings.Join(failed, ", "))
+	}
+}
+
+// missionWeather is the weather fetched for the first mission of a run
+type missionWeather struct {
+	data       weather.WeatherData
+	location   []float64
+	windsAloft *weather.WindsAloft
+	pressure   []weather.PressureSample
+	theatre    string
+	clock      miz.Clock // where the mission time and date are taken from
+
+	// err is set if no provider had weather and default weather is used
+	err error
+}
+
+// getMissionWeather gets the surface weather, winds aloft, and pressure field
+// for the first mission that can be read
+func getMissionWeather(missions []config.MissionFiles) (*missionWeather, error) {
+	wx, err := getSurfaceWeather(missions, chooseICAO())
+	if err != nil {
+		return nil, err
+	}
+
+	wx.getWeatherAloft()
+
+	return wx, nil
+}
+
+// getSurfaceWeather gets the surface weather for the first mission that can be
+// read at icao, without the winds aloft and pressure field. Missions which
+// cannot be read are skipped, but an error is returned if there is no weather
+func getSurfaceWeather(missions []config.MissionFiles, icao string) (*missionWeather, error) {
+	for _, mission := range missions {
+		wx, err := getSurfaceWeatherFor(mission, icao)
+		if errors.Is(err, errNoWeather) {
+			// the other missions would get the same weather
+			return nil, err
+		} else if err != nil {
+			logger.Errorf("unable to read mission %s: %v", mission.Input, err)
+			continue
+		}
+		return wx, nil
+	}
+
+	return nil, fmt.Errorf("no mission could be read")
+}
+
+// getSurfaceWeatherFor loads the mission to find its location and theatre,
+// then gets the surface weather there at icao. errNoWeather is returned if
+// there is no weather for the mission
+func getSurfaceWeatherFor(mission config.MissionFiles, icao string) (*missionWeather, error) {
+	// close mission when done
+	defer miz.Close()
+
+	if err := miz.Open(mission.Input); err != nil {
+		return nil, fmt.Errorf("error opening mission file: %v", err)
+	}
+
+	if err := miz.Load(); err != nil {
+		return nil, fmt.Errorf("error loading mission: %v", err)
+	}
+
+	wx := &missionWeather{location: missionLocation()}
+
+	wx.data, wx.clock, wx.err = getWx(icao, wx.location)
+	if errors.Is(wx.err, errNoWeather) {
+		return nil, wx.err
+	}
 
 	// confirm there is data before updating
-	if data.NumResults <= 0 {
-		logger.Fatalf("no weather data received")
+	if wx.data.NumResults <= 0 {
+		return nil, errNoWeather
 	}
 
+	if t, err := miz.Theatre(); err == nil {
+		wx.theatre = t.Name
+	}
+
+	return wx, nil
+}
+
+// getWeatherAloft gets the winds aloft and pressure field for the weather
+func (wx *missionWeather) getWeatherAloft() {
 	// get winds aloft
-	var windsAloft weather.WindsAloft
-	if config.Get().API.OpenMeteo.Enable {
-		windsAloft, err = weather.GetWindsAloft(data.Data[0].Station.Geometry.Coordinates)
-		if err != nil {
-			logger.Errorf("error getting winds aloft: %v", err)
-			config.Set("open-meteo", false)
-			logger.Warnln("continuing with legacy winds")
+	wx.windsAloft = getWindsAloft(wx.data, wx.location, wx.clock)
+
+	// get pressure field for pressure systems
+	wx.pressure = getPressureField(wx.data, wx.location, wx.clock)
+}
+
+// updateMissions updates every mission with the weather, logging the result of
+// each. Returns the input of each mission that failed
+func updateMissions(missions []config.MissionFiles, wx *missionWeather) []string {
+	if len(missions) > 1 {
+		logger.Infof("updating %d missions...", len(missions))
+	}
+
+	// random choices are made once so every mission gets the same weather
+	choices := miz.Choose(&wx.data)
+
+	var failed []string
+	for _, mission := range missions {
+		if err := updateMission(mission, wx, choices); err != nil {
+			logger.Errorf("mission %s failed: %v", mission.Input, err)
+			failed = append(failed, mission.Input)
+			continue
+		}
+
+		if dryRun {
+			logger.Infof("mission %s checked", mission.Input)
+		} else {
+			logger.Infof("mission %s updated, written to %s", mission.Input, mission.Output)
 		}
 	}
 
-	// unzip mission file
-	_, err = miz.Unzip()
+	if len(missions) > 1 {
+		logger.Infof(
+			"%d of %d missions succeeded",
+			len(missions)-len(failed),
+			len(missions),
+		)
+	}
+
+	return failed
+}
+
+// updateMission opens, updates, and repacks a mission with the weather and the
+// random choices for it
+func updateMission(mission config.MissionFiles, wx *missionWeather, choices miz.Choices) error {
+	// close mission when done
+	defer miz.Close()
+
+	// open mission file
+	if err := miz.Open(mission.Input); err != nil {
+		return fmt.Errorf("error opening mission file: %v", err)
+	}
+
+	// load mission into a new lua state
+	if err := miz.Load(); err != nil {
+		return fmt.Errorf("error loading mission: %v", err)
+	}
+
+	// record the mission before it is updated to show what changed
+	var before map[string]string
+	if dryRun {
+		logger.Infoln("dry run, the output mission will not be written")
+		var err error
+		if before, err = miz.Snapshot(); err != nil {
+			return fmt.Errorf("error reading mission: %v", err)
+		}
+	}
+
+	if t, err := miz.Theatre(); err == nil && t.Name != wx.theatre {
+		logger.Warnf(
+			"mission %s is on %s, using weather fetched for %s",
+			mission.Input,
+			t.Name,
+			wx.theatre,
+		)
+	}
+
+	// each mission is updated with its own copy of the weather
+	data, err := wx.data.Clone()
 	if err != nil {
-		logger.Fatalf("error unpacking mission file: %v\n", err)
+		return err
 	}
-	// remove unpacked contents when done
-	defer miz.Clean()
 
 	// update mission file with weather data
-	if err = miz.UpdateMission(&data, windsAloft); err != nil {
-		logger.Errorf("error updating mission: %v\n", err)
+	if err := miz.UpdateMission(&data, wx.windsAloft, wx.pressure, wx.clock, choices); err != nil {
+		return fmt.Errorf("error updating mission: %v", err)
 	}
 
 	// generate the METAR text
@@ -213,83 +457,138 @@ func main() {
 		}
 	}
 
+	if dryRun {
+		if err := printDiff(mission.Input, before); err != nil {
+			return fmt.Errorf("error printing changes: %v", err)
+		}
+		return nil
+	}
+
 	// repack mission file contents and form realweather.miz output
-	if err := miz.Zip(); err != nil {
-		logger.Fatalf("error repacking mission file: %v", err)
+	if err := miz.Zip(mission.Output); err != nil {
+		return fmt.Errorf("error repacking mission file: %v", err)
 	}
+
+	return nil
 }
 
-func getWx() weather.WeatherData {
-	// get METAR report
-	var err error
-	var data weather.WeatherData
+// printDiff prints the changes made to the mission since before was recorded
+// to the diff output file, or to the console if none is set
+func printDiff(mission string, before map[string]string) error {
+	after, err := miz.Snapshot()
+	if err != nil {
+		return err
+	}
 
-	var icao string
-	if config.Get().Options.Weather.ICAO != "" {
-		icao = config.Get().Options.Weather.ICAO
-	} else if len(config.Get().Options.Weather.ICAOList) > 0 {
-		icao = config.Get().Options.Weather.ICAOList[rand.Intn(len(config.Get().Options.Weather.ICAOList))]
-	} else {
-		// Should never reach this code if config validation is working properly
-		logger.Errorf("icao config validation failed, please report this as a bug :-)")
-		icao = "UGKO"
-		logger.Warnln("icao defaulted to UGKO")
+	changes := miz.Diff(before, after)
+
+	if err := miz.WriteDiff(diffWriter, mission, changes, miz.DiffFormat(diffFormat)); err != nil {
+		return err
 	}
 
-	// construct usable api priority list from config
-	apiList := make([]struct {
-		Provider weather.API
-		Enable   bool
-	}, len(config.Get().API.ProviderPriority))
-	for i, provider := range config.Get().API.ProviderPriority {
-		switch weather.API(provider) {
-		case weather.APICheckWX:
-			apiList[i].Provider = weather.APICheckWX
-			apiList[i].Enable = config.Get().API.CheckWX.Enable
+	if diffOutput != "" {
+		logger.Infof("wrote %d changes to %s", len(changes), diffOutput)
+	}
 
-		case weather.APIAviationWeather:
-			apiList[i].Provider = weather.APIAviationWeather
-			apiList[i].Enable = config.Get().API.AviationWeather.Enable
+	return nil
+}
 
-		case weather.APICustom:
-			apiList[i].Provider = weather.APICustom
-			apiList[i].Enable = config.Get().API.Custom.Enable
+// missionLocation returns the longitude and latitude of the mission from the
+// configured location source
+func missionLocation() []float64 {
+	location := config.Get().Options.Weather.Location
+	fallback := []float64{location.Longitude, location.Latitude}
 
-		default:
-			logger.Warnln("ignoring unrecognized provider \"%s\"", provider)
-		}
+	source := theatre.LocationSource(location.Source)
+	if source == theatre.LocationConfig {
+		return fallback
 	}
 
-	// use first enabled api that works (based on priority list)
-	for _, api := range apiList {
-		var meta any
-		switch api.Provider {
-		case weather.APIAviationWeather:
-			meta = ""
-		case weather.APICheckWX:
-			meta = config.Get().API.CheckWX.Key
-		case weather.APICustom:
-			meta = config.Get().API.Custom.File
-		}
+	latitude, longitude, err := miz.Location(source)
+	if err != nil {
+		logger.Errorf("unable to get mission location from %s: %v", source, err)
+		logger.Warnln("using configured location")
+		return fallback
+	}
 
-		if api.Enable {
-			data, err = weather.GetWeather(icao, api.Provider, meta)
+	logger.Infof("using mission location %.4f, %.4f from %s", latitude, longitude, source)
 
-			if err == nil {
-				break
-			} else {
-				logger.Errorf("error getting weather from %s: %v", api.Provider, err)
-			}
+	return []float64{longitude, latitude}
+}
+
+// errNoWeather is returned when there is no weather to update missions with
+var errNoWeather = errors.New("no weather data received")
+
+// chooseICAO returns the configured icao, or a random station from icao-list
+func chooseICAO() string {
+	if config.Get().Options.Weather.ICAO != "" {
+		return config.Get().Options.Weather.ICAO
+	} else if len(config.Get().Options.Weather.ICAOList) > 0 {
+		return config.Get().Options.Weather.ICAOList[util.Intn(len(config.Get().Options.Weather.ICAOList))]
+	}
+
+	// Should never reach this code if config validation is working properly
+	logger.Errorf("icao config validation failed, please report this as a bug :-)")
+	logger.Warnln("icao defaulted to UGKO")
+	return "UGKO"
+}
+
+// getWx gets weather for icao, or for the nearest station to location if icao
+// is "auto". If no provider has weather, default weather is returned with the
+// error, unless the archive is enabled. The clock the mission time and date are
+// taken from is also returned
+func getWx(icao string, location []float64) (weather.WeatherData, miz.Clock, error) {
+	// use first enabled provider that works (based on priority list)
+	priority := make([]weather.API, len(config.Get().API.ProviderPriority))
+	for i, provider := range config.Get().API.ProviderPriority {
+		priority[i] = weather.API(provider)
+	}
+
+	// watch mode polls for new reports, which cached weather would hide
+	refresh := config.Get().RealWeather.Watch.Enable
+
+	var data weather.WeatherData
+	var provider weather.API
+	var err error
+	if config.Get().Options.Weather.Blend.Enable && config.Get().Options.Weather.ICAO == "" {
+		data, provider, err = blendWx(location, priority, refresh)
+		if err == nil {
+			icao = data.Data[0].ICAO
 		}
+	} else if icao == weather.ICAOAuto {
+		data, provider, err = weather.GetNearestWeather(
+			weather.Request{Location: location, Refresh: refresh},
+			config.Get().Options.Weather.Location.MaxDistance,
+			config.Get().Options.Weather.Location.MaxStations,
+			priority,
+		)
+		if err == nil {
+			icao = data.Data[0].ICAO
+		}
+	} else {
+		data, provider, err = weather.GetWeather(
+			weather.Request{ICAO: icao, Location: location, Refresh: refresh},
+			priority,
+		)
+	}
 
+	if err != nil && weather.Enabled(weather.APIArchive) {
+		// default weather would not match the archive time
+		return weather.WeatherData{}, miz.Clock{}, fmt.Errorf("%w: no archived weather: %v", errNoWeather, err)
 	}
 
+	clock := miz.ConfiguredClock()
 	if err != nil {
 		logger.Errorf("could not get any weather data") // don't reprint error
 		data = weather.DefaultWeather
 		logger.Warnln("using default weather")
+	} else if provider == weather.APIArchive {
+		clock = archiveWx()
 	}
 
+	// use forecast conditions if the mission starts well after the METAR
+	forecastWx(&data, clock)
+
 	// override with custom weather if enabled
 	overrideWx(icao, &data)
 
@@ -297,35 +596,210 @@ func getWx() weather.WeatherData {
 		logger.Errorf("error validating weather: %v", err)
 	}
 
-	return data
+	return data, clock, err
 }
 
-// overrideWx handles overriding weather if enabled
-func overrideWx(icao string, data *weather.WeatherData) {
-	if !config.Get().API.Custom.Enable || !config.Get().API.Custom.Override {
-		return
-	}
+// blendWx gets weather from every station in icao-list and blends them into
+// one observation, skipping cached weather if refresh is set. The provider of
+// the nearest station is returned
+func blendWx(location []float64, priority []weather.API, refresh bool) (weather.WeatherData, weather.API, error) {
+	var stations []weather.WeatherData
+	providers := make(map[string]weather.API)
+
+	for _, icao := range config.Get().Options.Weather.ICAOList {
+		data, provider, err := weather.GetWeather(
+			weather.Request{ICAO: icao, Location: location, Refresh: refresh},
+			priority,
+		)
+		if err != nil || data.NumResults < 1 {
+			logger.Warnf("could not get weather for %s, excluding it from blend", icao)
+			continue
+		}
 
-	logger.Infoln("overriding weather with custom data from file...")
+		// fills in station coordinates from the station database if missing
+		if err := weather.ValidateWeather(&data); err != nil {
+			logger.Errorf("error validating weather for %s: %v", icao, err)
+		}
 
-	meta := config.Get().API.Custom.File
+		stations = append(stations, data)
+		providers[data.Data[0].ICAO] = provider
+	}
 
-	temp, err := weather.GetWeather(icao, weather.APICustom, meta)
+	blend := config.Get().Options.Weather.Blend
+	data, err := weather.Blend(stations, location, weather.BlendOptions{
+		Pressure:    weather.BlendMethod(blend.Pressure),
+		Temperature: weather.BlendMethod(blend.Temperature),
+		Wind:        weather.BlendMethod(blend.Wind),
+		Visibility:  weather.BlendMethod(blend.Visibility),
+		Clouds:      weather.BlendMethod(blend.Clouds),
+		Conditions:  weather.BlendMethod(blend.Conditions),
+	})
 	if err != nil {
-		logger.Errorf("unable to get custom weather: %v", err)
+		return weather.WeatherData{}, "", err
+	}
+
+	logger.Infof("blended weather from %d stations, nearest is %s", len(stations), data.Data[0].ICAO)
+
+	return data, providers[data.Data[0].ICAO], nil
+}
+
+// archiveWx returns the clock lining up the mission time and date with the
+// archived observation. The configured offsets would move the mission away
+// from it, so they are ignored
+func archiveWx() miz.Clock {
+	logger.Infoln("using archived weather, mission time and date will match the observation")
+
+	if offset, _ := time.ParseDuration(config.Get().Options.Time.Offset); offset != 0 {
+		logger.Warnf("time offset \"%s\" ignored with archived weather", config.Get().Options.Time.Offset)
+	}
+	if offset, _ := util.ParseDateDuration(config.Get().Options.Date.Offset); offset != 0 {
+		logger.Warnf("date offset \"%s\" ignored with archived weather", config.Get().Options.Date.Offset)
+	}
+
+	return miz.Clock{IgnoreOffsets: true}
+}
+
+// getWindsAloft gets winds aloft for the mission start time at the mission
+// location if it is read from the mission, otherwise at the station location.
+// If winds aloft are unavailable nil is returned and legacy winds are used
+// instead
+func getWindsAloft(data weather.WeatherData, location []float64, clock miz.Clock) *weather.WindsAloft {
+	if theatre.LocationSource(config.Get().Options.Weather.Location.Source) == theatre.LocationConfig {
+		location = nil
+		if data.Data[0].Station != nil && data.Data[0].Station.Geometry != nil {
+			location = data.Data[0].Station.Geometry.Coordinates
+		}
+	}
+
+	windsAloft, err := weather.GetWindsAloft(weather.Request{
+		ICAO:     data.Data[0].ICAO,
+		Location: location,
+		Time:     miz.StartTime(&data, clock),
+	})
+	if errors.Is(err, weather.ErrNoProvider) {
+		return nil
+	} else if err != nil {
+		logger.Errorf("error getting winds aloft: %v", err)
+		logger.Warnln("continuing with legacy winds")
+		return nil
+	}
+
+	return &windsAloft
+}
+
+// getPressureField gets the pressure around the mission at its start time from
+// the configured source if pressure systems are enabled
+func getPressureField(data weather.WeatherData, location []float64, clock miz.Clock) []weather.PressureSample {
+	pressure := config.Get().Options.Weather.Pressure
+	if !config.Get().Options.Weather.Enable || !pressure.Enable || !pressure.Cyclones.Enable {
+		return nil
+	}
+
+	var samples []weather.PressureSample
+	switch weather.PressureSource(pressure.Cyclones.Source) {
+	case weather.PressureSourceStations:
+		priority := make([]weather.API, len(config.Get().API.ProviderPriority))
+		for i, provider := range config.Get().API.ProviderPriority {
+			priority[i] = weather.API(provider)
+		}
+
+		var stations []weather.WeatherData
+		for _, icao := range config.Get().Options.Weather.ICAOList {
+			station, _, err := weather.GetWeather(weather.Request{ICAO: icao}, priority)
+			if err != nil || station.NumResults < 1 {
+				logger.Warnf("could not get weather for %s, excluding it from pressure field", icao)
+				continue
+			}
+
+			// fills in station coordinates from the station database if missing
+			if err := weather.ValidateWeather(&station); err != nil {
+				logger.Errorf("error validating weather for %s: %v", icao, err)
+			}
+
+			stations = append(stations, station)
+		}
+
+		samples = weather.StationPressure(stations)
+	default:
+		grid := weather.PressureGrid(
+			location[1],
+			location[0],
+			pressure.Cyclones.Radius,
+			pressure.Cyclones.Grid,
+		)
+
+		var err error
+		samples, err = weather.GetPressureField(grid, miz.StartTime(&data, clock))
+		if err != nil {
+			logger.Errorf("error getting pressure field: %v", err)
+			logger.Warnln("continuing without pressure systems")
+			return nil
+		}
+	}
+
+	logger.Infof("using pressure from %d locations for pressure systems", len(samples))
+
+	return samples
+}
+
+// forecastWx replaces the observed conditions with the forecast conditions if
+// enabled and the mission starts an hour or more after the observation
+func forecastWx(data *weather.WeatherData, clock miz.Clock) {
+	if !config.Get().Options.Weather.Forecast.Enable || data.Forecast == nil {
 		return
 	}
 
-	marshalled, err := json.Marshal(temp)
+	observed, err := time.Parse("2006-01-02T15:04:05", data.Data[0].Observed)
 	if err != nil {
-		logger.Errorf("unable to marshal custom weather: %v", err)
 		return
 	}
 
-	if err := json.Unmarshal(marshalled, data); err != nil {
-		logger.Errorf("unable to unmarshal overrides: %v", err)
+	start := miz.StartTime(data, clock)
+	if start.Sub(observed) < time.Hour {
+		return
+	}
+
+	logger.Infof(
+		"mission starts at %s, applying forecast...",
+		start.Format("2006-01-02T15:04:05Z"),
+	)
+
+	if err := weather.ApplyForecast(data, start); err != nil {
+		logger.Errorf("unable to apply forecast: %v", err)
+		logger.Warnln("using observed weather")
 		return
 	}
 
-	logger.Infoln("weather overrides applied")
+	logger.Infoln("forecast applied")
+}
+
+// overrideWx handles overriding weather if enabled
+func overrideWx(icao string, data *weather.WeatherData) {
+	for _, provider := range weather.Providers() {
+		overrider, ok := provider.(weather.Overrider)
+		if !ok || !weather.Enabled(provider.Name()) || !overrider.Override() {
+			continue
+		}
+
+		logger.Infof("overriding weather with data from %s...", provider.Name())
+
+		temp, err := weather.GetWeatherFrom(provider.Name(), weather.Request{ICAO: icao})
+		if err != nil {
+			logger.Errorf("unable to get override weather: %v", err)
+			continue
+		}
+
+		marshalled, err := json.Marshal(temp)
+		if err != nil {
+			logger.Errorf("unable to marshal override weather: %v", err)
+			continue
+		}
+
+		if err := json.Unmarshal(marshalled, data); err != nil {
+			logger.Errorf("unable to unmarshal overrides: %v", err)
+			continue
+		}
+
+		logger.Infoln("weather overrides applied")
+	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/config"
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+	"github.com/evogelsa/DCS-real-weather/v2/miz"
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+// watch checks the weather every interval, and the METAR every poll, and
+// updates the missions when the weather is different from the last update.
+// Returns when ctx is done, after any update in progress
+func watch(ctx context.Context, missions []config.MissionFiles) {
+	cfg := config.Get().RealWeather.Watch
+	interval, _ := time.ParseDuration(cfg.Interval) // validated with config
+	poll, _ := time.ParseDuration(cfg.Poll)         // validated with config
+	if poll <= 0 || poll > interval {
+		poll = interval
+	}
+
+	logger.Infof(
+		"watching weather for %d missions, checking every %s and polling the METAR every %s",
+		len(missions),
+		interval,
+		poll,
+	)
+
+	// a station chosen at random from icao-list is kept for the whole watch, so
+	// a different station is not taken for a weather change
+	icao := chooseICAO()
+	if config.Get().Options.Weather.ICAO == "" && !config.Get().Options.Weather.Blend.Enable {
+		logger.Infof("watching weather at %s from icao-list", icao)
+	}
+
+	w := watcher{missions: missions, icao: icao, interval: interval}
+	for {
+		w.check()
+
+		logger.Infof("next poll at %s", time.Now().Add(poll).Format(time.TimeOnly))
+
+		select {
+		case <-ctx.Done():
+			logger.Infoln("stopped watching weather")
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// watcher is the state of watch mode between polls
+type watcher struct {
+	missions []config.MissionFiles
+	icao     string
+	interval time.Duration
+
+	issued  string    // station and issue time of the last METAR
+	checked time.Time // time the weather was last checked
+	applied string    // fingerprint of the weather of the last update
+}
+
+// check gets the surface weather and, if the interval has passed since the last
+// check or a new METAR was issued, the weather aloft. The missions are updated
+// if the weather is different from the weather they were last updated with
+func (w *watcher) check() {
+	wx, err := getSurfaceWeather(w.missions, w.icao)
+	if err != nil {
+		logger.Errorf("unable to get weather: %v", err)
+		logger.Warnln("missions not updated, retrying next poll")
+		return
+	}
+
+	if wx.err != nil {
+		logger.Warnln("no weather available, missions not updated, retrying next poll")
+		return
+	}
+
+	metar := wx.data.Data[0].ICAO + " " + wx.data.Data[0].Observed
+	if metar == w.issued && time.Since(w.checked) < w.interval {
+		logger.Infof("no new METAR since %s", wx.data.Data[0].Observed)
+		return
+	}
+
+	if metar != w.issued {
+		logger.Infof("new METAR from %s issued %s", wx.data.Data[0].ICAO, wx.data.Data[0].Observed)
+	}
+
+	w.issued = metar
+	w.checked = time.Now()
+
+	wx.getWeatherAloft()
+
+	key, err := wx.fingerprint()
+	if err != nil {
+		logger.Errorf("unable to compare weather: %v", err)
+	} else if key == w.applied {
+		logger.Infoln("weather unchanged, missions not updated")
+		return
+	}
+
+	if failed := updateMissions(w.missions, wx); len(failed) > 0 {
+		// check again next poll so the failed missions are retried
+		logger.Errorf("failed to update %d missions, retrying next poll", len(failed))
+		w.checked = time.Time{}
+		return
+	}
+
+	w.applied = key
+}
+
+// fingerprint returns a summary of the weather that only changes if the
+// weather applied to a mission changes. Observation times and raw text are
+// left out, and the weather aloft is rounded so small changes between
+// forecast hours are ignored. The mission time and date are included when they
+// are taken from the observation
+func (wx *missionWeather) fingerprint() (string, error) {
+	data, err := wx.data.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	// forecasts are already applied to the observation if they are used
+	data.Forecast = nil
+	for i := range data.Data {
+		data.Data[i].ID = ""
+		data.Data[i].Observed = ""
+		data.Data[i].RawText = ""
+
+		// the direction of variable wind is chosen when it is applied
+		if data.Data[i].Wind != nil && data.Data[i].Wind.Variable {
+			data.Data[i].Wind.Degrees = 0
+		}
+	}
+
+	var aloft *weather.WindsAloft
+	if wx.windsAloft != nil {
+		rounded := *wx.windsAloft
+		rounded.WindSpeed2000 = math.Round(rounded.WindSpeed2000)
+		rounded.WindSpeed8000 = math.Round(rounded.WindSpeed8000)
+		rounded.WindDirection2000 = (rounded.WindDirection2000 + 5) / 10 * 10 % 360
+		rounded.WindDirection8000 = (rounded.WindDirection8000 + 5) / 10 * 10 % 360
+		aloft = &rounded
+	}
+
+	pressure := make([]float64, len(wx.pressure))
+	for i, sample := range wx.pressure {
+		pressure[i] = math.Round(sample.HPa)
+	}
+
+	// the system clock moves at every poll, so only the observation clock is
+	// compared
+	var clock []string
+	start := miz.StartTime(&wx.data, wx.clock)
+	if config.Get().Options.Time.Enable && !wx.clock.SystemTime {
+		clock = append(clock, start.Format(time.TimeOnly))
+	}
+	if config.Get().Options.Date.Enable && !wx.clock.SystemDate {
+		clock = append(clock, start.Format(time.DateOnly))
+	}
+
+	b, err := json.Marshal(struct {
+		Data       weather.WeatherData
+		WindsAloft *weather.WindsAloft
+		Pressure   []float64
+		Clock      []string
+	}{data, aloft, pressure, clock})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -4,9 +4,11 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/pelletier/go-toml/v2"
 
 	"github.com/evogelsa/DCS-real-weather/v2/logger"
+	"github.com/evogelsa/DCS-real-weather/v2/theatre"
 	"github.com/evogelsa/DCS-real-weather/v2/util"
 	"github.com/evogelsa/DCS-real-weather/v2/weather"
 )
@@ -21,10 +24,15 @@ import (
 // Configuration is the structure of config.json to be parsed
 type Configuration struct {
 	RealWeather struct {
+		Seed    int64 `toml:"seed"`
 		Mission struct {
-			Input  string `toml:"input"`
-			Output string `toml:"output"`
-			Brief  struct {
+			Input           string         `toml:"input"`
+			Output          string         `toml:"output"`
+			Batch           []MissionFiles `toml:"batch"`
+			Glob            string         `toml:"glob"`
+			OutputDirectory string         `toml:"output-directory"`
+			Backups         int            `toml:"backups"`
+			Brief           struct {
 				AddMETAR  bool   `toml:"add-metar"`
 				InsertKey string `toml:"insert-key"`
 				Remarks   string `toml:"remarks"`
@@ -39,27 +47,24 @@ type Configuration struct {
 			Compress   bool   `toml:"compress"`
 			Level      string `toml:"level"`
 		} `toml:"log"`
+		Watch struct {
+			Enable   bool   `toml:"enable"`
+			Interval string `toml:"interval"`
+			Poll     string `toml:"poll"`
+		} `toml:"watch"`
 		Other struct {
 			CleanOnStart bool `toml:"clean-on-start"`
 		} `toml:"other"`
 	} `toml:"realweather"`
 	API struct {
 		ProviderPriority []string `toml:"provider-priority"`
-		AviationWeather  struct {
-			Enable bool `toml:"enable"`
-		} `toml:"aviationweather"`
-		CheckWX struct {
-			Enable bool   `toml:"enable"`
-			Key    string `toml:"key"`
-		} `toml:"checkwx"`
-		Custom struct {
-			Enable   bool   `toml:"enable"`
-			File     string `toml:"file"`
-			Override bool   `toml:"override"`
-		} `toml:"custom"`
-		OpenMeteo struct {
-			Enable bool `toml:"enable"`
-		} `toml:"openmeteo"`
+		Cache            struct {
+			Enable         bool   `toml:"enable"`
+			Path           string `toml:"path"`
+			TTL            string `toml:"ttl"`
+			Fallback       bool   `toml:"fallback"`
+			FallbackMaxAge string `toml:"fallback-max-age"`
+		} `toml:"cache"`
 	} `toml:"api"`
 	Options struct {
 		Time struct {
@@ -77,7 +82,23 @@ type Configuration struct {
 			ICAO            string   `toml:"icao"`
 			ICAOList        []string `toml:"icao-list"`
 			RunwayElevation float64  `toml:"runway-elevation"`
-			Wind            struct {
+			Location        struct {
+				Source      string  `toml:"source"`
+				Latitude    float64 `toml:"latitude"`
+				Longitude   float64 `toml:"longitude"`
+				MaxDistance float64 `toml:"max-distance"`
+				MaxStations int     `toml:"max-stations"`
+			} `toml:"location"`
+			Blend struct {
+				Enable      bool   `toml:"enable"`
+				Pressure    string `toml:"pressure"`
+				Temperature string `toml:"temperature"`
+				Wind        string `toml:"wind"`
+				Visibility  string `toml:"visibility"`
+				Clouds      string `toml:"clouds"`
+				Conditions  string `toml:"conditions"`
+			} `toml:"blend"`
+			Wind struct {
 				Enable           bool    `toml:"enable"`
 				Minimum          float64 `toml:"minimum"`
 				Maximum          float64 `toml:"maximum"`
@@ -88,6 +109,18 @@ type Configuration struct {
 				ScaleFactor      float64 `toml:"scale-factor"`
 				Stability        float64 `toml:"stability"`
 				FixedReference   bool    `toml:"fixed-reference"`
+				Turbulence       struct {
+					GustFactor        float64            `toml:"gust-factor"`
+					GustMaximum       float64            `toml:"gust-maximum"`
+					WindMaximum       float64            `toml:"wind-maximum"`
+					Shower            float64            `toml:"shower"`
+					Storm             float64            `toml:"storm"`
+					ConvectiveMaximum float64            `toml:"convective-maximum"`
+					Roughness         float64            `toml:"roughness"`
+					StationRoughness  map[string]float64 `toml:"station-roughness"`
+					Minimum           float64            `toml:"minimum"`
+					Maximum           float64            `toml:"maximum"`
+				} `toml:"turbulence"`
 			} `toml:"wind"`
 			Clouds struct {
 				Enable bool `toml:"enable"`
@@ -98,6 +131,8 @@ type Configuration struct {
 				Presets struct {
 					Default    string   `toml:"default"`
 					Disallowed []string `toml:"disallowed"`
+					Candidates int      `toml:"candidates"`
+					Catalog    string   `toml:"catalog"`
 				} `toml:"presets"`
 				Custom struct {
 					Enable             bool    `toml:"enable"`
@@ -106,6 +141,11 @@ type Configuration struct {
 					DensityMaximum     float64 `toml:"density-maximum"`
 				} `toml:"custom"`
 			} `toml:"clouds"`
+			Visibility struct {
+				Enable  bool    `toml:"enable"`
+				Minimum float64 `toml:"minimum"`
+				Maximum float64 `toml:"maximum"`
+			} `toml:"visibility"`
 			Fog struct {
 				Enable            bool    `toml:"enable"`
 				Mode              string  `toml:"mode"`
@@ -123,25 +163,59 @@ type Configuration struct {
 				Enable bool `toml:"enable"`
 			} `toml:"temperature"`
 			Pressure struct {
-				Enable bool `toml:"enable"`
+				Enable   bool `toml:"enable"`
+				Cyclones struct {
+					Enable        bool    `toml:"enable"`
+					Dynamic       bool    `toml:"dynamic"`
+					Source        string  `toml:"source"`
+					Radius        float64 `toml:"radius"`
+					Grid          int     `toml:"grid"`
+					SpreadMinimum float64 `toml:"spread-minimum"`
+					SpreadMaximum float64 `toml:"spread-maximum"`
+					MaxDistance   float64 `toml:"max-distance"`
+				} `toml:"cyclones"`
 			} `toml:"pressure"`
+			Forecast struct {
+				Enable bool `toml:"enable"`
+			} `toml:"forecast"`
 		}
 	}
 }
 
+// MissionFiles are the paths of a mission to update and of the updated mission
+type MissionFiles struct {
+	Input  string `toml:"input"`
+	Output string `toml:"output"`
+}
+
 // Overrideable defines values of the config which can be overridden through
 // command line interface
 type Overrideable struct {
+	APIArchiveTime     string
 	APICustomEnable    bool
 	APICustomFile      string
+	APIMETARText       string
 	MissionInput       string
 	MissionOutput      string
 	OptionsWeatherICAO string
+	RealWeatherSeed    int64
+	RealWeatherWatch   bool
 }
 
 // config stores the parsed configuration. Use Get() to retrieve it
 var config Configuration
 
+// missions stores the missions to update, resolved from the config during
+// validation. Use Missions() to retrieve it
+var missions []MissionFiles
+
+// providerLayers stores the api tables of the default config, the user's
+// config, and the command line overrides in the order they are applied
+var providerLayers []map[string]any
+
+// providerOverrides is the last layer of providerLayers
+var providerOverrides = map[string]any{}
+
 //go:embed config.toml
 var defaultConfig string
 
@@ -152,6 +226,14 @@ func Init(configName string, overrides Overrideable) {
 		log.Fatalf("unable to read default config")
 	}
 
+	var raw struct {
+		API map[string]any `toml:"api"`
+	}
+	if err := toml.Unmarshal([]byte(defaultConfig), &raw); err != nil {
+		log.Fatalf("unable to read default config")
+	}
+	providerLayers = append(providerLayers, raw.API)
+
 	file, err := os.Open(configName)
 	if err != nil {
 		// if config.toml does not exist, create it and exit
@@ -171,19 +253,39 @@ func Init(configName string, overrides Overrideable) {
 	}
 
 	defer file.Close()
-	decoder := toml.NewDecoder(file)
-	err = decoder.Decode(&config)
+	b, err := io.ReadAll(file)
+	if err != nil {
+		log.Fatalf("error reading %s: %v", configName, err)
+	}
+
+	err = toml.Unmarshal(b, &config)
 	if err != nil {
 		log.Fatalf("error decoding %s: %v", configName, err)
 	}
 
+	raw.API = nil
+	if err := toml.Unmarshal(b, &raw); err != nil {
+		log.Fatalf("error decoding %s: %v", configName, err)
+	}
+	providerLayers = append(providerLayers, raw.API, providerOverrides)
+
 	// apply overrides
+	if overrides.APIArchiveTime != "" {
+		setProviderOverride(weather.APIArchive, "enable", true)
+		setProviderOverride(weather.APIArchive, "time", overrides.APIArchiveTime)
+	}
+
 	if overrides.APICustomEnable {
-		config.API.Custom.Enable = overrides.APICustomEnable
+		setProviderOverride(weather.APICustom, "enable", true)
 	}
 
 	if overrides.APICustomFile != "" {
-		config.API.Custom.File = overrides.APICustomFile
+		setProviderOverride(weather.APICustom, "file", overrides.APICustomFile)
+	}
+
+	if overrides.APIMETARText != "" {
+		setProviderOverride(weather.APIMETAR, "enable", true)
+		setProviderOverride(weather.APIMETAR, "text", overrides.APIMETARText)
 	}
 
 	if overrides.MissionInput != "" {
@@ -194,20 +296,81 @@ func Init(configName string, overrides Overrideable) {
 		config.RealWeather.Mission.Output = overrides.MissionOutput
 	}
 
+	// a mission given on the command line replaces the configured batch
+	if overrides.MissionInput != "" || overrides.MissionOutput != "" {
+		config.RealWeather.Mission.Batch = nil
+		config.RealWeather.Mission.Glob = ""
+	}
+
 	if overrides.OptionsWeatherICAO != "" {
 		config.Options.Weather.ICAO = overrides.OptionsWeatherICAO
 	}
+
+	if overrides.RealWeatherSeed != 0 {
+		config.RealWeather.Seed = overrides.RealWeatherSeed
+	}
+
+	if overrides.RealWeatherWatch {
+		config.RealWeather.Watch.Enable = true
+	}
 }
 
 func Get() Configuration {
 	return config
 }
 
+// Missions returns the missions to update, either the configured input and
+// output or every mission of the batch and glob
+func Missions() []MissionFiles {
+	return missions
+}
+
+// setProviderOverride overrides key in the api.<name> table of the config
+func setProviderOverride(name weather.API, key string, value any) {
+	table, ok := providerOverrides[string(name)].(map[string]any)
+	if !ok {
+		table = map[string]any{}
+		providerOverrides[string(name)] = table
+	}
+	table[key] = value
+}
+
+// decodeProvider decodes the api.<name> table of each config layer into v, so
+// values from the user's config and overrides replace the defaults
+func decodeProvider(name weather.API, v any) error {
+	for _, layer := range providerLayers {
+		table, ok := layer[string(name)].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		b, err := toml.Marshal(table)
+		if err != nil {
+			return fmt.Errorf("error encoding api.%s: %v", name, err)
+		}
+
+		if err := toml.Unmarshal(b, v); err != nil {
+			return fmt.Errorf("error decoding api.%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// configureProvider configures the named provider from the config, disabling
+// it if the config is invalid
+func configureProvider(name weather.API) {
+	err := weather.ConfigureProvider(name, func(v any) error {
+		return decodeProvider(name, v)
+	})
+	if err != nil {
+		logger.Errorf("error configuring provider \"%s\": %v", name, err)
+		logger.Warnf("%s disabled", name)
+	}
+}
+
 func Set(param string, value any) error {
 	switch param {
-	case "open-meteo":
-		v := value.(bool)
-		config.API.OpenMeteo.Enable = v
 	case "input":
 		v := value.(string)
 		config.RealWeather.Mission.Input = v
@@ -227,10 +390,14 @@ func Validate() {
 	checkAPI()
 	checkOptionsTime()
 	checkOptionsWeather()
+	checkOptionsLocation()
+	checkOptionsBlend()
 	checkOptionsWind()
 	checkOptionsClouds()
+	checkOptionsVisibility()
 	checkOptionsFog()
 	checkOptionsDust()
+	checkOptionsPressure()
 	logger.Infoln("configuration validated")
 }
 
@@ -238,14 +405,40 @@ func Validate() {
 func checkRealWeather() {
 	var fatal bool
 
-	if config.RealWeather.Mission.Input == "" {
-		logger.Errorln("no input mission configured")
+	var err error
+	missions, err = resolveMissions()
+	if err != nil {
+		logger.Errorf("unable to find missions: %v", err)
+		fatal = true
+	} else if len(missions) == 0 {
+		logger.Errorln("no missions configured")
 		fatal = true
 	}
 
-	if config.RealWeather.Mission.Output == "" {
-		logger.Errorln("no output mission configured")
-		fatal = true
+	outputs := make(map[string]string)
+	for _, mission := range missions {
+		if mission.Input == "" {
+			logger.Errorln("no input mission configured")
+			fatal = true
+		}
+
+		if mission.Output == "" {
+			logger.Errorf("no output mission configured for %s", mission.Input)
+			fatal = true
+			continue
+		}
+
+		output := filepath.Clean(mission.Output)
+		if input, ok := outputs[output]; ok {
+			logger.Errorf(
+				"missions %s and %s are both output to %s",
+				input,
+				mission.Input,
+				mission.Output,
+			)
+			fatal = true
+		}
+		outputs[output] = mission.Input
 	}
 
 	if _, err := regexp.Compile(config.RealWeather.Mission.Brief.InsertKey); err != nil {
@@ -253,6 +446,37 @@ func checkRealWeather() {
 		fatal = true
 	}
 
+	if config.RealWeather.Mission.Backups < 0 {
+		logger.Errorf("mission backups is <0")
+		config.RealWeather.Mission.Backups = 0
+		logger.Warnln("mission backups defaulted to 0 (disabled)")
+	}
+
+	if interval, err := time.ParseDuration(config.RealWeather.Watch.Interval); err != nil || interval < time.Minute {
+		logger.Errorf(
+			"could not parse watch interval \"%s\": must be a duration of at least 1m",
+			config.RealWeather.Watch.Interval,
+		)
+		config.RealWeather.Watch.Interval = "1h"
+		logger.Warnln("watch interval defaulted to \"1h\"")
+	}
+
+	if poll, err := time.ParseDuration(config.RealWeather.Watch.Poll); err != nil || poll < 0 {
+		logger.Errorf(
+			"could not parse watch poll \"%s\": must be a positive duration",
+			config.RealWeather.Watch.Poll,
+		)
+		config.RealWeather.Watch.Poll = "5m"
+		logger.Warnln("watch poll defaulted to \"5m\"")
+	}
+
+	if config.RealWeather.Other.CleanOnStart {
+		logger.Warnln(
+			"clean-on-start is deprecated, missions are no longer unpacked so " +
+				"there are no temporary files to clean",
+		)
+	}
+
 	if config.RealWeather.Log.MaxSize < 0 {
 		logger.Errorf("log max size is <0")
 		config.RealWeather.Log.MaxSize = 0
@@ -286,42 +510,138 @@ func checkRealWeather() {
 	}
 }
 
+// resolveMissions returns the missions to update. If a batch or glob is
+// configured, its missions replace the single input and output. Missions
+// matching the glob, or in the directory it names, are output to the output
+// directory with the same file name
+func resolveMissions() ([]MissionFiles, error) {
+	mission := config.RealWeather.Mission
+	if len(mission.Batch) == 0 && mission.Glob == "" {
+		return []MissionFiles{{Input: mission.Input, Output: mission.Output}}, nil
+	}
+
+	resolved := slices.Clone(mission.Batch)
+
+	if mission.Glob == "" {
+		return resolved, nil
+	}
+
+	if mission.OutputDirectory == "" {
+		return nil, fmt.Errorf("no output directory configured for mission glob")
+	}
+
+	pattern := mission.Glob
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*.miz")
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mission glob \"%s\": %v", mission.Glob, err)
+	}
+
+	if len(matches) == 0 {
+		logger.Warnf("no missions match \"%s\"", mission.Glob)
+	}
+
+	for _, match := range matches {
+		resolved = append(resolved, MissionFiles{
+			Input:  match,
+			Output: filepath.Join(mission.OutputDirectory, filepath.Base(match)),
+		})
+	}
+
+	return resolved, nil
+}
+
 // checkAPI validates all the API settings in the config
 func checkAPI() {
-	// if checkwx is enabled, validate that a key is present
-	if config.API.CheckWX.Enable && config.API.CheckWX.Key == "" {
-		logger.Errorln("checkwx enabled but missing api key")
-		config.API.CheckWX.Enable = false
-		logger.Warnln("checkwx disabled")
+	// configure each registered provider from its section of the config
+	for _, provider := range weather.Providers() {
+		configureProvider(provider.Name())
+	}
+
+	var knownProviders []weather.API
+	for _, provider := range weather.Providers() {
+		if provider.Capabilities()&weather.CapSurface != 0 {
+			knownProviders = append(knownProviders, provider.Name())
+		}
 	}
 
 	// validate at least one provider is enabled
-	if !config.API.AviationWeather.Enable &&
-		!config.API.CheckWX.Enable &&
-		!config.API.Custom.Enable {
+	if !slices.ContainsFunc(knownProviders, weather.Enabled) {
 		logger.Errorln("all providers are disabled")
-		config.API.AviationWeather.Enable = true
+		setProviderOverride(weather.APIAviationWeather, "enable", true)
+		configureProvider(weather.APIAviationWeather)
 		logger.Warnln("aviationweather enabled by default")
 	}
 
 	// verify providers are valid
-	knownProviders := []weather.API{
-		weather.APIAviationWeather,
-		weather.APICheckWX,
-		weather.APICustom,
-	}
 	for _, provider := range config.API.ProviderPriority {
 		if !slices.Contains(knownProviders, weather.API(provider)) {
 			logger.Warnf("provider \"%s\" not recognized: ignored", provider)
 		}
 	}
 
-	// ensure each provider is in priority list
-	for _, provider := range knownProviders {
-		if !slices.Contains(config.API.ProviderPriority, string(provider)) {
-			logger.Errorf("provider \"%s\" missing from priority list", provider)
-			config.API.ProviderPriority = append(config.API.ProviderPriority, string(provider))
-			logger.Warnf("provider \"%s\" added to end of priority list", provider)
+	// ensure each provider is in priority list. Providers of model weather
+	// would replace the default weather for any station, so they are only used
+	// when listed
+	for _, provider := range weather.Providers() {
+		name := provider.Name()
+		if !slices.Contains(knownProviders, name) ||
+			slices.Contains(config.API.ProviderPriority, string(name)) {
+			continue
+		}
+
+		if m, ok := provider.(weather.Modeler); ok && m.Modeled() {
+			if weather.Enabled(name) {
+				logger.Warnf("provider \"%s\" enabled but missing from priority list: not used", name)
+			}
+			continue
+		}
+
+		logger.Errorf("provider \"%s\" missing from priority list", name)
+		config.API.ProviderPriority = append(config.API.ProviderPriority, string(name))
+		logger.Warnf("provider \"%s\" added to end of priority list", name)
+	}
+
+	// a METAR given by the user is used before any live provider
+	if weather.Enabled(weather.APIMETAR) {
+		config.API.ProviderPriority = slices.DeleteFunc(config.API.ProviderPriority, func(provider string) bool {
+			return provider == string(weather.APIMETAR)
+		})
+		config.API.ProviderPriority = slices.Insert(config.API.ProviderPriority, 0, string(weather.APIMETAR))
+		logger.Infoln("metar enabled, it is used before the other providers")
+	}
+
+	// archived weather is the only weather that matches the archive time, so
+	// no other provider or last known good observation is used
+	if weather.Enabled(weather.APIArchive) {
+		config.API.ProviderPriority = []string{string(weather.APIArchive)}
+		config.API.Cache.Fallback = false
+		logger.Infoln("archive enabled, only archived weather is used")
+	}
+
+	if config.API.Cache.Enable {
+		if config.API.Cache.Path == "" {
+			logger.Errorln("cache enabled but missing path")
+			config.API.Cache.Enable = false
+			logger.Warnln("cache disabled")
+		}
+
+		if ttl, err := time.ParseDuration(config.API.Cache.TTL); err != nil || ttl < 0 {
+			logger.Errorf("could not parse cache ttl \"%s\": must be a positive duration", config.API.Cache.TTL)
+			config.API.Cache.TTL = "15m"
+			logger.Warnln("cache ttl defaulted to \"15m\"")
+		}
+
+		if age, err := time.ParseDuration(config.API.Cache.FallbackMaxAge); err != nil || age < 0 {
+			logger.Errorf(
+				"could not parse cache fallback max age \"%s\": must be a positive duration",
+				config.API.Cache.FallbackMaxAge,
+			)
+			config.API.Cache.FallbackMaxAge = "6h"
+			logger.Warnln("cache fallback max age defaulted to \"6h\"")
 		}
 	}
 }
@@ -370,7 +690,7 @@ func checkOptionsWeather() {
 		}
 	}
 
-	if config.Options.Weather.ICAO != "" {
+	if config.Options.Weather.ICAO != "" && config.Options.Weather.ICAO != weather.ICAOAuto {
 		if !re.MatchString(config.Options.Weather.ICAO) {
 			logger.Errorf("\"%s\" is not a valid airport code", config.Options.Weather.ICAO)
 			config.Options.Weather.ICAO = ""
@@ -388,6 +708,71 @@ func checkOptionsWeather() {
 	}
 }
 
+// checkOptionsLocation validates the location options in the config
+func checkOptionsLocation() {
+	if config.Options.Weather.Location.Source != string(theatre.LocationConfig) &&
+		config.Options.Weather.Location.Source != string(theatre.LocationBullseye) &&
+		config.Options.Weather.Location.Source != string(theatre.LocationUnits) &&
+		config.Options.Weather.Location.Source != string(theatre.LocationAirbase) {
+		logger.Errorf("location source \"%s\" unrecognized (expecting \"config\", \"bullseye\", \"units\", or \"airbase\")", config.Options.Weather.Location.Source)
+		config.Options.Weather.Location.Source = string(theatre.LocationConfig)
+		logger.Warnln("location source defaulted to config")
+	}
+
+	if !util.Between(config.Options.Weather.Location.Latitude, -90, 90) {
+		logger.Errorf("latitude %f must be between -90 and 90", config.Options.Weather.Location.Latitude)
+		config.Options.Weather.Location.Latitude = util.Clamp(config.Options.Weather.Location.Latitude, -90, 90)
+		logger.Warnf("latitude defaulted to %f", config.Options.Weather.Location.Latitude)
+	}
+
+	if !util.Between(config.Options.Weather.Location.Longitude, -180, 180) {
+		logger.Errorf("longitude %f must be between -180 and 180", config.Options.Weather.Location.Longitude)
+		config.Options.Weather.Location.Longitude = util.Clamp(config.Options.Weather.Location.Longitude, -180, 180)
+		logger.Warnf("longitude defaulted to %f", config.Options.Weather.Location.Longitude)
+	}
+
+	if config.Options.Weather.Location.MaxDistance <= 0 {
+		logger.Errorf("max distance %f must be >0", config.Options.Weather.Location.MaxDistance)
+		config.Options.Weather.Location.MaxDistance = 250
+		logger.Warnln("max distance defaulted to 250")
+	}
+
+	if config.Options.Weather.Location.MaxStations < 1 {
+		logger.Errorf("max stations %d must be >=1", config.Options.Weather.Location.MaxStations)
+		config.Options.Weather.Location.MaxStations = 5
+		logger.Warnln("max stations defaulted to 5")
+	}
+}
+
+// checkOptionsBlend validates the blending method of each weather element
+func checkOptionsBlend() {
+	blend := &config.Options.Weather.Blend
+	methods := weather.BlendMethods()
+
+	for _, element := range []struct {
+		name   string
+		method *string
+	}{
+		{"pressure", &blend.Pressure},
+		{"temperature", &blend.Temperature},
+		{"wind", &blend.Wind},
+		{"visibility", &blend.Visibility},
+		{"clouds", &blend.Clouds},
+		{"conditions", &blend.Conditions},
+	} {
+		allowed := methods[element.name]
+		if !slices.Contains(allowed, weather.BlendMethod(*element.method)) {
+			logger.Errorf("%s blend method \"%s\" unrecognized (expecting one of %v)", element.name, *element.method, allowed)
+			*element.method = string(allowed[0])
+			logger.Warnf("%s blend method defaulted to %s", element.name, allowed[0])
+		}
+	}
+
+	if blend.Enable && len(config.Options.Weather.ICAOList) < 2 {
+		logger.Warnln("blend is enabled but icao-list has fewer than 2 stations")
+	}
+}
+
 // checkOptionsWind validates wind options in the config
 func checkOptionsWind() {
 	if config.Options.Weather.Wind.Minimum < 0 {
@@ -466,6 +851,74 @@ func checkOptionsWind() {
 		config.Options.Weather.Wind.Stability = 0.143
 		logger.Warnln("stability defaulted to 0.143")
 	}
+
+	checkOptionsTurbulence()
+}
+
+// checkOptionsTurbulence validates turbulence options in the config
+func checkOptionsTurbulence() {
+	turbulence := &config.Options.Weather.Wind.Turbulence
+
+	if turbulence.GustFactor < 0 {
+		logger.Errorf("turbulence gust factor %f is below 0", turbulence.GustFactor)
+		turbulence.GustFactor = 1
+		logger.Warnln("turbulence gust factor defaulted to 1")
+	}
+
+	for _, component := range []struct {
+		name  string
+		value *float64
+	}{
+		{"turbulence gust maximum", &turbulence.GustMaximum},
+		{"turbulence wind maximum", &turbulence.WindMaximum},
+		{"turbulence shower", &turbulence.Shower},
+		{"turbulence storm", &turbulence.Storm},
+		{"turbulence convective maximum", &turbulence.ConvectiveMaximum},
+	} {
+		if *component.value < 0 {
+			logger.Errorf("%s %f is below 0", component.name, *component.value)
+			*component.value = 0
+			logger.Warnf("%s defaulted to 0", component.name)
+		} else if *component.value > 50 {
+			logger.Errorf("%s %f is above 50", component.name, *component.value)
+			*component.value = 50
+			logger.Warnf("%s defaulted to 50", component.name)
+		}
+	}
+
+	if turbulence.Minimum < 0 {
+		logger.Errorf("turbulence minimum %f is below 0", turbulence.Minimum)
+		turbulence.Minimum = 0
+		logger.Warnln("turbulence minimum defaulted to 0")
+	}
+
+	if turbulence.Maximum > 50 {
+		logger.Errorf("turbulence maximum %f is above 50", turbulence.Maximum)
+		turbulence.Maximum = 50
+		logger.Warnln("turbulence maximum defaulted to 50")
+	}
+
+	if turbulence.Minimum > turbulence.Maximum {
+		logger.Errorf("turbulence minimum %f is greater than turbulence maximum %f", turbulence.Minimum, turbulence.Maximum)
+		turbulence.Minimum = 0
+		turbulence.Maximum = 50
+		logger.Warnln("turbulence minimum defaulted to 0")
+		logger.Warnln("turbulence maximum defaulted to 50")
+	}
+
+	if turbulence.Roughness <= 0 {
+		logger.Errorf("terrain roughness %f must be >0", turbulence.Roughness)
+		turbulence.Roughness = 0.03
+		logger.Warnln("terrain roughness defaulted to 0.03")
+	}
+
+	for icao, roughness := range turbulence.StationRoughness {
+		if roughness <= 0 {
+			logger.Errorf("terrain roughness %f for %s must be >0", roughness, icao)
+			turbulence.StationRoughness[icao] = turbulence.Roughness
+			logger.Warnf("terrain roughness for %s defaulted to %f", icao, turbulence.Roughness)
+		}
+	}
 }
 
 // checkOptionsClouds validates cloud options in the config
@@ -482,6 +935,13 @@ func checkOptionsClouds() {
 		logger.Warnln("maximum cloud base defaulted to 15000")
 	}
 
+	if config.Options.Weather.Clouds.Presets.Catalog != "" {
+		if err := weather.LoadPresets(config.Options.Weather.Clouds.Presets.Catalog); err != nil {
+			logger.Errorf("error loading preset catalog: %v", err)
+			logger.Warnln("using built in presets")
+		}
+	}
+
 	var presetFound bool
 	var presetMinBase int
 	var presetMaxBase int
@@ -525,6 +985,12 @@ func checkOptionsClouds() {
 		logger.Warnln("configured max base is lower than default preset's min base and may be ignored")
 	}
 
+	if config.Options.Weather.Clouds.Presets.Candidates < 1 {
+		logger.Errorf("preset candidates %d must be >=1", config.Options.Weather.Clouds.Presets.Candidates)
+		config.Options.Weather.Clouds.Presets.Candidates = 1
+		logger.Warnln("preset candidates defaulted to 1")
+	}
+
 	for _, preset := range config.Options.Weather.Clouds.Presets.Disallowed {
 		presetFound = false
 		for valid := range weather.DecodePreset {
@@ -611,6 +1077,29 @@ func checkOptionsFog() {
 	}
 }
 
+// checkOptionsVisibility enforces visibility configuration options
+func checkOptionsVisibility() {
+	if config.Options.Weather.Visibility.Minimum < 0 {
+		logger.Errorf("visibility minimum %f is <0", config.Options.Weather.Visibility.Minimum)
+		config.Options.Weather.Visibility.Minimum = 0
+		logger.Warnln("visibility minimum defaulted to 0")
+	}
+
+	if config.Options.Weather.Visibility.Maximum > 80000 {
+		logger.Errorf("visibility maximum %f is >80000", config.Options.Weather.Visibility.Maximum)
+		config.Options.Weather.Visibility.Maximum = 80000
+		logger.Warnln("visibility maximum defaulted to 80000")
+	}
+
+	if config.Options.Weather.Visibility.Minimum > config.Options.Weather.Visibility.Maximum {
+		logger.Errorf("visibility minimum is greater than visibility maximum")
+		config.Options.Weather.Visibility.Minimum = 0
+		config.Options.Weather.Visibility.Maximum = 80000
+		logger.Warnln("visibility minimum defaulted to 0")
+		logger.Warnln("visibility maximum defaulted to 80000")
+	}
+}
+
 // checkOptionsDust enforces dust configuration options
 func checkOptionsDust() {
 	if config.Options.Weather.Dust.VisibilityMinimum < 300 {
@@ -633,3 +1122,65 @@ func checkOptionsDust() {
 		logger.Warnln("dust visibility maximum defaulted to 3000")
 	}
 }
+
+// checkOptionsPressure validates pressure options in the config
+func checkOptionsPressure() {
+	cyclones := &config.Options.Weather.Pressure.Cyclones
+
+	source := weather.PressureSource(cyclones.Source)
+	if source != weather.PressureSourceOpenMeteo && source != weather.PressureSourceStations {
+		logger.Errorf(
+			"pressure source \"%s\" unrecognized (expecting one of %v)",
+			cyclones.Source,
+			[]weather.PressureSource{weather.PressureSourceOpenMeteo, weather.PressureSourceStations},
+		)
+		cyclones.Source = string(weather.PressureSourceOpenMeteo)
+		logger.Warnf("pressure source defaulted to %s", weather.PressureSourceOpenMeteo)
+	}
+
+	if cyclones.Radius <= 0 {
+		logger.Errorf("pressure grid radius %f must be >0", cyclones.Radius)
+		cyclones.Radius = 500
+		logger.Warnln("pressure grid radius defaulted to 500")
+	}
+
+	if cyclones.Grid < 3 {
+		logger.Errorf("pressure grid %d is below 3", cyclones.Grid)
+		cyclones.Grid = 3
+		logger.Warnln("pressure grid defaulted to 3")
+	} else if cyclones.Grid > 10 {
+		logger.Errorf("pressure grid %d is above 10", cyclones.Grid)
+		cyclones.Grid = 10
+		logger.Warnln("pressure grid defaulted to 10")
+	}
+
+	if cyclones.SpreadMinimum <= 0 || cyclones.SpreadMinimum > cyclones.SpreadMaximum {
+		logger.Errorf(
+			"pressure spread minimum %f must be >0 and at most spread maximum %f",
+			cyclones.SpreadMinimum,
+			cyclones.SpreadMaximum,
+		)
+		cyclones.SpreadMinimum = 200
+		cyclones.SpreadMaximum = 3000
+		logger.Warnln("pressure spread minimum defaulted to 200")
+		logger.Warnln("pressure spread maximum defaulted to 3000")
+	}
+
+	if cyclones.MaxDistance <= 0 {
+		logger.Errorf("pressure system max distance %f must be >0", cyclones.MaxDistance)
+		cyclones.MaxDistance = 2000
+		logger.Warnln("pressure system max distance defaulted to 2000")
+	}
+
+	if !cyclones.Enable {
+		return
+	}
+
+	if !config.Options.Weather.Pressure.Enable {
+		logger.Warnln("pressure systems are enabled but pressure is disabled")
+	}
+
+	if source == weather.PressureSourceStations && len(config.Options.Weather.ICAOList) < 3 {
+		logger.Warnln("pressure source is stations but icao-list has fewer than 3 stations")
+	}
+}
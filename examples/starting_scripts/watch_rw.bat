@@ -0,0 +1,18 @@
+@echo off
+
+rem This script starts Real Weather in watch mode. Real Weather keeps running
+rem and updates the missions configured in config.toml whenever the weather
+rem changes, so the server picks up the new weather the next time it loads the
+rem mission. This replaces running Real Weather from Task Scheduler. Close the
+rem window or press Ctrl+C to stop watching.
+
+rem DEFINE PATHS BELOW
+
+rem Required: Real Weather directory
+set realweatherDir=C:\Users\admin\Desktop\realweather
+
+rem Title command window for easy shutting down via script
+title RW-WATCH
+
+cd /d "%realweatherDir%"
+realweather.exe -watch
@@ -8,7 +8,8 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var log *zap.SugaredLogger
+// log discards everything until Init is called
+var log *zap.SugaredLogger = zap.NewNop().Sugar()
 
 // Init initializes the logger after the config file has been read
 func Init(
@@ -2,7 +2,6 @@ package miz
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 
 	lua "github.com/yuin/gopher-lua"
@@ -11,7 +10,7 @@ import (
 	"github.com/evogelsa/DCS-real-weather/v2/logger"
 )
 
-// UpdateBrief updates the unpacked mission brief with the generated METAR
+// UpdateBrief updates the brief of the open mission with the generated METAR
 func UpdateBrief(metar string) error {
 	key := config.Get().RealWeather.Mission.Brief.InsertKey
 	metarRE := regexp.MustCompile(key + "\n(?P<metar>.*)\n")
@@ -19,7 +18,7 @@ func UpdateBrief(metar string) error {
 	logger.Infoln("loading mission brief into Lua VM...")
 
 	// load brief into lua vm
-	if err := l.DoFile("mission_unpacked/l10n/DEFAULT/dictionary"); err != nil {
+	if err := doEntry(l, "l10n/DEFAULT/dictionary"); err != nil {
 		return fmt.Errorf("error loading mission dictionary: %v", err)
 	}
 
@@ -56,22 +55,22 @@ func UpdateBrief(metar string) error {
 
 	// write new brief
 	if err := l.DoString(
-		`dictionary.DictKey_descriptionText_1 = ` + fmt.Sprintf("%q", newBrief),
+		`dictionary.DictKey_descriptionText_1 = ` + quoteString(newBrief),
 	); err != nil {
 		return fmt.Errorf("error updating mission brief: %v", err)
 	}
 
-	// update brief by removing old and dumping lua state as new file
-
-	if err := os.Remove("mission_unpacked/l10n/DEFAULT/dictionary"); err != nil {
-		return fmt.Errorf("error removing mission dictionary: %v", err)
-	}
-
+	// update brief by dumping lua state as new file
 	lv = l.GetGlobal("dictionary")
 	if tbl, ok := lv.(*lua.LTable); ok {
-		s := serializeTable(tbl, 0)
+		s, err := serializeTable(tbl, 0)
+		if err != nil {
+			return fmt.Errorf("error serializing mission dictionary: %v", err)
+		}
 		s = "dictionary = " + s
-		os.WriteFile("mission_unpacked/l10n/DEFAULT/dictionary", []byte(s), 0666)
+		if err := writeEntry("l10n/DEFAULT/dictionary", []byte(s)); err != nil {
+			return fmt.Errorf("error writing mission dictionary: %v", err)
+		}
 	} else {
 		return fmt.Errorf("error dumping serialized state")
 	}
@@ -0,0 +1,357 @@
+package miz
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/evogelsa/DCS-real-weather/v2/config"
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+	"github.com/evogelsa/DCS-real-weather/v2/util"
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+// Costs used when scoring presets. A cost of 1 is about the same as a layer
+// being 1 km off or one step of coverage off, e.g. SCT instead of BKN
+const (
+	costHeightPerMeter = 1.0 / 1000
+	costMissingLayer   = 1.0 // per step of coverage of a reported layer
+	costExtraLayer     = 0.5 // per step of coverage of an unreported layer
+	costMissingPrecip  = 3.0 // precip reported but preset has none
+	costExtraPrecip    = 5.0 // preset has precip but none reported
+	costMissingSnow    = 3.0 // snow reported but preset only has rain
+)
+
+// presetMatch is a preset scored against the reported clouds
+type presetMatch struct {
+	preset weather.CloudPreset
+	kind   string  // key in weather.CloudPresets, e.g. "BKN+RA"
+	base   int     // meters MSL
+	cost   float64 // lower is better
+}
+
+// layer is a cloud layer with its coverage from 1 (FEW) to 4 (OVC)
+type layer struct {
+	cover  int
+	meters float64 // AGL
+}
+
+// coverage converts a cloud code to an integer
+var coverage = map[string]int{
+	"FEW": 1,
+	"SCT": 2,
+	"BKN": 3,
+	"OVC": 4,
+}
+
+// checkClouds selects the preset that best matches every reported cloud layer
+// and returns it with its base in meters MSL. An empty preset is clear skies
+// and a preset starting with "CUSTOM" means custom clouds should be used
+func checkClouds(data *weather.WeatherData) (string, int) {
+	layers := reportedLayers(data.Data[0].Clouds)
+
+	// if no clouds then assume clear
+	if len(layers) == 0 {
+		return "", 0
+	}
+
+	elevation := config.Get().Options.Weather.RunwayElevation
+	minBase := config.Get().Options.Weather.Clouds.Base.Minimum
+	maxBase := config.Get().Options.Weather.Clouds.Base.Maximum
+	precip := checkPrecip(data)
+
+	// the layer that would have been used as the base of a single layer
+	// preset. Used for custom clouds and to decide if any preset is suitable
+	primary := primaryLayer(data.Data[0].Clouds, precip > precipNone)
+	code := data.Data[0].Clouds[primary].Code
+	base := util.Clamp(
+		int(elevation+0.5)+int(data.Data[0].Clouds[primary].Meters),
+		minBase,
+		maxBase,
+	)
+
+	matches := matchPresets(layers, elevation, minBase, maxBase, precip, presetAllowed)
+
+	if !presetSuitable(matches, code, base, precip > precipNone) {
+		logger.Warnf("no suitable weather preset for code=%s and base=%d", code, base)
+
+		if config.Get().Options.Weather.Clouds.Custom.Enable {
+			logger.Infoln("custom clouds are enabled, using custom weather")
+			return "CUSTOM " + code, base
+		}
+
+		logger.Infoln("fallback to no preset is disabled, using the closest preset")
+	}
+
+	if len(matches) == 0 {
+		return defaultPreset(code)
+	}
+
+	match := choosePreset(matches, config.Get().Options.Weather.Clouds.Presets.Candidates)
+
+	logger.Infow(
+		"matched cloud preset:",
+		"preset", match.preset.Name,
+		"score", math.Round(match.cost*100)/100,
+	)
+
+	return match.preset.Name, match.base
+}
+
+// reportedLayers returns the reported cloud layers, ignoring clear codes
+func reportedLayers(clouds []weather.Clouds) []layer {
+	var layers []layer
+	for _, cloud := range clouds {
+		if cover, ok := coverage[cloud.Code]; ok {
+			layers = append(layers, layer{cover, cloud.Meters})
+		}
+	}
+
+	slices.SortStableFunc(layers, func(a, b layer) int {
+		return cmp.Compare(a.meters, b.meters)
+	})
+
+	return layers
+}
+
+// primaryLayer returns the index of the main cloud layer. Prioritizes fullest
+// layer if there is precip, otherwise picks first ceiling if there is ceiling,
+// otherwise picks first layer
+func primaryLayer(clouds []weather.Clouds, precip bool) int {
+	ceiling := slices.ContainsFunc(clouds, func(cloud weather.Clouds) bool {
+		return cloud.Code == "BKN" || cloud.Code == "OVC"
+	})
+
+	// tracks index and coverage of fullest layer
+	primary, fullest := 0, 0
+
+	for i, cloud := range clouds {
+		if precip {
+			if coverage[cloud.Code] > fullest {
+				primary, fullest = i, coverage[cloud.Code]
+			}
+		} else if !ceiling || coverage[cloud.Code] >= coverage["BKN"] {
+			return i
+		}
+	}
+
+	return primary
+}
+
+// presetLayers returns the cloud layers of a preset in meters AGL when its
+// base is at the given height AGL. As in the generated METAR, only the first
+// layer moves with the base
+func presetLayers(name string, base float64) []layer {
+	var layers []layer
+	for i, cloud := range weather.DecodePreset[name] {
+		meters := base
+		if i > 0 {
+			hundreds, _ := strconv.Atoi(cloud.Base)
+			meters = float64(hundreds*100) * weather.FeetToMeters
+		}
+
+		layers = append(layers, layer{coverage[cloud.Name], meters})
+	}
+
+	slices.SortStableFunc(layers, func(a, b layer) int {
+		return cmp.Compare(a.meters, b.meters)
+	})
+
+	return layers
+}
+
+// matchPresets scores every allowed preset against the reported layers and
+// precipitation and returns them from best to worst. Each preset is tried with
+// its base at each reported layer, limited to the preset's and the configured
+// base range
+func matchPresets(
+	reported []layer,
+	elevation, minBase, maxBase float64,
+	precip precipitation,
+	allowed func(string) bool,
+) []presetMatch {
+	var matches []presetMatch
+
+	for _, kp := range cloudPresets() {
+		preset := kp.CloudPreset
+		if !allowed(preset.Name) ||
+			float64(preset.MinBase) > maxBase || float64(preset.MaxBase) < minBase {
+			continue
+		}
+
+		best := presetMatch{preset: preset, kind: kp.kind, cost: math.Inf(1)}
+		for _, anchor := range reported {
+			base := int(elevation+0.5) + int(anchor.meters)
+			base = util.Clamp(base, minBase, maxBase)
+			base = util.Clamp(base, preset.MinBase, preset.MaxBase)
+
+			cost := layersCost(reported, presetLayers(preset.Name, float64(base)-elevation))
+			if cost < best.cost {
+				best.base, best.cost = base, cost
+			}
+		}
+
+		rain := strings.Contains(kp.kind, "+RA")
+		if precip > precipNone && !rain {
+			best.cost += costMissingPrecip
+		} else if precip == precipNone && rain {
+			best.cost += costExtraPrecip
+		} else if precip.frozen() && !preset.Snow {
+			best.cost += costMissingSnow
+		}
+
+		matches = append(matches, best)
+	}
+
+	slices.SortStableFunc(matches, func(a, b presetMatch) int {
+		return cmp.Compare(a.cost, b.cost)
+	})
+
+	return matches
+}
+
+// layersCost compares two stacks of layers sorted by height. Layers are paired
+// in order so the cost of differences in coverage and height, and of layers
+// found in only one stack, is lowest
+func layersCost(reported, preset []layer) float64 {
+	// cost[i][j] is the lowest cost of the first i reported and j preset layers
+	cost := make([][]float64, len(reported)+1)
+	for i := range cost {
+		cost[i] = make([]float64, len(preset)+1)
+	}
+
+	for i := 1; i <= len(reported); i++ {
+		cost[i][0] = cost[i-1][0] + float64(reported[i-1].cover)*costMissingLayer
+	}
+	for j := 1; j <= len(preset); j++ {
+		cost[0][j] = cost[0][j-1] + float64(preset[j-1].cover)*costExtraLayer
+	}
+
+	for i := 1; i <= len(reported); i++ {
+		for j := 1; j <= len(preset); j++ {
+			r, p := reported[i-1], preset[j-1]
+
+			pair := cost[i-1][j-1] +
+				math.Abs(float64(r.cover-p.cover)) +
+				math.Abs(r.meters-p.meters)*costHeightPerMeter
+			missing := cost[i-1][j] + float64(r.cover)*costMissingLayer
+			extra := cost[i][j-1] + float64(p.cover)*costExtraLayer
+
+			cost[i][j] = min(pair, missing, extra)
+		}
+	}
+
+	return cost[len(reported)][len(preset)]
+}
+
+// presetSuitable reports whether any scored preset is of the same kind as the
+// primary layer with a base range containing it
+func presetSuitable(matches []presetMatch, code string, base int, precip bool) bool {
+	kind := code
+	if precip {
+		kind += "+RA"
+	}
+
+	return slices.ContainsFunc(matches, func(match presetMatch) bool {
+		return match.kind == kind &&
+			util.Between(base, match.preset.MinBase, match.preset.MaxBase)
+	})
+}
+
+// choosePreset picks randomly between the best n matches, favoring better
+// matches. If n is 1 or less the best match is always used
+func choosePreset(matches []presetMatch, n int) presetMatch {
+	n = util.Clamp(n, 1, len(matches))
+
+	weights := make([]float64, n)
+	var total float64
+	for i, match := range matches[:n] {
+		// a match 1 worse than the best is half as likely
+		weights[i] = 1 / (1 + match.cost - matches[0].cost)
+		total += weights[i]
+	}
+
+	r := util.Float64() * total
+	for i, weight := range weights {
+		if r < weight {
+			return matches[i]
+		}
+		r -= weight
+	}
+
+	return matches[0]
+}
+
+// defaultPreset returns the configured default preset, or clear skies if none
+// is configured
+func defaultPreset(kind string) (string, int) {
+	if config.Get().Options.Weather.Clouds.Presets.Default == "" {
+		logger.Warnf("no allowed presets for %s", kind)
+		logger.Warnln("defaulting to CLR")
+		return "", 0
+	}
+
+	preset := `"` + config.Get().Options.Weather.Clouds.Presets.Default + `"`
+
+	logger.Warnf("no allowed presets for %s", kind)
+	logger.Warnf("defaulting to %s", preset)
+
+	// get base in hundreds of feet
+	base, _ := strconv.Atoi(weather.DecodePreset[preset][0].Base)
+
+	// convert to feet
+	base *= 100
+
+	// convert to meters
+	base = int(float64(base)*weather.FeetToMeters + 0.5)
+
+	// clamp base between desired min and max base. DCS should clamp the value
+	// to the correct range for the preset, so the configured min and max base
+	// may be ignored if this happens. the user should have been warned of this
+	// possibility during the config validation
+	base = util.Clamp(
+		base,
+		config.Get().Options.Weather.Clouds.Base.Minimum,
+		config.Get().Options.Weather.Clouds.Base.Maximum,
+	)
+
+	return preset, base
+}
+
+// kindPreset is a preset with its key in weather.CloudPresets
+type kindPreset struct {
+	weather.CloudPreset
+	kind string
+}
+
+// cloudPresets returns every preset in weather.CloudPresets sorted by kind
+func cloudPresets() []kindPreset {
+	kinds := make([]string, 0, len(weather.CloudPresets))
+	for kind := range weather.CloudPresets {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+
+	var presets []kindPreset
+	for _, kind := range kinds {
+		for _, preset := range weather.CloudPresets[kind] {
+			presets = append(presets, kindPreset{preset, kind})
+		}
+	}
+
+	return presets
+}
+
+// presetAllowed checks if a preset is in the disallowed presets inside the
+// config file. If the preset is disallowed the func returns false
+func presetAllowed(preset string) bool {
+	for _, disallowed := range config.Get().Options.Weather.Clouds.Presets.Disallowed {
+		if preset == `"`+disallowed+`"` {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,158 @@
+package miz
+
+import (
+	"testing"
+
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+// TestMatchPresets checks presets are scored against every reported layer
+func TestMatchPresets(t *testing.T) {
+	allowed := func(string) bool { return true }
+	feet := func(ft float64) float64 { return ft * weather.FeetToMeters }
+
+	// BKN080
+	single := matchPresets(
+		reportedLayers([]weather.Clouds{{Code: "BKN", Meters: feet(8000)}}),
+		50, 0, 15000, precipNone, allowed,
+	)
+
+	// FEW030 BKN080 OVC200
+	layered := matchPresets(
+		reportedLayers([]weather.Clouds{
+			{Code: "FEW", Meters: feet(3000)},
+			{Code: "BKN", Meters: feet(8000)},
+			{Code: "OVC", Meters: feet(20000)},
+		}),
+		50, 0, 15000, precipNone, allowed,
+	)
+
+	if len(single) == 0 || len(layered) == 0 {
+		t.Fatalf("no presets matched")
+	}
+
+	if single[0].preset.Name == layered[0].preset.Name {
+		t.Errorf("got %s for both reports, expected upper layers to change the match", single[0].preset.Name)
+	}
+
+	// the best match for the layered report should have an overcast layer
+	var overcast bool
+	for _, cloud := range weather.DecodePreset[layered[0].preset.Name] {
+		overcast = overcast || cloud.Name == "OVC"
+	}
+	if !overcast {
+		t.Errorf("got %s, expected a preset with an overcast layer", layered[0].preset.Name)
+	}
+
+	for i := 1; i < len(layered); i++ {
+		if layered[i].cost < layered[i-1].cost {
+			t.Fatalf("presets not sorted by score")
+		}
+	}
+
+	// rain presets are only used with precipitation
+	rain := matchPresets(
+		reportedLayers([]weather.Clouds{{Code: "OVC", Meters: feet(3000)}}),
+		50, 0, 15000, precipRain, allowed,
+	)
+	if rain[0].kind != "OVC+RA" {
+		t.Errorf("got %s (%s), expected a rain preset", rain[0].preset.Name, rain[0].kind)
+	}
+
+	// disallowed presets and presets outside the base limits are skipped
+	for _, match := range matchPresets(
+		reportedLayers([]weather.Clouds{{Code: "OVC", Meters: feet(3000)}}),
+		50, 1000, 15000, precipNone, func(name string) bool { return name != `"Preset22"` },
+	) {
+		if match.preset.Name == `"Preset22"` || match.base < 1000 {
+			t.Errorf("got %s with base %d", match.preset.Name, match.base)
+		}
+	}
+
+	if choosePreset(layered, 1).preset.Name != layered[0].preset.Name {
+		t.Errorf("expected best match with one candidate")
+	}
+}
+
+// TestLayersCost checks layers are paired by height and coverage
+func TestLayersCost(t *testing.T) {
+	reported := []layer{{2, 1000}, {4, 3000}}
+
+	if cost := layersCost(reported, reported); cost != 0 {
+		t.Errorf("got cost %f for identical layers, expected 0", cost)
+	}
+
+	// missing the lower layer costs its coverage
+	if cost := layersCost(reported, []layer{{4, 3000}}); cost != 2*costMissingLayer {
+		t.Errorf("got cost %f for missing layer", cost)
+	}
+
+	// an extra layer costs less than a missing one
+	extra := layersCost(reported, []layer{{2, 1000}, {4, 3000}, {2, 8000}})
+	if extra != 2*costExtraLayer {
+		t.Errorf("got cost %f for extra layer", extra)
+	}
+
+	// 500 m too high and one step less coverage
+	if cost := layersCost(reported, []layer{{2, 1000}, {3, 3500}}); cost != 1.5 {
+		t.Errorf("got cost %f for different layer, expected 1.5", cost)
+	}
+}
+
+// TestCheckPrecip checks precipitation is snow below freezing
+func TestCheckPrecip(t *testing.T) {
+	tests := []struct {
+		conditions []weather.Conditions
+		celsius    float64
+		expected   precipitation
+	}{
+		{nil, 10, precipNone},
+		{[]weather.Conditions{{Code: "BR"}}, 10, precipNone},
+		{[]weather.Conditions{{Prefix: "-", Code: "SHRA"}}, 10, precipRain},
+		{[]weather.Conditions{{Code: "TSRA"}}, 20, precipStorm},
+		{[]weather.Conditions{{Code: "TS"}}, 20, precipStorm},
+		{[]weather.Conditions{{Code: "SN"}}, -10, precipSnow},
+		{[]weather.Conditions{{Code: "RASN"}}, -1, precipSnow},
+		{[]weather.Conditions{{Prefix: "+", Code: "SN"}}, -10, precipSnowStorm},
+		{[]weather.Conditions{{Code: "TSSN"}}, -2, precipSnowStorm},
+		{[]weather.Conditions{{Code: "SN"}}, 1, precipRain},
+		{[]weather.Conditions{{Code: "BLSN"}}, -10, precipNone},
+		{[]weather.Conditions{{Prefix: "+", Code: "BLSN"}}, -10, precipNone},
+		{[]weather.Conditions{{Code: "DRSN"}, {Prefix: "-", Code: "SN"}}, -10, precipSnow},
+		{[]weather.Conditions{{Prefix: "-", Code: "FZRA"}}, 1, precipRain},
+		{[]weather.Conditions{{Prefix: "+", Code: "SHSN"}}, -5, precipSnowStorm},
+		// every kind of precipitation is snow well below freezing
+		{[]weather.Conditions{{Code: "SG"}}, -10, precipSnow},
+		{[]weather.Conditions{{Code: "PL"}}, -10, precipSnow},
+		{[]weather.Conditions{{Code: "GR"}}, -10, precipSnow},
+		{[]weather.Conditions{{Code: "RA"}}, -10, precipSnow},
+		{[]weather.Conditions{{Code: "TSSN"}}, -10, precipSnowStorm},
+		{[]weather.Conditions{{Prefix: "+", Code: "RA"}}, -10, precipSnow},
+	}
+
+	for _, test := range tests {
+		data := &weather.WeatherData{
+			Data: []weather.Data{{
+				Conditions:  test.conditions,
+				Temperature: &weather.Temperature{Celsius: test.celsius},
+			}},
+			NumResults: 1,
+		}
+
+		if precip := checkPrecip(data); precip != test.expected {
+			t.Errorf(
+				"%v at %.0f C: got %s, expected %s",
+				test.conditions, test.celsius, precip, test.expected,
+			)
+		}
+	}
+
+	// rain presets that do not turn to snow score worse with snow
+	snow := matchPresets(
+		reportedLayers([]weather.Clouds{{Code: "OVC", Meters: 900}}),
+		0, 0, 15000, precipSnow, func(string) bool { return true },
+	)
+	if !snow[0].preset.Snow {
+		t.Errorf("got %s, expected a preset with snow", snow[0].preset.Name)
+	}
+}
@@ -0,0 +1,318 @@
+package miz
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/evogelsa/DCS-real-weather/v2/config"
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+	"github.com/evogelsa/DCS-real-weather/v2/util"
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+const (
+	// standardPressure in Pa is the pressure pressure systems are relative to
+	standardPressure = 101325
+
+	// minimumGradient in Pa/km is the weakest pressure gradient that gets a
+	// pressure system, about 1 hPa across 2000 km
+	minimumGradient = 0.05
+
+	// minimumExcess in Pa is the weakest low or high that gets a system
+	// centered on it
+	minimumExcess = 100
+
+	// atmosphereDynamic is the atmosphere_type of dynamic weather
+	atmosphereDynamic = 1
+)
+
+// cyclone is a pressure system in mission coordinates. The pressure of a
+// system is assumed to fall off from its center as exp(-(r/spread)^2)
+type cyclone struct {
+	centerX     float64 // meters, northing
+	centerZ     float64 // meters, easting
+	spread      float64 // meters, mean radius
+	excess      float64 // Pa, relative to standard pressure
+	ellipticity float64 // ratio of the long to short radius
+	rotation    float64 // radians from x to the long axis
+}
+
+// pressurePoint is a pressure sample in mission coordinates
+type pressurePoint struct {
+	x, z float64 // meters
+	pa   float64
+}
+
+// cycloneLimits limit the fitted pressure system, in meters
+type cycloneLimits struct {
+	spreadMinimum float64
+	spreadMaximum float64
+	maxDistance   float64
+}
+
+// updateCyclones fits pressure systems to the pressure field around the
+// mission and applies them to the mission state. If dynamic weather is enabled
+// the mission is switched to it so the systems are used
+func updateCyclones(samples []weather.PressureSample, l *lua.LState) error {
+	cfg := config.Get().Options.Weather.Pressure.Cyclones
+
+	t, err := Theatre()
+	if err != nil {
+		logger.Errorf("unable to place pressure systems: %v", err)
+		return nil
+	}
+
+	points := make([]pressurePoint, 0, len(samples))
+	for _, sample := range samples {
+		x, z := t.FromLatLon(sample.Latitude, sample.Longitude)
+		points = append(points, pressurePoint{x, z, sample.HPa * 100})
+	}
+
+	cyclones, err := fitCyclones(points, cycloneLimits{
+		spreadMinimum: cfg.SpreadMinimum * 1000,
+		spreadMaximum: cfg.SpreadMaximum * 1000,
+		maxDistance:   cfg.MaxDistance * 1000,
+	})
+	if err != nil {
+		logger.Errorf("unable to fit pressure systems: %v", err)
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("mission.weather.cyclones = {}\n")
+	for i, c := range cyclones {
+		fmt.Fprintf(&b,
+			"mission.weather.cyclones[%d] = {\n"+
+				"centerX = %0.1f,\n"+
+				"centerZ = %0.1f,\n"+
+				"pressure_spread = %0.1f,\n"+
+				"pressure_excess = %0.0f,\n"+
+				"ellipticity = %0.3f,\n"+
+				"rotation = %0.4f,\n"+
+				"}\n",
+			i+1, c.centerX, c.centerZ, c.spread, c.excess, c.ellipticity, c.rotation,
+		)
+
+		logger.Infow(
+			"pressure system:",
+			"x", c.centerX,
+			"z", c.centerZ,
+			"spread-km", c.spread/1000,
+			"excess-hPa", c.excess/100,
+			"ellipticity", c.ellipticity,
+			"rotation-deg", c.rotation*180/math.Pi,
+		)
+	}
+
+	if cfg.Dynamic {
+		fmt.Fprintf(&b, "mission.weather.atmosphere_type = %d\n", atmosphereDynamic)
+	}
+
+	if err := l.DoString(b.String()); err != nil {
+		return fmt.Errorf("error updating pressure systems: %v", err)
+	}
+
+	if len(cyclones) == 0 {
+		logger.Infoln("pressure field is flat, no pressure systems added")
+	} else if !cfg.Dynamic {
+		logger.Infoln("pressure systems are only used by missions with dynamic weather")
+	}
+
+	return nil
+}
+
+// fitCyclones fits a quadratic surface to the pressure field. If the surface
+// has a low or high within range, a single system is centered on it with the
+// curvature of the surface. Otherwise the gradient of the field is matched by
+// a broad system off to the side of the low or high pressure. No systems are
+// returned if the field is flat
+func fitCyclones(points []pressurePoint, limits cycloneLimits) ([]cyclone, error) {
+	if len(points) < 3 {
+		return nil, fmt.Errorf("need at least 3 pressure samples, got %d", len(points))
+	}
+
+	// fit relative to the center of the samples in km for better conditioning
+	var x0, z0 float64
+	for _, p := range points {
+		x0 += p.x / float64(len(points))
+		z0 += p.z / float64(len(points))
+	}
+
+	if c, ok := fitCenteredCyclone(points, x0, z0, limits); ok {
+		return []cyclone{c}, nil
+	}
+
+	// p = c + a*x + b*z
+	var rows [][]float64
+	var values []float64
+	for _, p := range points {
+		x, z := (p.x-x0)/1000, (p.z-z0)/1000
+		rows = append(rows, []float64{1, x, z})
+		values = append(values, p.pa)
+	}
+
+	coef, ok := leastSquares(rows, values)
+	if !ok {
+		return nil, fmt.Errorf("pressure samples are in a line")
+	}
+	mean, a, b := coef[0], coef[1], coef[2]
+
+	gradient := math.Hypot(a, b)
+	if gradient < minimumGradient {
+		return nil, nil
+	}
+
+	// a system of spread s with its steepest gradient, at s/sqrt(2) from its
+	// center, at the samples
+	s := limits.spreadMaximum / 1000
+	r := s / math.Sqrt2
+	excess := gradient * s * math.Exp(0.5) / math.Sqrt2
+
+	// a low sits downhill and a high uphill of the samples
+	dx, dz := a/gradient, b/gradient
+	if mean < standardPressure {
+		dx, dz, excess = -dx, -dz, -excess
+	}
+
+	return []cyclone{{
+		centerX:     x0 + dx*r*1000,
+		centerZ:     z0 + dz*r*1000,
+		spread:      s * 1000,
+		excess:      excess,
+		ellipticity: 1,
+	}}, nil
+}
+
+// fitCenteredCyclone fits p = c + a*x + b*z + d*x^2 + e*x*z + f*z^2 and returns
+// a system at its low or high if it is within range and is lower than standard
+// pressure for a low or higher for a high
+func fitCenteredCyclone(points []pressurePoint, x0, z0 float64, limits cycloneLimits) (cyclone, bool) {
+	if len(points) < 6 {
+		return cyclone{}, false
+	}
+
+	var rows [][]float64
+	var values []float64
+	for _, p := range points {
+		x, z := (p.x-x0)/1000, (p.z-z0)/1000
+		rows = append(rows, []float64{1, x, z, x * x, x * z, z * z})
+		values = append(values, p.pa)
+	}
+
+	coef, ok := leastSquares(rows, values)
+	if !ok {
+		return cyclone{}, false
+	}
+	c, a, b := coef[0], coef[1], coef[2]
+
+	// hessian [[hxx, hxz], [hxz, hzz]] in Pa/km^2
+	hxx, hxz, hzz := 2*coef[3], coef[4], 2*coef[5]
+	det := hxx*hzz - hxz*hxz
+	if det <= 0 {
+		// saddle or trough, there is no single low or high
+		return cyclone{}, false
+	}
+
+	// the gradient is zero at the center
+	cx := (-hzz*a + hxz*b) / det
+	cz := (hxz*a - hxx*b) / det
+	if math.Hypot(cx, cz)*1000 > limits.maxDistance {
+		return cyclone{}, false
+	}
+
+	excess := c + a*cx/2 + b*cz/2 - standardPressure
+	low := hxx > 0
+	if low != (excess < 0) || math.Abs(excess) < minimumExcess {
+		return cyclone{}, false
+	}
+
+	// for exp(-(r/s)^2) the curvature at the center is -2*excess/s^2
+	mean := (hxx + hzz) / 2
+	diff := math.Hypot((hxx-hzz)/2, hxz)
+	s1 := math.Sqrt(-2 * excess / (mean + diff))
+	s2 := math.Sqrt(-2 * excess / (mean - diff))
+
+	// rotation of the axis of s1, then of the long axis
+	rotation := math.Atan2(2*hxz, hxx-hzz) / 2
+	long, short := s1, s2
+	if s2 > s1 {
+		long, short = s2, s1
+		rotation += math.Pi / 2
+	}
+	rotation = math.Mod(rotation+math.Pi, math.Pi)
+
+	radius := math.Sqrt(long*short) * 1000
+	radius = util.Clamp(radius, limits.spreadMinimum, limits.spreadMaximum)
+
+	return cyclone{
+		centerX:     x0 + cx*1000,
+		centerZ:     z0 + cz*1000,
+		spread:      radius,
+		excess:      excess,
+		ellipticity: long / short,
+		rotation:    rotation,
+	}, true
+}
+
+// leastSquares solves for the coefficients minimizing the squared error of
+// rows * coef = values using the normal equations. Returns false if the rows
+// do not determine the coefficients
+func leastSquares(rows [][]float64, values []float64) ([]float64, bool) {
+	if len(rows) == 0 {
+		return nil, false
+	}
+	n := len(rows[0])
+
+	// augmented matrix of the normal equations
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n+1)
+		for k, row := range rows {
+			for j := 0; j < n; j++ {
+				m[i][j] += row[i] * row[j]
+			}
+			m[i][n] += row[i] * values[k]
+		}
+	}
+
+	// pivots this much smaller than the diagonal are treated as zero
+	var scale float64
+	for i := range m {
+		scale = math.Max(scale, math.Abs(m[i][i]))
+	}
+
+	// gaussian elimination with partial pivoting
+	for col := 0; col < n; col++ {
+		pivot := col
+		for i := col + 1; i < n; i++ {
+			if math.Abs(m[i][col]) > math.Abs(m[pivot][col]) {
+				pivot = i
+			}
+		}
+		if math.Abs(m[pivot][col]) <= 1e-12*scale {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for i := col + 1; i < n; i++ {
+			f := m[i][col] / m[col][col]
+			for j := col; j <= n; j++ {
+				m[i][j] -= f * m[col][j]
+			}
+		}
+	}
+
+	coef := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		coef[i] = m[i][n]
+		for j := i + 1; j < n; j++ {
+			coef[i] -= m[i][j] * coef[j]
+		}
+		coef[i] /= m[i][i]
+	}
+
+	return coef, true
+}
@@ -0,0 +1,95 @@
+package miz
+
+import (
+	"math"
+	"testing"
+)
+
+// TestFitCyclones checks pressure systems are recovered from pressure fields
+func TestFitCyclones(t *testing.T) {
+	limits := cycloneLimits{
+		spreadMinimum: 200e3,
+		spreadMaximum: 3000e3,
+		maxDistance:   2000e3,
+	}
+
+	// 7 by 7 grid spanning 1000 km
+	field := func(p func(x, z float64) float64) []pressurePoint {
+		var points []pressurePoint
+		for i := -3; i <= 3; i++ {
+			for j := -3; j <= 3; j++ {
+				x, z := float64(i)*500e3/3, float64(j)*500e3/3
+				points = append(points, pressurePoint{x, z, p(x, z)})
+			}
+		}
+		return points
+	}
+
+	// a round low of 20 hPa at x = 100 km, z = -50 km
+	low := field(func(x, z float64) float64 {
+		r2 := (x-100e3)*(x-100e3) + (z+50e3)*(z+50e3)
+		return standardPressure - 2000*math.Exp(-r2/(1500e3*1500e3))
+	})
+
+	cyclones, err := fitCyclones(low, limits)
+	if err != nil {
+		t.Fatalf("error fitting low: %v", err)
+	}
+	if len(cyclones) != 1 {
+		t.Fatalf("got %d systems, expected 1", len(cyclones))
+	}
+
+	c := cyclones[0]
+	if math.Hypot(c.centerX-100e3, c.centerZ+50e3) > 20e3 {
+		t.Errorf("got center %.0f, %.0f, expected 100000, -50000", c.centerX, c.centerZ)
+	}
+	if c.excess > -1800 || c.excess < -2200 {
+		t.Errorf("got excess %.0f, expected about -2000", c.excess)
+	}
+	if c.spread < 1200e3 || c.spread > 1800e3 {
+		t.Errorf("got spread %.0f, expected about 1500000", c.spread)
+	}
+	if c.ellipticity > 1.1 {
+		t.Errorf("got ellipticity %.2f, expected about 1", c.ellipticity)
+	}
+
+	// a low stretched along z
+	stretched := field(func(x, z float64) float64 {
+		r2 := x*x/(1000e3*1000e3) + z*z/(2000e3*2000e3)
+		return standardPressure - 1500*math.Exp(-r2)
+	})
+
+	cyclones, err = fitCyclones(stretched, limits)
+	if err != nil || len(cyclones) != 1 {
+		t.Fatalf("got %v, %v fitting stretched low", cyclones, err)
+	}
+	if cyclones[0].ellipticity < 1.5 {
+		t.Errorf("got ellipticity %.2f, expected about 2", cyclones[0].ellipticity)
+	}
+	if math.Abs(cyclones[0].rotation-math.Pi/2) > 0.05 {
+		t.Errorf("got rotation %.2f, expected long axis along z", cyclones[0].rotation)
+	}
+
+	// a uniform gradient rising to the north places a high to the north
+	gradient := field(func(x, z float64) float64 {
+		return standardPressure + 500 + x*0.002
+	})
+
+	cyclones, err = fitCyclones(gradient, limits)
+	if err != nil || len(cyclones) != 1 {
+		t.Fatalf("got %v, %v fitting gradient", cyclones, err)
+	}
+	if cyclones[0].excess <= 0 || cyclones[0].centerX <= 0 {
+		t.Errorf("got %+v, expected a high to the north", cyclones[0])
+	}
+
+	// flat fields have no systems
+	flat := field(func(x, z float64) float64 { return standardPressure })
+	if cyclones, err := fitCyclones(flat, limits); err != nil || len(cyclones) != 0 {
+		t.Errorf("got %v, %v for flat field, expected no systems", cyclones, err)
+	}
+
+	if _, err := fitCyclones(flat[:2], limits); err == nil {
+		t.Errorf("expected error for too few samples")
+	}
+}
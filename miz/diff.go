@@ -0,0 +1,180 @@
+package miz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// DiffFormat is the output format of a mission diff
+type DiffFormat string
+
+const (
+	DiffHuman DiffFormat = "human" // aligned lines of before -> after
+	DiffJSON  DiffFormat = "json"  // list of changes
+)
+
+// snapshotFields are the fields of the mission table included in a snapshot
+var snapshotFields = []string{"weather", "start_time", "date"}
+
+// unset is shown in place of a value for fields missing before or after
+const unset = "(unset)"
+
+// Change is a field of the mission that differs between two snapshots. Before
+// and After are nil if the field is missing from that snapshot
+type Change struct {
+	Field  string  `json:"field"`
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+// Snapshot returns the fields of the loaded mission that Real Weather updates
+// and the brief text, keyed by their path, e.g. weather.wind.atGround.speed
+func Snapshot() (map[string]string, error) {
+	mission, ok := l.GetGlobal("mission").(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("mission not loaded")
+	}
+
+	fields := make(map[string]string)
+	for _, field := range snapshotFields {
+		flatten(fields, field, mission.RawGetString(field))
+	}
+
+	brief, err := readBrief()
+	if err != nil {
+		return nil, err
+	}
+	fields["brief"] = brief
+
+	return fields, nil
+}
+
+// readBrief reads the brief text from the dictionary of the open mission
+// without changing the loaded mission
+func readBrief() (string, error) {
+	dl := lua.NewState()
+	defer dl.Close()
+
+	if err := doEntry(dl, "l10n/DEFAULT/dictionary"); err != nil {
+		return "", fmt.Errorf("error loading mission dictionary: %v", err)
+	}
+
+	dict, ok := dl.GetGlobal("dictionary").(*lua.LTable)
+	if !ok {
+		return "", fmt.Errorf("mission dictionary is not a table")
+	}
+
+	brief, _ := dict.RawGetString("DictKey_descriptionText_1").(lua.LString)
+	return string(brief), nil
+}
+
+// flatten adds value to fields under path, adding each field of tables under
+// its own path. Numeric keys are written as indexes, e.g. cyclones[1]
+func flatten(fields map[string]string, path string, value lua.LValue) {
+	switch v := value.(type) {
+	case *lua.LTable:
+		v.ForEach(func(key, value lua.LValue) {
+			if key.Type() == lua.LTNumber {
+				flatten(fields, fmt.Sprintf("%s[%v]", path, key), value)
+			} else {
+				flatten(fields, path+"."+key.String(), value)
+			}
+		})
+	case lua.LString:
+		fields[path] = fmt.Sprintf("%q", string(v))
+	case *lua.LNilType:
+		// missing fields are left out
+	default:
+		fields[path] = v.String()
+	}
+}
+
+// Diff returns every field that differs between two snapshots, sorted by field
+func Diff(before, after map[string]string) []Change {
+	var changes []Change
+
+	for field, value := range before {
+		b := value
+		if a, ok := after[field]; !ok {
+			changes = append(changes, Change{field, &b, nil})
+		} else if a != b {
+			changes = append(changes, Change{field, &b, &a})
+		}
+	}
+
+	for field, value := range after {
+		a := value
+		if _, ok := before[field]; !ok {
+			changes = append(changes, Change{field, nil, &a})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b Change) int {
+		return strings.Compare(a.Field, b.Field)
+	})
+
+	return changes
+}
+
+// WriteDiff writes the changes to the named mission to w in the given format
+func WriteDiff(w io.Writer, mission string, changes []Change, format DiffFormat) error {
+	switch format {
+	case DiffJSON:
+		if changes == nil {
+			changes = []Change{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Mission string   `json:"mission"`
+			Changes []Change `json:"changes"`
+		}{mission, changes})
+
+	case DiffHuman:
+		if len(changes) == 0 {
+			_, err := fmt.Fprintf(w, "no changes to %s\n", mission)
+			return err
+		}
+
+		width := 0
+		for _, change := range changes {
+			width = max(width, len(change.Field))
+		}
+
+		if _, err := fmt.Fprintf(w, "%d changes to %s:\n", len(changes), mission); err != nil {
+			return err
+		}
+
+		for _, change := range changes {
+			before, after := unset, unset
+			if change.Before != nil {
+				before = *change.Before
+			}
+			if change.After != nil {
+				after = *change.After
+			}
+
+			if _, err := fmt.Fprintf(
+				w,
+				"  %-*s  %s -> %s\n",
+				width,
+				change.Field+":",
+				before,
+				after,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported diff format \"%s\"", format)
+	}
+}
@@ -0,0 +1,103 @@
+package miz
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// TestDiff checks changed, added, and removed fields are found in order
+func TestDiff(t *testing.T) {
+	state := lua.NewState()
+	defer state.Close()
+
+	snapshot := func(code string) map[string]string {
+		if err := state.DoString(code); err != nil {
+			t.Fatalf("error running lua: %v", err)
+		}
+		fields := make(map[string]string)
+		flatten(fields, "weather", state.GetGlobal("weather"))
+		return fields
+	}
+
+	before := snapshot(`weather = {
+		qnh = 760,
+		clouds = { preset = "Preset1", base = 1200 },
+		enable_fog = false,
+	}`)
+	after := snapshot(`weather = {
+		qnh = 755,
+		clouds = { preset = "Preset7", base = 1200 },
+		cyclones = { { centerX = 100 } },
+	}`)
+
+	changes := Diff(before, after)
+
+	want := []struct {
+		field, before, after string
+	}{
+		{"weather.clouds.preset", `"Preset1"`, `"Preset7"`},
+		{"weather.cyclones[1].centerX", unset, "100"},
+		{"weather.enable_fog", "false", unset},
+		{"weather.qnh", "760", "755"},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, expected %d: %+v", len(changes), len(want), changes)
+	}
+
+	value := func(s *string) string {
+		if s == nil {
+			return unset
+		}
+		return *s
+	}
+
+	for i, w := range want {
+		c := changes[i]
+		if c.Field != w.field || value(c.Before) != w.before || value(c.After) != w.after {
+			t.Errorf(
+				"got %s: %s -> %s, expected %s: %s -> %s",
+				c.Field, value(c.Before), value(c.After),
+				w.field, w.before, w.after,
+			)
+		}
+	}
+
+	var human bytes.Buffer
+	if err := WriteDiff(&human, "mission.miz", changes, DiffHuman); err != nil {
+		t.Fatalf("error writing human diff: %v", err)
+	}
+	if !strings.HasPrefix(human.String(), "4 changes to mission.miz:") {
+		t.Errorf("human diff missing mission:\n%s", human.String())
+	}
+	if !strings.Contains(human.String(), `"Preset1" -> "Preset7"`) {
+		t.Errorf("human diff missing preset change:\n%s", human.String())
+	}
+
+	var out bytes.Buffer
+	if err := WriteDiff(&out, "mission.miz", changes, DiffJSON); err != nil {
+		t.Fatalf("error writing json diff: %v", err)
+	}
+
+	var decoded struct {
+		Mission string   `json:"mission"`
+		Changes []Change `json:"changes"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("error decoding json diff: %v", err)
+	}
+	if decoded.Mission != "mission.miz" {
+		t.Errorf("got mission %q from json diff, expected mission.miz", decoded.Mission)
+	}
+	if len(decoded.Changes) != len(changes) || decoded.Changes[1].Before != nil {
+		t.Errorf("got %+v from json diff", decoded.Changes)
+	}
+
+	if err := WriteDiff(&out, "mission.miz", changes, "xml"); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
@@ -0,0 +1,224 @@
+package miz
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/evogelsa/DCS-real-weather/v2/theatre"
+)
+
+// unitCategories are the tables of each country containing unit groups
+var unitCategories = []string{"plane", "helicopter", "vehicle", "ship", "static"}
+
+// Theatre returns the projection of the loaded mission's theatre
+func Theatre() (theatre.Theatre, error) {
+	mission, ok := l.GetGlobal("mission").(*lua.LTable)
+	if !ok {
+		return theatre.Theatre{}, fmt.Errorf("mission not loaded")
+	}
+
+	name, ok := mission.RawGetString("theatre").(lua.LString)
+	if !ok {
+		return theatre.Theatre{}, fmt.Errorf("mission has no theatre")
+	}
+
+	return theatre.Get(string(name))
+}
+
+// Location returns the latitude and longitude of the loaded mission using the
+// given source. The bullseye source uses the blue bullseye, the units source
+// uses the center of all unit groups in the mission, and the airbase source
+// uses the airbase that most aircraft groups start from
+func Location(source theatre.LocationSource) (latitude, longitude float64, err error) {
+	t, err := Theatre()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	mission := l.GetGlobal("mission").(*lua.LTable)
+
+	var x, z float64
+	switch source {
+	case theatre.LocationBullseye:
+		x, z, err = bullseye(mission, "blue")
+	case theatre.LocationUnits:
+		x, z, err = unitsCenter(mission)
+	case theatre.LocationAirbase:
+		x, z, err = airbase(mission)
+	default:
+		err = fmt.Errorf("unsupported location source \"%s\"", source)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	latitude, longitude = t.ToLatLon(x, z)
+	return latitude, longitude, nil
+}
+
+// bullseye returns the position of the bullseye of the given coalition
+func bullseye(mission *lua.LTable, coalition string) (x, z float64, err error) {
+	table := getTable(mission, "coalition", coalition, "bullseye")
+	if table == nil {
+		return 0, 0, fmt.Errorf("mission has no %s bullseye", coalition)
+	}
+
+	return position(table)
+}
+
+// unitsCenter returns the center of the positions of every unit group
+func unitsCenter(mission *lua.LTable) (x, z float64, err error) {
+	var n int
+
+	coalitions := getTable(mission, "coalition")
+	if coalitions == nil {
+		return 0, 0, fmt.Errorf("mission has no coalitions")
+	}
+
+	coalitions.ForEach(func(_, coalition lua.LValue) {
+		countries := getTable(coalition, "country")
+		if countries == nil {
+			return
+		}
+
+		countries.ForEach(func(_, country lua.LValue) {
+			for _, category := range unitCategories {
+				groups := getTable(country, category, "group")
+				if groups == nil {
+					continue
+				}
+
+				groups.ForEach(func(_, group lua.LValue) {
+					table, ok := group.(*lua.LTable)
+					if !ok {
+						return
+					}
+
+					gx, gz, err := position(table)
+					if err != nil {
+						return
+					}
+
+					x += gx
+					z += gz
+					n++
+				})
+			}
+		})
+	})
+
+	if n == 0 {
+		return 0, 0, fmt.Errorf("mission has no units")
+	}
+
+	return x / float64(n), z / float64(n), nil
+}
+
+// airbase returns the position of the airbase that most plane and helicopter
+// groups start from. The mission file has no airbase positions, so the
+// position is the center of the first waypoints at the airbase, which are on
+// its parking spots or runway
+func airbase(mission *lua.LTable) (x, z float64, err error) {
+	type start struct {
+		x, z float64
+		n    int
+	}
+	starts := map[int]*start{}
+
+	coalitions := getTable(mission, "coalition")
+	if coalitions == nil {
+		return 0, 0, fmt.Errorf("mission has no coalitions")
+	}
+
+	coalitions.ForEach(func(_, coalition lua.LValue) {
+		countries := getTable(coalition, "country")
+		if countries == nil {
+			return
+		}
+
+		countries.ForEach(func(_, country lua.LValue) {
+			for _, category := range []string{"plane", "helicopter"} {
+				groups := getTable(country, category, "group")
+				if groups == nil {
+					continue
+				}
+
+				groups.ForEach(func(_, group lua.LValue) {
+					points := getTable(group, "route", "points")
+					if points == nil {
+						return
+					}
+
+					point, ok := points.RawGetInt(1).(*lua.LTable)
+					if !ok {
+						return
+					}
+
+					id, ok := point.RawGetString("airdromeId").(lua.LNumber)
+					if !ok {
+						return
+					}
+
+					px, pz, err := position(point)
+					if err != nil {
+						return
+					}
+
+					s, ok := starts[int(id)]
+					if !ok {
+						s = &start{}
+						starts[int(id)] = s
+					}
+					s.x += px
+					s.z += pz
+					s.n++
+				})
+			}
+		})
+	})
+
+	// the lowest id wins a tie so the airbase does not change between runs
+	best := -1
+	for id, s := range starts {
+		if best < 0 || s.n > starts[best].n || (s.n == starts[best].n && id < best) {
+			best = id
+		}
+	}
+	if best < 0 {
+		return 0, 0, fmt.Errorf("mission has no aircraft starting at an airbase")
+	}
+
+	s := starts[best]
+	return s.x / float64(s.n), s.z / float64(s.n), nil
+}
+
+// position returns the x and y fields of a mission table. The y field of the
+// mission file is the z axis of the DCS world
+func position(table *lua.LTable) (x, z float64, err error) {
+	lx, okx := table.RawGetString("x").(lua.LNumber)
+	ly, oky := table.RawGetString("y").(lua.LNumber)
+	if !okx || !oky {
+		return 0, 0, fmt.Errorf("missing position")
+	}
+
+	return float64(lx), float64(ly), nil
+}
+
+// getTable follows keys through nested tables, returning nil if any key is
+// missing or is not a table
+func getTable(value lua.LValue, keys ...string) *lua.LTable {
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	for _, key := range keys {
+		table, ok = table.RawGetString(key).(*lua.LTable)
+		if !ok {
+			return nil
+		}
+	}
+
+	return table
+}
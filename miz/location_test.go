@@ -0,0 +1,75 @@
+package miz
+
+import (
+	"math"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/evogelsa/DCS-real-weather/v2/theatre"
+)
+
+// TestLocation loads a mission and checks the bullseye, units, and airbase
+// locations
+func TestLocation(t *testing.T) {
+	const input = `mission = {
+	["theatre"] = "Caucasus",
+	["coalition"] = {
+		["blue"] = {
+			["bullseye"] = { ["x"] = -284860, ["y"] = 683839 },
+			["country"] = {
+				[1] = {
+					["plane"] = { ["group"] = {
+						[1] = { ["x"] = -280000, ["y"] = 680000 },
+						[2] = { ["x"] = -284900, ["y"] = 683800, ["route"] = { ["points"] = {
+							[1] = { ["airdromeId"] = 26, ["x"] = -284900, ["y"] = 683800 },
+						} } },
+						[3] = { ["x"] = -318000, ["y"] = 636000, ["route"] = { ["points"] = {
+							[1] = { ["airdromeId"] = 22, ["x"] = -318000, ["y"] = 636000 },
+						} } },
+					} },
+					["helicopter"] = { ["group"] = {
+						[1] = { ["x"] = -284820, ["y"] = 683880, ["route"] = { ["points"] = {
+							[1] = { ["airdromeId"] = 26, ["x"] = -284820, ["y"] = 683880 },
+							[2] = { ["airdromeId"] = 22, ["x"] = -318000, ["y"] = 636000 },
+						} } },
+					} },
+					["vehicle"] = { ["group"] = {
+						[1] = { ["x"] = -289720, ["y"] = 687678 },
+					} },
+				},
+			},
+		},
+		["red"] = { ["country"] = {} },
+	},
+}`
+
+	if err := l.DoString(input); err != nil {
+		t.Fatalf("bad test case: %v", err)
+	}
+	defer l.SetGlobal("mission", lua.LNil)
+
+	tests := []struct {
+		source   theatre.LocationSource
+		lat, lon float64
+	}{
+		{theatre.LocationBullseye, 42.1767, 42.4826},
+		{theatre.LocationUnits, 42.1285, 42.3581},
+		{theatre.LocationAirbase, 42.1767, 42.4826},
+	}
+
+	for _, test := range tests {
+		lat, lon, err := Location(test.source)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.source, err)
+			continue
+		}
+		if math.Abs(lat-test.lat) > 0.01 || math.Abs(lon-test.lon) > 0.01 {
+			t.Errorf("%s: got %f, %f, expected %f, %f", test.source, lat, lon, test.lat, test.lon)
+		}
+	}
+
+	if _, _, err := Location(theatre.LocationConfig); err == nil {
+		t.Errorf("expected error for config source")
+	}
+}
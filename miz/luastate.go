@@ -4,10 +4,11 @@ import (
 	lua "github.com/yuin/gopher-lua"
 )
 
-var l *lua.LState
+var l = newState()
 
-func init() {
-	l = lua.NewState(lua.Options{
+// newState returns a new lua state for loading a mission
+func newState() *lua.LState {
+	return lua.NewState(lua.Options{
 		RegistrySize:     1024,
 		RegistryMaxSize:  1024 * 1024,
 		RegistryGrowStep: 1024,
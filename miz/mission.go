@@ -3,10 +3,7 @@ package miz
 import (
 	"fmt"
 	"math"
-	"math/rand"
-	"os"
 	"slices"
-	"strconv"
 	"strings"
 	"time"
 
@@ -18,45 +15,149 @@ import (
 	"github.com/evogelsa/DCS-real-weather/v2/weather"
 )
 
+// unrestrictedVisibility in meters is reported as 9999 or CAVOK, which means
+// 10 km or more
+const unrestrictedVisibility = 9999
+
+// precipitation is the kind of precipitation, using the values of iprecptns
+// in the mission file
 type precipitation int
 
 const (
-	precipNone precipitation = iota
-	precipSome
-	precipStorm
+	precipNone      precipitation = iota // no precipitation
+	precipRain                           // rain
+	precipStorm                          // thunderstorm
+	precipSnow                           // snow, only below freezing
+	precipSnowStorm                      // snowstorm, only below freezing
 )
 
-// UpdateMission applies weather and time updates to the unpacked mission file
-func UpdateMission(data *weather.WeatherData, windsAloft weather.WindsAloft) error {
+// frozen returns whether the precipitation is snow
+func (p precipitation) frozen() bool {
+	return p == precipSnow || p == precipSnowStorm
+}
+
+// String returns the METAR code of the precipitation
+func (p precipitation) String() string {
+	switch p {
+	case precipRain:
+		return "RA"
+	case precipStorm:
+		return "TS"
+	case precipSnow:
+		return "SN"
+	case precipSnowStorm:
+		return "+SN"
+	default:
+		return "None"
+	}
+}
+
+// Load loads the mission of the open mission file into a new Lua VM. It must
+// be called before the mission is read or updated
+func Load() error {
 	logger.Infoln("loading mission into Lua VM...")
 
+	// start from a new lua state so nothing is left from a previous mission
+	l.Close()
+	l = newState()
+
 	// load mission file into lua vm
-	if err := l.DoFile("mission_unpacked/mission"); err != nil {
+	if err := doEntry(l, "mission"); err != nil {
 		return fmt.Errorf("error parsing mission file: %v", err)
 	}
 
 	logger.Infoln("loaded mission into Lua VM")
+
+	return nil
+}
+
+// Clock is where the mission time and date are taken from, and whether the
+// configured offsets are applied
+type Clock struct {
+	SystemTime    bool // use the system time instead of the observation time
+	SystemDate    bool // use the system date instead of the observation date
+	IgnoreOffsets bool // use the time and date without the configured offsets
+}
+
+// ConfiguredClock returns the clock set in the config
+func ConfiguredClock() Clock {
+	return Clock{
+		SystemTime: config.Get().Options.Time.SystemTime,
+		SystemDate: config.Get().Options.Date.SystemDate,
+	}
+}
+
+// Choices are the random choices made when weather is applied to a mission.
+// They are made once with Choose, so every mission updated with the same
+// weather gets the same clouds, fog, and winds
+type Choices struct {
+	Preset        string // cloud preset from checkClouds
+	Base          int    // cloud base in meters MSL
+	Thickness     int    // custom cloud thickness in meters
+	Density       int    // custom cloud density
+	FogThickness  int    // meters
+	WindShift2000 int    // degrees the legacy wind at 2000 m veers from the ground
+	WindShift8000 int    // degrees the legacy wind at 8000 m veers from 2000 m
+	WindDirection int    // degrees the variable ground wind is from
+}
+
+// Choose makes the random choices for applying the weather to missions
+func Choose(data *weather.WeatherData) Choices {
+	var choices Choices
+
+	if config.Get().Options.Weather.Enable && config.Get().Options.Weather.Clouds.Enable {
+		choices.Preset, choices.Base = checkClouds(data)
+		if strings.Contains(choices.Preset, "CUSTOM") {
+			choices.Thickness, choices.Density = customClouds(data, choices.Preset)
+		}
+	}
+
+	if config.Get().Options.Weather.Enable && config.Get().Options.Weather.Fog.Enable && checkFog(data) > 0 {
+		choices.FogThickness = util.Intn(
+			int(config.Get().Options.Weather.Fog.ThicknessMaximum+0.5)-
+				int(config.Get().Options.Weather.Fog.ThicknessMinimum+0.5),
+		) + int(config.Get().Options.Weather.Fog.ThicknessMinimum+0.5)
+	}
+
+	// this is not really realistic but it adds variety to wind calculation
+	choices.WindShift2000 = util.Intn(45)
+	choices.WindShift8000 = util.Intn(45)
+
+	if data.Data[0].Wind != nil && data.Data[0].Wind.Variable {
+		logger.Infoln("converting variable winds to random direction")
+		choices.WindDirection = util.Intn(36) * 10
+	}
+
+	return choices
+}
+
+// UpdateMission applies weather and time updates to the loaded mission and
+// replaces the mission of the open mission file. If windsAloft is nil, legacy winds are
+// used instead. Pressure systems are fitted to the pressure samples if enabled.
+// The mission time and date are taken from clock, and random choices from
+// choices
+func UpdateMission(data *weather.WeatherData, windsAloft *weather.WindsAloft, pressure []weather.PressureSample, clock Clock, choices Choices) error {
 	logger.Infoln("updating mission...")
 
 	// update weather if enabled
 	if config.Get().Options.Weather.Enable {
 		// remove extra weather data and add copy for output
 		data.Data = []weather.Data{data.Data[0], data.Data[0]}
-		if err := updateWeather(data, windsAloft, l); err != nil {
+		if err := updateWeather(data, windsAloft, pressure, choices, l); err != nil {
 			return fmt.Errorf("error updating weather: %v", err)
 		}
 	}
 
 	// update time if enabled
 	if config.Get().Options.Time.Enable {
-		if err := updateTime(data, l); err != nil {
+		if err := updateTime(data, clock, l); err != nil {
 			return fmt.Errorf("error updating time: %v", err)
 		}
 	}
 
 	// update date if enabled
 	if config.Get().Options.Date.Enable {
-		if err := updateDate(data, l); err != nil {
+		if err := updateDate(data, clock, l); err != nil {
 			return fmt.Errorf("error updating date: %v", err)
 		}
 	}
@@ -64,17 +165,17 @@ func UpdateMission(data *weather.WeatherData, windsAloft weather.WindsAloft) err
 	logger.Infoln("updated mission")
 	logger.Infoln("writing new mission file...")
 
-	// remove and write new mission file by dumping lua state
-
-	if err := os.Remove("mission_unpacked/mission"); err != nil {
-		return fmt.Errorf("error removing mission: %v", err)
-	}
-
+	// write new mission file by dumping lua state
 	lv := l.GetGlobal("mission")
 	if tbl, ok := lv.(*lua.LTable); ok {
-		s := serializeTable(tbl, 0)
+		s, err := serializeTable(tbl, 0)
+		if err != nil {
+			return fmt.Errorf("error serializing mission: %v", err)
+		}
 		s = "mission = " + s
-		os.WriteFile("mission_unpacked/mission", []byte(s), 0666)
+		if err := writeEntry("mission", []byte(s)); err != nil {
+			return fmt.Errorf("error writing mission: %v", err)
+		}
 	} else {
 		return fmt.Errorf("error dumping serialized state")
 	}
@@ -85,14 +186,14 @@ func UpdateMission(data *weather.WeatherData, windsAloft weather.WindsAloft) err
 }
 
 // updateWeather applies new weather to the given lua state using data
-func updateWeather(data *weather.WeatherData, windsAloft weather.WindsAloft, l *lua.LState) error {
+func updateWeather(data *weather.WeatherData, windsAloft *weather.WindsAloft, pressure []weather.PressureSample, choices Choices, l *lua.LState) error {
 	if config.Get().Options.Weather.Wind.Enable {
-		if config.Get().API.OpenMeteo.Enable {
-			if err := updateWind(data, windsAloft, l); err != nil {
+		if windsAloft != nil {
+			if err := updateWind(data, *windsAloft, choices, l); err != nil {
 				return fmt.Errorf("error updating wind: %v", err)
 			}
 		} else {
-			if err := updateWindLegacy(data, l); err != nil {
+			if err := updateWindLegacy(data, choices, l); err != nil {
 				return fmt.Errorf("error updating wind: %v", err)
 			}
 		}
@@ -108,10 +209,22 @@ func updateWeather(data *weather.WeatherData, windsAloft weather.WindsAloft, l *
 		if err := updatePressure(data, l); err != nil {
 			return fmt.Errorf("error updating pressure: %v", err)
 		}
+
+		if config.Get().Options.Weather.Pressure.Cyclones.Enable {
+			if err := updateCyclones(pressure, l); err != nil {
+				return fmt.Errorf("error updating pressure systems: %v", err)
+			}
+		}
+	}
+
+	if config.Get().Options.Weather.Visibility.Enable {
+		if err := updateVisibility(data, l); err != nil {
+			return fmt.Errorf("error updating visibility: %v", err)
+		}
 	}
 
 	if config.Get().Options.Weather.Fog.Enable {
-		if err := updateFog(data, l); err != nil {
+		if err := updateFog(data, choices, l); err != nil {
 			return fmt.Errorf("error updating fog: %v", err)
 		}
 	}
@@ -123,7 +236,7 @@ func updateWeather(data *weather.WeatherData, windsAloft weather.WindsAloft, l *
 	}
 
 	if config.Get().Options.Weather.Clouds.Enable {
-		if err := updateClouds(data, l); err != nil {
+		if err := updateClouds(data, choices, l); err != nil {
 			return fmt.Errorf("error updating clouds: %v", err)
 		}
 	}
@@ -131,10 +244,9 @@ func updateWeather(data *weather.WeatherData, windsAloft weather.WindsAloft, l *
 	return nil
 }
 
-// updateClouds applies cloud data from the given weather to the lua state
-func updateClouds(data *weather.WeatherData, l *lua.LState) error {
-	// determine preset to use and cloud base
-	preset, base := checkClouds(data)
+// updateClouds applies the chosen clouds to the lua state
+func updateClouds(data *weather.WeatherData, choices Choices, l *lua.LState) error {
+	preset, base := choices.Preset, choices.Base
 
 	// set state in weather so it can be used for generating METAR
 	weather.SelectedPreset = preset
@@ -142,7 +254,7 @@ func updateClouds(data *weather.WeatherData, l *lua.LState) error {
 
 	// check clouds returns custom, use data to construct custom weather
 	if strings.Contains(preset, "CUSTOM") {
-		err := handleCustomClouds(data, l, preset, base)
+		err := handleCustomClouds(data, l, preset, base, choices)
 		if err != nil {
 			return fmt.Errorf("error making custom clouds: %v", err)
 		}
@@ -153,14 +265,19 @@ func updateClouds(data *weather.WeatherData, l *lua.LState) error {
 	// add clouds to lua state
 	if preset != "" {
 		// using a preset
+		thickness := 200
+		if p, ok := weather.LookupPreset(preset); ok && p.Thickness > 0 {
+			thickness = p.Thickness
+		}
+
 		if err := l.DoString(
 			fmt.Sprintf(
-				"mission.weather.clouds.thickness = 200\n"+
+				"mission.weather.clouds.thickness = %d\n"+
 					"mission.weather.clouds.density = 0\n"+
 					"mission.weather.clouds.preset = %s\n"+
 					"mission.weather.clouds.base = %d\n"+
 					"mission.weather.clouds.iprecptns = 0\n",
-				preset, base,
+				thickness, preset, base,
 			),
 		); err != nil {
 			return fmt.Errorf("error updating clouds: %v", err)
@@ -193,16 +310,55 @@ func updateClouds(data *weather.WeatherData, l *lua.LState) error {
 
 // handleCustomClouds generates legacy weather when no preset capable of matching
 // the desired weather
-func handleCustomClouds(data *weather.WeatherData, l *lua.LState, preset string, base int) error {
+func handleCustomClouds(data *weather.WeatherData, l *lua.LState, preset string, base int, choices Choices) error {
 	// only one kind possible when using custom
-	var thickness int = rand.Intn(1801) + 200 // 200 - 2000
-	var density int                           //   0 - 10
-	precip := precipNone                      //   0 - 2
-	base = util.Clamp(base, 300, 5000)        // 300 - 5000
+	thickness := choices.Thickness     // 200 - 2000
+	density := choices.Density         //   0 - 10
+	precip := precipNone               //   0 - 4
+	base = util.Clamp(base, 300, 5000) // 300 - 5000
 
 	// update selected base since legacy clouds have limit between 300 - 5000m
 	weather.SelectedBase = base - int(config.Get().Options.Weather.RunwayElevation+0.5)
 
+	if config.Get().Options.Weather.Clouds.Custom.AllowPrecipitation {
+		precip = checkPrecip(data)
+	}
+
+	// apply to lua state
+	if err := l.DoString(
+		fmt.Sprintf(
+			"mission.weather.clouds.thickness = %d\n"+
+				"mission.weather.clouds.density = %d\n"+
+				"mission.weather.clouds.preset = nil\n"+
+				"mission.weather.clouds.base = %d\n"+
+				"mission.weather.clouds.iprecptns = %d\n",
+			thickness,
+			density,
+			base,
+			precip,
+		),
+	); err != nil {
+		return fmt.Errorf("error updating clouds: %v", err)
+	}
+
+	logger.Infow(
+		"clouds:",
+		"preset", preset,
+		"base-meters", base,
+		"base-feet", int(float64(base)*weather.MetersToFeet),
+		"thickness-meters", thickness,
+		"thickness-feet", int(float64(thickness)*weather.MetersToFeet),
+		"precipitation", precip.String(),
+	)
+
+	return nil
+}
+
+// customClouds chooses the thickness and density of custom clouds for the
+// custom preset from checkClouds
+func customClouds(data *weather.WeatherData, preset string) (thickness, density int) {
+	thickness = util.Intn(1801) + 200 // 200 - 2000
+
 	//  0 - clear
 	//  1 - few
 	//  2 - few
@@ -215,20 +371,14 @@ func handleCustomClouds(data *weather.WeatherData, l *lua.LState, preset string,
 	//  9 - bkn
 	// 10 - ovc
 
+	precip := precipNone
 	if config.Get().Options.Weather.Clouds.Custom.AllowPrecipitation {
 		precip = checkPrecip(data)
 	}
 
-	var precipStr string
-	if precip == precipStorm {
+	if precip == precipStorm || precip == precipSnowStorm {
 		// make thunderstorm clouds thicc
-		thickness = rand.Intn(501) + 1500 // can be up to 2000
-		precipStr = "TS"
-	} else if precip == precipSome {
-		thickness = rand.Intn(1801) + 200 // 200 - 2000
-		precipStr = "RA"
-	} else {
-		precipStr = "None"
+		thickness = util.Intn(501) + 1500 // can be up to 2000
 	}
 
 	// convert cloud type to layer sky coverage, known as density in DCS
@@ -238,11 +388,11 @@ func handleCustomClouds(data *weather.WeatherData, l *lua.LState, preset string,
 	case "OVC":
 		density = 10
 	case "BKN":
-		density = rand.Intn(3) + 7
+		density = util.Intn(3) + 7
 	case "SCT":
-		density = rand.Intn(3) + 4
+		density = util.Intn(3) + 4
 	case "FEW":
-		density = rand.Intn(3) + 1
+		density = util.Intn(3) + 1
 	default:
 		density = 0
 	}
@@ -253,31 +403,29 @@ func handleCustomClouds(data *weather.WeatherData, l *lua.LState, preset string,
 		config.Get().Options.Weather.Clouds.Custom.DensityMaximum,
 	)
 
-	// apply to lua state
+	return thickness, density
+}
+
+// updateVisibility applies the reported visibility to the mission, including
+// visibility reduced by haze, smoke, or precipitation
+func updateVisibility(data *weather.WeatherData, l *lua.LState) error {
+	visibility := checkVisibility(data)
+
 	if err := l.DoString(
 		fmt.Sprintf(
-			"mission.weather.clouds.thickness = %d\n"+
-				"mission.weather.clouds.density = %d\n"+
-				"mission.weather.clouds.preset = nil\n"+
-				"mission.weather.clouds.base = %d\n"+
-				"mission.weather.clouds.iprecptns = %d\n",
-			thickness,
-			density,
-			base,
-			precip,
+			"mission.weather.visibility = mission.weather.visibility or {}\n"+
+				"mission.weather.visibility.distance = %d\n",
+			visibility,
 		),
 	); err != nil {
-		return fmt.Errorf("error updating clouds: %v", err)
+		return fmt.Errorf("error updating visibility: %v", err)
 	}
 
 	logger.Infow(
-		"clouds:",
-		"preset", preset,
-		"base-meters", base,
-		"base-feet", int(float64(base)*weather.MetersToFeet),
-		"thickness-meters", thickness,
-		"thickness-feet", int(float64(thickness)*weather.MetersToFeet),
-		"precipitation", precipStr,
+		"visibility:",
+		"meters", visibility,
+		"feet", int(float64(visibility)*weather.MetersToFeet),
+		"restricted", data.Data[0].Visibility.MetersFloat < unrestrictedVisibility,
 	)
 
 	return nil
@@ -316,9 +464,14 @@ func updateDust(data *weather.WeatherData, l *lua.LState) error {
 	return nil
 }
 
-// updateFog applies fog to mission state
-func updateFog(data *weather.WeatherData, l *lua.LState) error {
-	fogVis, fogThick := checkFog(data)
+// updateFog applies fog with the chosen thickness to mission state
+func updateFog(data *weather.WeatherData, choices Choices, l *lua.LState) error {
+	fogVis := checkFog(data)
+
+	var fogThick int
+	if fogVis > 0 {
+		fogThick = choices.FogThickness
+	}
 
 	if fogVis <= 0 {
 		if err := l.DoString(
@@ -473,12 +626,12 @@ func updateTemperature(data *weather.WeatherData, l *lua.LState) error {
 
 // updateWind uses open meteo data to get winds aloft data then applies this to
 // the mission state
-func updateWind(data *weather.WeatherData, windsAloft weather.WindsAloft, l *lua.LState) error {
+func updateWind(data *weather.WeatherData, windsAloft weather.WindsAloft, choices Choices, l *lua.LState) error {
 	// get initial wind for each level and apply scale factor
 	scaleFactor := config.Get().Options.Weather.Wind.ScaleFactor
 	speedGround := windSpeed(1, data) * scaleFactor
-	speed2000 := windsAloft.WindSpeed1900 * scaleFactor
-	speed8000 := windsAloft.WindSpeed7200 * scaleFactor
+	speed2000 := windsAloft.WindSpeed2000 * scaleFactor
+	speed8000 := windsAloft.WindSpeed8000 * scaleFactor
 
 	// cap wind speeds to configured values
 	minWind := config.Get().Options.Weather.Wind.Minimum
@@ -491,8 +644,11 @@ func updateWind(data *weather.WeatherData, windsAloft weather.WindsAloft, l *lua
 	data.Data[1].Wind.SpeedMPS = speedGround
 
 	dirGround := int(data.Data[0].Wind.Degrees)
-	dir2000 := windsAloft.WindDirection1900
-	dir8000 := windsAloft.WindDirection7200
+	if data.Data[0].Wind.Variable {
+		dirGround = choices.WindDirection
+	}
+	dir2000 := windsAloft.WindDirection2000
+	dir8000 := windsAloft.WindDirection8000
 
 	// clamp wind directions to configured values
 	minDir := config.Get().Options.Weather.Wind.DirectionMinimum
@@ -509,6 +665,7 @@ func updateWind(data *weather.WeatherData, windsAloft weather.WindsAloft, l *lua
 
 	// set direction to data out
 	data.Data[1].Wind.Degrees = float64((dirGround + 180) % 360)
+	data.Data[1].Wind.Variable = false
 
 	// apply to mission state
 	if err := l.DoString(
@@ -544,35 +701,29 @@ func updateWind(data *weather.WeatherData, windsAloft weather.WindsAloft, l *lua
 		},
 	)
 
-	// apply gustiness/turbulence to mission
-	gust := data.Data[0].Wind.GustMPS * scaleFactor
+	// apply gustiness/turbulence to mission. The gust limits only apply to the
+	// mission gust, turbulence is modeled from the reported gust
+	reported := data.Data[0].Wind.GustMPS * scaleFactor
 	minGust := config.Get().Options.Weather.Wind.GustMinimum
 	maxGust := config.Get().Options.Weather.Wind.GustMaximum
-	gust = util.Clamp(gust, minGust, maxGust)
+	gust := util.Clamp(reported, minGust, maxGust)
 
 	// update data out
 	data.Data[1].Wind.GustMPS = gust
 
-	if err := l.DoString(
-		// convert to ED gust units (whatever those are?)
-		fmt.Sprintf("mission.weather.groundTurbulence = %0.4f\n", gust*weather.MPSToEDUnits),
-	); err != nil {
-		return fmt.Errorf("error updating turbulence: %v", err)
-	}
-
 	logger.Infow(
 		"gusts:",
 		"mps", gust,
 		"kt", gust*weather.MPSToKt,
 	)
 
-	return nil
+	return updateTurbulence(data, speedGround, reported, l)
 }
 
 // updateWindLegacy applies reported wind to mission state and also calculates
 // and applies winds aloft using wind profile power law. This function also
 // applies turbulence/gust data to the mission
-func updateWindLegacy(data *weather.WeatherData, l *lua.LState) error {
+func updateWindLegacy(data *weather.WeatherData, choices Choices, l *lua.LState) error {
 	// calculate initial wind for each level and multiply by scale factor
 	scaleFactor := config.Get().Options.Weather.Wind.ScaleFactor
 	speedGround := windSpeed(1, data) * scaleFactor
@@ -589,11 +740,17 @@ func updateWindLegacy(data *weather.WeatherData, l *lua.LState) error {
 	// update data out
 	data.Data[1].Wind.SpeedMPS = speedGround
 
-	// apply wind shift to winds aloft layers
-	// this is not really realistic but it adds variety to wind calculation
+	// apply the chosen wind shift to winds aloft layers
 	dirGround := int(data.Data[0].Wind.Degrees)
-	dir2000 := rand.Intn(45) + dirGround
-	dir8000 := rand.Intn(45) + dir2000
+	if data.Data[0].Wind.Variable {
+		dirGround = choices.WindDirection
+
+		// set direction to data out
+		data.Data[1].Wind.Degrees = float64(dirGround)
+		data.Data[1].Wind.Variable = false
+	}
+	dir2000 := choices.WindShift2000 + dirGround
+	dir8000 := choices.WindShift8000 + dir2000
 
 	// clamp wind directions to configured values
 	minDir := config.Get().Options.Weather.Wind.DirectionMinimum
@@ -642,55 +799,28 @@ func updateWindLegacy(data *weather.WeatherData, l *lua.LState) error {
 		},
 	)
 
-	// apply gustiness/turbulence to mission
-	gust := data.Data[0].Wind.GustMPS * scaleFactor
+	// apply gustiness/turbulence to mission. The gust limits only apply to the
+	// mission gust, turbulence is modeled from the reported gust
+	reported := data.Data[0].Wind.GustMPS * scaleFactor
 	minGust := config.Get().Options.Weather.Wind.GustMinimum
 	maxGust := config.Get().Options.Weather.Wind.GustMaximum
-	gust = util.Clamp(gust, minGust, maxGust)
+	gust := util.Clamp(reported, minGust, maxGust)
 
 	// update data out
 	data.Data[1].Wind.GustMPS = gust
 
-	if err := l.DoString(
-		fmt.Sprintf("mission.weather.groundTurbulence = %0.4f\n", gust),
-	); err != nil {
-		return fmt.Errorf("error updating turbulence: %v", err)
-	}
-
 	logger.Infow(
 		"gusts:",
 		"mps", gust,
 		"kt", gust*weather.MPSToKt,
 	)
 
-	return nil
+	return updateTurbulence(data, speedGround, reported, l)
 }
 
 // updateTime applies time plus/minus configured offset to the mission
-func updateTime(data *weather.WeatherData, l *lua.LState) error {
-	var t time.Time
-	var err error
-	if config.Get().Options.Time.SystemTime {
-		t = time.Now()
-	} else {
-		t, err = time.Parse("2006-01-02T15:04:05", data.Data[0].Observed)
-		if err != nil {
-			t, err = time.Parse("2006-01-02T15:04:05Z", data.Data[0].Observed)
-			if err != nil {
-				logger.Errorf("error parsing METAR time: %v", err)
-				logger.Warnln("using system time as fallback")
-				t = time.Now()
-			}
-		}
-	}
-
-	offset, err := time.ParseDuration(config.Get().Options.Time.Offset)
-	if err != nil {
-		logger.Errorf("could not parse time-offset of %s: %v", config.Get().Options.Time.Offset, err)
-		logger.Warnln("using default offset of 0")
-		offset = 0
-	}
-	t = t.Add(offset)
+func updateTime(data *weather.WeatherData, clock Clock, l *lua.LState) error {
+	t := missionTime(data, clock)
 
 	seconds := ((t.Hour()*60)+t.Minute())*60 + t.Second()
 
@@ -716,30 +846,8 @@ func updateTime(data *weather.WeatherData, l *lua.LState) error {
 }
 
 // updateDate applies date plus/minus configured offset to the mission
-func updateDate(data *weather.WeatherData, l *lua.LState) error {
-	var t time.Time
-	var err error
-	if config.Get().Options.Date.SystemDate {
-		t = time.Now()
-	} else {
-		t, err = time.Parse("2006-01-02T15:04:05", data.Data[0].Observed)
-		if err != nil {
-			t, err = time.Parse("2006-01-02T15:04:05Z", data.Data[0].Observed)
-			if err != nil {
-				logger.Errorf("error parsing METAR date: %v", err)
-				logger.Warnln("using system date as fallback")
-				t = time.Now()
-			}
-		}
-	}
-
-	offset, err := util.ParseDateDuration(config.Get().Options.Date.Offset)
-	if err != nil {
-		logger.Errorf("could not parse time-offset of %s: %v", config.Get().Options.Date.Offset, err)
-		logger.Warnln("using default offset of 0")
-		offset = 0
-	}
-	t = t.Add(offset)
+func updateDate(data *weather.WeatherData, clock Clock, l *lua.LState) error {
+	t := missionDate(data, clock)
 
 	if err := l.DoString(
 		fmt.Sprintf(
@@ -762,276 +870,215 @@ func updateDate(data *weather.WeatherData, l *lua.LState) error {
 	return nil
 }
 
-// returns extrapolated wind speed at given height using power law
-// https://en.wikipedia.org/wiki/Wind_profile_power_law
-// targHeight should be provided in meters MSL
-func windSpeed(targHeight float64, data *weather.WeatherData) float64 {
-	// default to 9 meters for reference height if elevation is below that
-	var refHeight float64
-	if config.Get().Options.Weather.Wind.FixedReference {
-		refHeight = 1
-	} else {
-		refHeight = math.Max(1, float64(config.Get().Options.Weather.RunwayElevation))
-	}
+// StartTime returns the time the mission will start once the configured time
+// and date updates are applied. If time or date updates are disabled, the
+// observation time is used for that part instead. The time and date are taken
+// from clock
+func StartTime(data *weather.WeatherData, clock Clock) time.Time {
+	observed := observedTime(data)
 
-	refSpeed := data.Data[0].Wind.SpeedMPS
+	timeOfDay := observed
+	if config.Get().Options.Time.Enable {
+		timeOfDay = missionTime(data, clock)
+	}
 
-	// enforce minimum targheight of 0
-	targHeight = math.Max(0, targHeight)
+	date := observed
+	if config.Get().Options.Date.Enable {
+		date = missionDate(data, clock)
+	}
 
-	return refSpeed * math.Pow(
-		targHeight/refHeight,
-		config.Get().Options.Weather.Wind.Stability,
+	return time.Date(
+		date.Year(), date.Month(), date.Day(),
+		timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), 0,
+		time.UTC,
 	)
 }
 
-// checkPrecip returns 0 for clear, 1 for rain, and 2 for thunderstorms
-func checkPrecip(data *weather.WeatherData) precipitation {
-	for _, condition := range data.Data[0].Conditions {
-		if slices.Contains(weather.PrecipCodes(), condition.Code) {
-			return precipSome
-		} else if slices.Contains(weather.StormCodes(), condition.Code[:2]) {
-			return precipStorm
-		}
+// missionTime returns the system or METAR time from clock plus the configured
+// offset, unless clock ignores it
+func missionTime(data *weather.WeatherData, clock Clock) time.Time {
+	var t time.Time
+	if clock.SystemTime {
+		t = time.Now()
+	} else {
+		t = observedTime(data)
 	}
-	return precipNone
-}
-
-// checkClouds returns the thickness, density and base of the first cloud
-// layer reported in the METAR in meters
-func checkClouds(data *weather.WeatherData) (string, int) {
-	var ceiling bool
-	var preset string
-	var base int
 
-	// if no clouds then assume clear
-	if len(data.Data[0].Clouds) == 0 {
-		return "", 0
+	if clock.IgnoreOffsets {
+		return t
 	}
 
-	base = int(config.Get().Options.Weather.RunwayElevation + 0.5)
-
-	precip := checkPrecip(data)
-
-	// determine if there is a ceiling
-	for _, cloud := range data.Data[0].Clouds {
-		if cloud.Code == "BKN" || cloud.Code == "OVC" {
-			ceiling = true
-		}
+	offset, err := time.ParseDuration(config.Get().Options.Time.Offset)
+	if err != nil {
+		logger.Errorf("could not parse time-offset of %s: %v", config.Get().Options.Time.Offset, err)
+		logger.Warnln("using default offset of 0")
+		offset = 0
 	}
 
-	// tracks coverage of fullest layer
-	fullestLayer := 0
-
-	// tracks index of layer being used as base
-	baseLayer := 0
+	return t.Add(offset)
+}
 
-	// table to convert cloud code to integer
-	codeToVal := map[string]int{
-		"OVC": 4,
-		"BKN": 3,
-		"SCT": 2,
-		"FEW": 1,
+// missionDate returns the system or METAR date from clock plus the configured
+// offset, unless clock ignores it
+func missionDate(data *weather.WeatherData, clock Clock) time.Time {
+	var t time.Time
+	if clock.SystemDate {
+		t = time.Now()
+	} else {
+		t = observedTime(data)
 	}
 
-	// find first layer to be used as base. Prioritizes fullest layer if there
-	// is precip, otherwise picks first ceiling if there is ceiling, otherwise
-	// picks first layer
-	for i, cloud := range data.Data[0].Clouds {
-		if precip > precipNone {
-			if codeToVal[cloud.Code] > fullestLayer {
-				fullestLayer = codeToVal[cloud.Code]
-				baseLayer = i
-			}
-		} else if ceiling {
-			if cloud.Code == "FEW" || cloud.Code == "SCT" {
-				continue
-			}
-			baseLayer = i
-			break
-		} else {
-			baseLayer = i
-			break
-		}
+	if clock.IgnoreOffsets {
+		return t
 	}
 
-	base += int(data.Data[0].Clouds[baseLayer].Meters)
-	code := data.Data[0].Clouds[baseLayer].Code
-
-	// clamp base between configured min and max
-	base = util.Clamp(
-		base,
-		config.Get().Options.Weather.Clouds.Base.Minimum,
-		config.Get().Options.Weather.Clouds.Base.Maximum,
-	)
-
-	// updates base with selected in case of fallback to legacy
-	preset, base = selectPreset(code, base, precip > precipNone)
-
-	return preset, base
-}
-
-// selectPreset uses the given weather data to best select a preset that is
-// suitable. If no suitable preset is found and fallback to no preset is enabled
-// then custom weather will be used. If fallback is not enabled but a default
-// preset is configured, use that. Otherwise the the preset defaults to clear.
-func selectPreset(kind string, base int, precip bool) (string, int) {
-	// check for clear skies
-	if slices.Contains(weather.ClearCodes(), kind) {
-		return "", 0
+	offset, err := util.ParseDateDuration(config.Get().Options.Date.Offset)
+	if err != nil {
+		logger.Errorf("could not parse time-offset of %s: %v", config.Get().Options.Date.Offset, err)
+		logger.Warnln("using default offset of 0")
+		offset = 0
 	}
 
-	// if precip and overcast, then use OVC+RA preset
-	// if precip and broken, then use BKN+RA preset
-	// if precip and scattered, then use SCT+RA preset
-	// if precip and not ovc/bkn/sct but using legacy wx, use legacy wx
-	// if precip and not ovc/bkn/sct but not using legacy wx, ignore precip
-
-	if precip {
-		if kind == "OVC" {
-			kind = "OVC+RA"
-		} else if kind == "BKN" {
-			kind = "BKN+RA"
-		} else if kind == "SCT" {
-			kind = "SCT+RA"
-		} else if config.Get().Options.Weather.Clouds.Custom.Enable {
-			logger.Warnf("no suitable weather preset for code=%s and base=%d", kind, base)
-			logger.Infoln("custom clouds are enabled, using custom weather")
-			return "CUSTOM " + kind[:3], base
-		} else {
-			logger.Warnf("no suitable preset for %s clouds with precip", kind)
-			logger.Warnln("fallback to no preset is disabled, so precip will be ignored")
-		}
-	}
+	return t.Add(offset)
+}
 
-	// make a list of possible presets that can be used to match weather
-	var validPresets []weather.CloudPreset
-	var validPresetsIgnoreBase []weather.CloudPreset
-	for _, preset := range weather.CloudPresets[kind] {
-		if presetAllowed(preset.Name) {
-			if util.Between(base, preset.MinBase, preset.MaxBase) {
-				validPresets = append(validPresets, preset)
-			} else if preset.MinBase < int(config.Get().Options.Weather.Clouds.Base.Maximum) &&
-				preset.MaxBase > int(config.Get().Options.Weather.Clouds.Base.Minimum) {
-				// we also construct a list of presets that don't have a cloud
-				// base range that allow for matching the METAR base; however,
-				// these presets must still be constrained by the configured
-				// min and max base. These are used if no preset match is made
-				// and the search must be expanded (and deviate from the METAR)
-				validPresetsIgnoreBase = append(validPresetsIgnoreBase, preset)
-			}
+// observedTime returns the time of the METAR observation, falling back to
+// system time if it cannot be parsed
+func observedTime(data *weather.WeatherData) time.Time {
+	t, err := time.Parse("2006-01-02T15:04:05", data.Data[0].Observed)
+	if err != nil {
+		t, err = time.Parse("2006-01-02T15:04:05Z", data.Data[0].Observed)
+		if err != nil {
+			logger.Errorf("error parsing METAR time: %v", err)
+			logger.Warnln("using system time as fallback")
+			t = time.Now()
 		}
 	}
 
-	// randomly select a valid preset
-	if len(validPresets) > 0 {
-		preset := validPresets[rand.Intn(len(validPresets))]
-		return preset.Name, base
-	}
-
-	logger.Warnf("no suitable weather preset for code=%s and base=%d", kind, base)
+	return t
+}
 
-	// no valid preset found, is use nonpreset weather enabled?
-	if config.Get().Options.Weather.Clouds.Custom.Enable {
-		logger.Infoln("custom clouds are enabled, using custom weather")
-		return "CUSTOM " + kind[:3], base
+// returns extrapolated wind speed at given height using power law
+// https://en.wikipedia.org/wiki/Wind_profile_power_law
+// targHeight should be provided in meters MSL
+func windSpeed(targHeight float64, data *weather.WeatherData) float64 {
+	// default to 9 meters for reference height if elevation is below that
+	var refHeight float64
+	if config.Get().Options.Weather.Wind.FixedReference {
+		refHeight = 1
+	} else {
+		refHeight = math.Max(1, float64(config.Get().Options.Weather.RunwayElevation))
 	}
 
-	logger.Infof("fallback to no preset is disabled, expanding search to only %s\n", kind)
-
-	// since fallback disabled and no preset available, expand valid presets to
-	// include those that matches the desired cloud type and ignore desired base
-	// (but base still falls within configured limits)
-	validPresets = append(validPresets, validPresetsIgnoreBase...)
-
-	// still no valid presets? use the configured default preset if there is
-	// one, otherwise default to clear
-	if len(validPresets) == 0 {
-		if config.Get().Options.Weather.Clouds.Presets.Default != "" {
-			defaultPreset := config.Get().Options.Weather.Clouds.Presets.Default
-			defaultPreset = `"` + defaultPreset + `"`
-
-			logger.Warnf("no allowed presets for %s", kind)
-			logger.Warnf("defaulting to %s", defaultPreset)
-
-			// get base in hundreds of feet
-			base, _ := strconv.Atoi(weather.DecodePreset[defaultPreset][0].Base)
+	refSpeed := data.Data[0].Wind.SpeedMPS
 
-			// convert to feet
-			base *= 100
+	// enforce minimum targheight of 0
+	targHeight = math.Max(0, targHeight)
 
-			// convert to meters
-			base = int(float64(base)*weather.FeetToMeters + 0.5)
+	return refSpeed * math.Pow(
+		targHeight/refHeight,
+		config.Get().Options.Weather.Wind.Stability,
+	)
+}
 
-			// clamp base between desired min and max base. DCS should clamp
-			// the value to the correct range for the preset, so the configured
-			// min and max base may be ignored if this happens. the user should
-			// have been warned of this possibility during the config validation
-			base = util.Clamp(
-				base,
-				config.Get().Options.Weather.Clouds.Base.Minimum,
-				config.Get().Options.Weather.Clouds.Base.Maximum,
-			)
+// checkPrecip returns the precipitation reported in the METAR. Precipitation
+// is snow if the temperature is below freezing, since DCS only allows rain
+// above freezing and snow below it. Thunderstorms and heavy snow below
+// freezing are snowstorms
+func checkPrecip(data *weather.WeatherData) precipitation {
+	var precip, storm, heavy bool
+	for _, condition := range data.Data[0].Conditions {
+		// blowing and drifting snow is lifted by the wind, it is not falling
+		if strings.HasPrefix(condition.Code, "BL") || strings.HasPrefix(condition.Code, "DR") {
+			continue
+		}
 
-			return defaultPreset, base
-		} else {
-			logger.Warnf("no allowed presets for %s", kind)
-			logger.Warnln("defaulting to CLR")
-			return "", 0
+		// codes may combine several kinds of weather, e.g. TSRA or RASN
+		for i := 0; i+2 <= len(condition.Code); i += 2 {
+			code := condition.Code[i : i+2]
+			if slices.Contains(weather.StormCodes(), code) {
+				storm = true
+			} else if slices.Contains(weather.PrecipCodes(), code) {
+				precip = true
+				if condition.Prefix == "+" && slices.Contains(weather.SnowCodes(), code) {
+					heavy = true
+				}
+			}
 		}
 	}
 
-	// random select a valid preset from the expanded list
-	preset := validPresets[rand.Intn(len(validPresets))]
-	return preset.Name, rand.Intn(preset.MaxBase-preset.MinBase) + preset.MinBase
-}
-
-// presetAllowed checks if a preset is in the disallowed presets inside the
-// config file. If the preset is disallowed the func returns false
-func presetAllowed(preset string) bool {
-	for _, disallowed := range config.Get().Options.Weather.Clouds.Presets.Disallowed {
-		if preset == `"`+disallowed+`"` {
-			return false
-		}
+	if !precip && !storm {
+		return precipNone
 	}
 
-	return true
+	frozen := data.Data[0].Temperature != nil && data.Data[0].Temperature.Celsius < 0
+
+	switch {
+	case frozen && (storm || heavy):
+		return precipSnowStorm
+	case frozen:
+		return precipSnow
+	case storm:
+		return precipStorm
+	default:
+		return precipRain
+	}
 }
 
-// checkFog looks for either misty or foggy conditions and returns and integer
-// representing dcs visiblity scale
-func checkFog(data *weather.WeatherData) (visibility, thickness int) {
+// checkFog looks for either misty or foggy conditions and returns the fog
+// visibility in meters, or 0 if there is no fog
+func checkFog(data *weather.WeatherData) (visibility int) {
 	for _, condition := range data.Data[0].Conditions {
-		if slices.Contains(weather.FogCodes(), condition.Code) {
-			thickness = rand.Intn(
-				int(config.Get().Options.Weather.Fog.ThicknessMaximum+0.5)-
-					int(config.Get().Options.Weather.Fog.ThicknessMinimum+0.5),
-			) + int(config.Get().Options.Weather.Fog.ThicknessMinimum+0.5)
-
-			visibility = int(util.Clamp(
+		// freezing fog is fog, while shallow, patchy, and partial fog (MIFG,
+		// BCFG, and PRFG) do not cover the field and are left out
+		code := strings.TrimPrefix(condition.Code, "FZ")
+		if slices.Contains(weather.FogCodes(), code) {
+			return int(util.Clamp(
 				data.Data[0].Visibility.MetersFloat,
 				config.Get().Options.Weather.Fog.VisibilityMinimum,
 				config.Get().Options.Weather.Fog.VisibilityMaximum,
 			))
-
-			return
 		}
 	}
 
-	return
+	return 0
 }
 
 // checkDust looks for dust conditions and returns a number representing
-// visibility in meters
+// visibility in meters. Haze and smoke are shown as dust only if they reduce
+// visibility to within the dust visibility range
 func checkDust(data *weather.WeatherData) (visibility int) {
+	minimum := config.Get().Options.Weather.Dust.VisibilityMinimum
+	maximum := config.Get().Options.Weather.Dust.VisibilityMaximum
+	meters := data.Data[0].Visibility.MetersFloat
+
 	for _, condition := range data.Data[0].Conditions {
-		if slices.Contains(weather.DustCodes(), condition.Code) {
-			return int(util.Clamp(
-				data.Data[0].Visibility.MetersFloat,
-				config.Get().Options.Weather.Dust.VisibilityMinimum,
-				config.Get().Options.Weather.Dust.VisibilityMaximum,
-			))
+		// blowing dust and sand (BLDU and BLSA) reduce visibility like dust
+		code := strings.TrimPrefix(condition.Code, "BL")
+		if slices.Contains(weather.DustCodes(), code) ||
+			slices.Contains(weather.HazeCodes(), code) && meters <= maximum {
+			return int(util.Clamp(meters, minimum, maximum))
 		}
 	}
 	return 0
 }
+
+// checkVisibility returns the mission visibility in meters within the
+// configured limits
+func checkVisibility(data *weather.WeatherData) int {
+	return limitVisibility(
+		data.Data[0].Visibility.MetersFloat,
+		config.Get().Options.Weather.Visibility.Minimum,
+		config.Get().Options.Weather.Visibility.Maximum,
+	)
+}
+
+// limitVisibility returns the visibility in meters limited to minimum and
+// maximum. Visibility of 10 km or more is unrestricted and uses maximum
+func limitVisibility(meters, minimum, maximum float64) int {
+	if meters >= unrestrictedVisibility {
+		meters = maximum
+	}
+
+	return int(util.Clamp(meters, minimum, maximum) + 0.5)
+}
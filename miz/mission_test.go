@@ -0,0 +1,31 @@
+package miz
+
+import (
+	"testing"
+
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+// TestLimitVisibility checks visibility is limited to the configured range and
+// unrestricted visibility, including the default, uses the maximum
+func TestLimitVisibility(t *testing.T) {
+	tests := []struct {
+		meters   float64
+		expected int
+	}{
+		{800, 800},
+		{0.5 * weather.MilesToMeters, 805},
+		{50, 100},
+		{9000, 9000},
+		{9999, 40000},
+		{10000, 40000},
+		{16093, 40000},
+		{weather.DefaultWeather.Data[0].Visibility.MetersFloat, 40000},
+	}
+
+	for _, test := range tests {
+		if got := limitVisibility(test.meters, 100, 40000); got != test.expected {
+			t.Errorf("%.0f m: got %d, expected %d", test.meters, got, test.expected)
+		}
+	}
+}
@@ -1,67 +1,208 @@
 package miz
 
 import (
-	"bytes"
+	"cmp"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
 
 	lua "github.com/yuin/gopher-lua"
-
-	"github.com/evogelsa/DCS-real-weather/v2/logger"
 )
 
-func serializeTable(tbl *lua.LTable, indentLevel uint) string {
-	var buf bytes.Buffer
+// maxExactInteger is the largest magnitude below which every integer is exactly
+// representable as a float64 and is written without an exponent
+const maxExactInteger = 1 << 53
+
+// serializeTable serializes tbl as a Lua table constructor. Numeric keys are
+// written first in ascending order, then string keys in sorted order, so the
+// same table is always written the same way. An error is returned for keys or
+// values which cannot be written as Lua, such as functions
+func serializeTable(tbl *lua.LTable, indentLevel uint) (string, error) {
+	var b strings.Builder
+	if err := writeTable(&b, tbl, indentLevel, "", make(map[*lua.LTable]bool)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeTable writes tbl to b. path is the path of tbl used in errors, and seen
+// holds the tables containing tbl so cycles are found
+func writeTable(b *strings.Builder, tbl *lua.LTable, indentLevel uint, path string, seen map[*lua.LTable]bool) error {
 	const indent = "\t"
 
-	startString := "{\n"
-	buf.WriteString(startString)
+	if seen[tbl] {
+		return fmt.Errorf("%s: table contains itself", pathOrRoot(path))
+	}
+	seen[tbl] = true
+	defer delete(seen, tbl)
+
+	keys, err := sortedKeys(tbl, path)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		b.WriteString("{ }")
+		return nil
+	}
+
+	b.WriteString("{\n")
 
-	tbl.ForEach(func(key lua.LValue, value lua.LValue) {
+	for i, key := range keys {
 		// indent
-		buf.WriteString(strings.Repeat(indent, int(indentLevel+1)))
+		b.WriteString(strings.Repeat(indent, int(indentLevel+1)))
 
 		// serialize key
-		switch key.Type() {
-		case lua.LTString:
-			buf.WriteString(fmt.Sprintf("[%q] = ", key.String()))
-		case lua.LTNumber:
-			buf.WriteString(fmt.Sprintf("[%v] = ", lua.LVAsNumber(key)))
-		default:
-			logger.Errorf("error serializing mission: unsupported key %v with type %s", key, key.Type().String())
+		var keyPath string
+		switch k := key.(type) {
+		case lua.LString:
+			b.WriteString("[" + quoteString(string(k)) + "] = ")
+			keyPath = string(k)
+			if path != "" {
+				keyPath = path + "." + keyPath
+			}
+		case lua.LNumber:
+			n, err := formatNumber(float64(k))
+			if err != nil {
+				return fmt.Errorf("%s: key %v", pathOrRoot(path), err)
+			}
+			b.WriteString("[" + n + "] = ")
+			keyPath = path + "[" + n + "]"
 		}
 
 		// serialize value
-		switch value.Type() {
-		case lua.LTString:
-			s := strings.ReplaceAll(value.String(), `\`, `\\`)
-			s = strings.ReplaceAll(s, "\n", "\\\n")
-			s = strings.ReplaceAll(s, "\"", "\\\"")
-			s = fmt.Sprintf("\"%s\"", s)
-			buf.WriteString(s)
-		case lua.LTNumber:
-			buf.WriteString(fmt.Sprintf("%v", lua.LVAsNumber(value)))
-		case lua.LTBool:
-			buf.WriteString(fmt.Sprintf("%t", lua.LVAsBool(value)))
-		case lua.LTTable:
+		switch v := tbl.RawGet(key).(type) {
+		case lua.LString:
+			b.WriteString(quoteString(string(v)))
+		case lua.LNumber:
+			n, err := formatNumber(float64(v))
+			if err != nil {
+				return fmt.Errorf("%s: %v", keyPath, err)
+			}
+			b.WriteString(n)
+		case lua.LBool:
+			b.WriteString(strconv.FormatBool(bool(v)))
+		case *lua.LTable:
 			// recursively serialize any tables
-			buf.WriteString(serializeTable(value.(*lua.LTable), indentLevel+1))
+			if err := writeTable(b, v, indentLevel+1, keyPath, seen); err != nil {
+				return err
+			}
 		default:
-			logger.Errorf("error serializing mission: unsupported value %v with type %s", value, value.Type().String())
+			return fmt.Errorf("%s: unsupported value %v with type %s", keyPath, v, v.Type())
 		}
 
-		buf.WriteString(",\n")
+		if i < len(keys)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(strings.Repeat(indent, int(indentLevel)) + "}")
+
+	return nil
+}
+
+// sortedKeys returns the keys of tbl with numeric keys first in ascending
+// order, then string keys in sorted order
+func sortedKeys(tbl *lua.LTable, path string) ([]lua.LValue, error) {
+	var numbers []lua.LNumber
+	var stringKeys []lua.LString
+	var err error
+
+	tbl.ForEach(func(key, _ lua.LValue) {
+		switch k := key.(type) {
+		case lua.LNumber:
+			numbers = append(numbers, k)
+		case lua.LString:
+			stringKeys = append(stringKeys, k)
+		default:
+			if err == nil {
+				err = fmt.Errorf("%s: unsupported key %v with type %s", pathOrRoot(path), key, key.Type())
+			}
+		}
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(numbers, func(a, b lua.LNumber) int { return cmp.Compare(a, b) })
+	slices.Sort(stringKeys)
+
+	keys := make([]lua.LValue, 0, len(numbers)+len(stringKeys))
+	for _, n := range numbers {
+		keys = append(keys, n)
+	}
+	for _, s := range stringKeys {
+		keys = append(keys, s)
+	}
+
+	return keys, nil
+}
+
+// formatNumber formats n so it is read back as exactly n. Integers are written
+// without a decimal point or exponent, and other numbers with the fewest digits
+// that read back exactly. NaN and infinities have no Lua literal and are errors
+func formatNumber(n float64) (string, error) {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return "", fmt.Errorf("unsupported number %v", n)
+	}
 
-	// if wrote more than just opening bracket, remove the last comma and \n
-	// otherwise remove just the newline
-	if buf.Len() > len(startString) {
-		buf.Truncate(buf.Len() - 2)
-		buf.WriteString("\n" + strings.Repeat(indent, int(indentLevel)) + "}")
-	} else {
-		buf.Truncate(buf.Len() - 1)
-		buf.WriteString(" }")
+	if n == math.Trunc(n) && math.Abs(n) < maxExactInteger {
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
 	}
 
-	return buf.String()
+	return strconv.FormatFloat(n, 'g', -1, 64), nil
+}
+
+// quoteString quotes s as a Lua string. Newlines are escaped with a backslash
+// before the newline as DCS does, other control characters with their named
+// escape or decimal code, and all other bytes are written as they are
+func quoteString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString("\\\n")
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\v':
+			b.WriteString(`\v`)
+		default:
+			if c < ' ' || c == 0x7f {
+				// three digits so a following digit is not read as part of it
+				fmt.Fprintf(&b, `\%03d`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// pathOrRoot returns path, or a name for the root table if path is empty
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "table"
+	}
+	return path
 }
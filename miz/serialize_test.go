@@ -1,7 +1,15 @@
 package miz
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/quick"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -24,7 +32,10 @@ trigger.action.outTextForCoalition(2,'Enemy cargo plane has landed',15)"
 	l.DoString(input)
 	lv := l.GetGlobal("mission")
 	if tbl, ok := lv.(*lua.LTable); ok {
-		s := serializeTable(tbl, 0)
+		s, err := serializeTable(tbl, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
 		s = "mission = " + s
 		output = s
 	} else {
@@ -35,3 +46,319 @@ trigger.action.outTextForCoalition(2,'Enemy cargo plane has landed',15)"
 		t.Fatalf("got\n%#q\n\nexpected\n%#q", output, input)
 	}
 }
+
+// TestSerializeTableOrder checks numeric keys are written first in ascending
+// order, then string keys in sorted order, however the table was built
+func TestSerializeTableOrder(t *testing.T) {
+	const input = `t = {
+		zulu = 1,
+		[10] = "ten",
+		alpha = { b = 2, a = 1 },
+		[-1.5] = true,
+		[2] = "two",
+		Bravo = {},
+		"one",
+	}`
+	const expected = `{
+	[-1.5] = true,
+	[1] = "one",
+	[2] = "two",
+	[10] = "ten",
+	["Bravo"] = { },
+	["alpha"] = {
+		["a"] = 1,
+		["b"] = 2
+	},
+	["zulu"] = 1
+}`
+
+	got := serializeString(t, input, "t")
+	if got != expected {
+		t.Fatalf("got\n%s\n\nexpected\n%s", got, expected)
+	}
+}
+
+// TestSerializeTableValues checks numbers and strings are written so they read
+// back exactly
+func TestSerializeTableValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`12345678`, `12345678`},
+		{`-43200`, `-43200`},
+		{`2^53`, `9.007199254740992e+15`},
+		{`0.1`, `0.1`},
+		{`1e-7`, `1e-07`},
+		{`3.086666666666667`, `3.086666666666667`},
+		{`1/3`, `0.3333333333333333`},
+		{`"plain"`, `"plain"`},
+		{`"quote \" and backslash \\"`, `"quote \" and backslash \\"`},
+		{`"line\nbreak"`, "\"line\\\nbreak\""},
+		{`"\a\b\f\r\t\v"`, `"\a\b\f\r\t\v"`},
+		{`"\0\0011\031\127"`, `"\000\0011\031\127"`},
+		{`"Привет"`, `"Привет"`},
+		{`"\200\255"`, "\"\xc8\xff\""},
+	}
+
+	for _, test := range tests {
+		got := serializeString(t, "t = { "+test.input+" }", "t")
+		expected := "{\n\t[1] = " + test.expected + "\n}"
+		if got != expected {
+			t.Errorf("%s: got %#q, expected %#q", test.input, got, expected)
+		}
+	}
+}
+
+// TestSerializeTableErrors checks values which cannot be written as Lua are
+// errors naming where they are
+func TestSerializeTableErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		path  string
+	}{
+		{`t = { a = { b = print } }`, "a.b"},
+		{`t = { a = { [true] = 1 } }`, "a"},
+		{`t = { a = { 0/0 } }`, "a[1]"},
+		{`t = { [1/0] = 1 }`, "table"},
+		{`t = { a = {} }; t.a.b = t`, "a.b"},
+		{`t = { a = {} }; t.a[1] = t.a`, "a[1]"},
+	}
+
+	for _, test := range tests {
+		l := lua.NewState()
+		if err := l.DoString(test.input); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := serializeTable(l.GetGlobal("t").(*lua.LTable), 0)
+		if err == nil {
+			t.Errorf("%s: expected error", test.input)
+		} else if !strings.HasPrefix(err.Error(), test.path+":") {
+			t.Errorf("%s: got error %q, expected it to start with %q", test.input, err, test.path)
+		}
+
+		l.Close()
+	}
+}
+
+// TestSerializeTableRoundTrip checks random tables read back the same after
+// being serialized, and serialize the same every time
+func TestSerializeTableRoundTrip(t *testing.T) {
+	check := func(tbl randomTable) bool {
+		return roundTrip(t, tbl.LTable)
+	}
+
+	if err := quick.Check(check, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSerializeTableMissions checks each mission file in testdata reads back
+// the same after being serialized, and that loading and serializing it again
+// gives the same output
+func TestSerializeTableMissions(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := serializeString(t, string(b), name)
+			second := serializeString(t, string(b), name)
+			if first != second {
+				t.Fatalf("serialized differently from separate states")
+			}
+
+			l := lua.NewState()
+			defer l.Close()
+			if err := l.DoString(string(b)); err != nil {
+				t.Fatal(err)
+			}
+
+			if !roundTrip(t, l.GetGlobal(name).(*lua.LTable)) {
+				t.Fatalf("round trip differs")
+			}
+		})
+	}
+}
+
+// serializeString runs input in a new state and returns the serialized global
+// named name
+func serializeString(t *testing.T, input, name string) string {
+	t.Helper()
+
+	l := lua.NewState()
+	defer l.Close()
+
+	if err := l.DoString(input); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, ok := l.GetGlobal(name).(*lua.LTable)
+	if !ok {
+		t.Fatalf("%s is not a table", name)
+	}
+
+	s, err := serializeTable(tbl, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// roundTrip serializes tbl, reads it back in a new state, and reports whether
+// it is equal to tbl and serializes the same again
+func roundTrip(t *testing.T, tbl *lua.LTable) bool {
+	t.Helper()
+
+	s, err := serializeTable(tbl, 0)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+
+	l := lua.NewState()
+	defer l.Close()
+
+	if err := l.DoString("t = " + s); err != nil {
+		t.Errorf("unable to read back %#q: %v", s, err)
+		return false
+	}
+
+	got := l.GetGlobal("t").(*lua.LTable)
+	if !equalValues(tbl, got) {
+		t.Errorf("read back differently:\n%s", s)
+		return false
+	}
+
+	again, err := serializeTable(got, 0)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	if again != s {
+		t.Errorf("serialized differently:\n%s\n\n%s", s, again)
+		return false
+	}
+
+	return true
+}
+
+// equalValues reports whether a and b are the same value, comparing tables by
+// their contents and numbers by their bits
+func equalValues(a, b lua.LValue) bool {
+	switch a := a.(type) {
+	case *lua.LTable:
+		b, ok := b.(*lua.LTable)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+
+		equal := true
+		count := 0
+		a.ForEach(func(key, value lua.LValue) {
+			count++
+			equal = equal && equalValues(value, b.RawGet(key))
+		})
+		b.ForEach(func(lua.LValue, lua.LValue) { count-- })
+
+		return equal && count == 0
+	case lua.LNumber:
+		b, ok := b.(lua.LNumber)
+		return ok && math.Float64bits(float64(a)) == math.Float64bits(float64(b))
+	default:
+		return a == b
+	}
+}
+
+// randomTable is a nested table with random keys and values which can be
+// serialized
+type randomTable struct {
+	*lua.LTable
+}
+
+// Generate implements quick.Generator
+func (randomTable) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(randomTable{newRandomTable(r, size, 3)})
+}
+
+// newRandomTable returns a table of up to size entries with tables nested up
+// to depth levels
+func newRandomTable(r *rand.Rand, size, depth int) *lua.LTable {
+	tbl := &lua.LTable{}
+
+	for i := r.Intn(size + 1); i > 0; i-- {
+		var key lua.LValue
+		if r.Intn(2) == 0 {
+			key = randomNumber(r)
+		} else {
+			key = randomString(r)
+		}
+
+		var value lua.LValue
+		switch r.Intn(5) {
+		case 0:
+			value = randomNumber(r)
+		case 1:
+			value = randomString(r)
+		case 2:
+			value = lua.LBool(r.Intn(2) == 0)
+		case 3:
+			if depth > 0 {
+				value = newRandomTable(r, size/2, depth-1)
+				break
+			}
+			fallthrough
+		default:
+			value = lua.LString(fmt.Sprint(r.Int()))
+		}
+
+		tbl.RawSet(key, value)
+	}
+
+	return tbl
+}
+
+// randomNumber returns a small integer, a large integer, or any finite float
+func randomNumber(r *rand.Rand) lua.LNumber {
+	switch r.Intn(3) {
+	case 0:
+		return lua.LNumber(r.Intn(100) + 1)
+	case 1:
+		return lua.LNumber(r.Int63() - r.Int63())
+	default:
+		for {
+			f := math.Float64frombits(r.Uint64())
+			if !math.IsNaN(f) && !math.IsInf(f, 0) && f != 0 {
+				return lua.LNumber(f)
+			}
+		}
+	}
+}
+
+// randomString returns a string of random bytes, including control characters
+// and invalid UTF-8
+func randomString(r *rand.Rand) lua.LString {
+	b := make([]byte, r.Intn(16))
+	for i := range b {
+		b[i] = byte(r.Intn(256))
+	}
+	return lua.LString(b)
+}
@@ -0,0 +1,157 @@
+package miz
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/evogelsa/DCS-real-weather/v2/config"
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+	"github.com/evogelsa/DCS-real-weather/v2/util"
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+const (
+	// neutralStability is the wind profile exponent of a neutral atmosphere
+	neutralStability = 0.143
+
+	// turbulenceHeight is the height in meters of the reported wind
+	turbulenceHeight = 10
+)
+
+// turbulence is the ground turbulence and each of its components in m/s
+type turbulence struct {
+	gust       float64 // from gusts above the mean wind
+	mechanical float64 // from the mean wind over the terrain
+	convective float64 // from showers and thunderstorms
+	total      float64
+}
+
+// turbulenceLimits are the limits and parameters of each component of the
+// turbulence model
+type turbulenceLimits struct {
+	gustFactor        float64
+	gustMaximum       float64
+	windMaximum       float64
+	shower            float64
+	storm             float64
+	convectiveMaximum float64
+	minimum           float64
+	maximum           float64
+}
+
+// updateTurbulence applies ground turbulence to the mission from the reported
+// gust and ground wind in m/s after scaling, and the reported weather. The gust
+// is only limited by the gust maximum of the turbulence, not the wind limits
+func updateTurbulence(data *weather.WeatherData, speedGround, gust float64, l *lua.LState) error {
+	cfg := config.Get().Options.Weather.Wind
+	limits := turbulenceLimits{
+		gustFactor:        cfg.Turbulence.GustFactor,
+		gustMaximum:       cfg.Turbulence.GustMaximum,
+		windMaximum:       cfg.Turbulence.WindMaximum,
+		shower:            cfg.Turbulence.Shower,
+		storm:             cfg.Turbulence.Storm,
+		convectiveMaximum: cfg.Turbulence.ConvectiveMaximum,
+		minimum:           cfg.Turbulence.Minimum,
+		maximum:           cfg.Turbulence.Maximum,
+	}
+
+	roughness := cfg.Turbulence.Roughness
+	if r, ok := cfg.Turbulence.StationRoughness[strings.ToUpper(data.Data[0].ICAO)]; ok {
+		roughness = r
+	}
+
+	t := modelTurbulence(
+		speedGround,
+		gust,
+		cfg.Stability,
+		roughness,
+		checkStorms(data),
+		checkShowers(data),
+		limits,
+	)
+
+	if err := l.DoString(
+		// convert to ED gust units (whatever those are?)
+		fmt.Sprintf("mission.weather.groundTurbulence = %0.4f\n", t.total*weather.MPSToEDUnits),
+	); err != nil {
+		return fmt.Errorf("error updating turbulence: %v", err)
+	}
+
+	logger.Infow(
+		"turbulence:",
+		"mps", t.total,
+		"kt", t.total*weather.MPSToKt,
+		"gust-mps", t.gust,
+		"wind-mps", t.mechanical,
+		"convective-mps", t.convective,
+		"roughness-meters", roughness,
+	)
+
+	return nil
+}
+
+// modelTurbulence combines the turbulence from the gust spread, the mean wind,
+// and convection. The wind component is the turbulence intensity of the mean
+// wind over terrain with the given roughness length in meters, which is
+// stronger in an unstable atmosphere and weaker in a stable one. Components
+// are independent so they are combined as the root sum of squares
+func modelTurbulence(
+	speed, gust, stability, roughness float64,
+	storms, showers bool,
+	limits turbulenceLimits,
+) turbulence {
+	var t turbulence
+
+	// only the gust above the mean wind is turbulent
+	if gust > speed {
+		t.gust = (gust - speed) * limits.gustFactor
+	}
+	t.gust = util.Clamp(t.gust, 0, limits.gustMaximum)
+
+	// turbulence intensity of a neutral atmosphere, 1 / ln(z / z0)
+	roughness = util.Clamp(roughness, 0.0001, turbulenceHeight/2)
+	intensity := 1 / math.Log(turbulenceHeight/roughness)
+
+	// more stable air has a higher exponent and less turbulence
+	if stability > 0 {
+		intensity *= util.Clamp(neutralStability/stability, 0.5, 2)
+	}
+	t.mechanical = util.Clamp(speed*intensity, 0, limits.windMaximum)
+
+	switch {
+	case storms:
+		t.convective = limits.storm
+	case showers:
+		t.convective = limits.shower
+	}
+	t.convective = util.Clamp(t.convective, 0, limits.convectiveMaximum)
+
+	t.total = math.Sqrt(t.gust*t.gust + t.mechanical*t.mechanical + t.convective*t.convective)
+	t.total = util.Clamp(t.total, limits.minimum, limits.maximum)
+
+	return t
+}
+
+// checkStorms returns whether thunderstorms are reported, e.g. TSRA or VCTS.
+// Heavy snow is not convective, so unlike checkPrecip it is not a storm
+func checkStorms(data *weather.WeatherData) bool {
+	for _, condition := range data.Data[0].Conditions {
+		if strings.Contains(condition.Code, "TS") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkShowers returns whether showers are reported, e.g. SHRA or VCSH
+func checkShowers(data *weather.WeatherData) bool {
+	for _, condition := range data.Data[0].Conditions {
+		if strings.Contains(condition.Code, "SH") {
+			return true
+		}
+	}
+	return false
+}
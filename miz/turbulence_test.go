@@ -0,0 +1,104 @@
+package miz
+
+import (
+	"math"
+	"testing"
+
+	"github.com/evogelsa/DCS-real-weather/v2/weather"
+)
+
+// TestModelTurbulence checks each component of the turbulence model
+func TestModelTurbulence(t *testing.T) {
+	limits := turbulenceLimits{
+		gustFactor:        1,
+		gustMaximum:       15,
+		windMaximum:       5,
+		shower:            2,
+		storm:             6,
+		convectiveMaximum: 8,
+		minimum:           0,
+		maximum:           50,
+	}
+
+	// calm
+	calm := modelTurbulence(0, 0, 0.143, 0.03, false, false, limits)
+	if calm.total != 0 {
+		t.Errorf("got %f, expected no turbulence when calm", calm.total)
+	}
+
+	// gusts equal to the mean wind are not turbulent
+	steady := modelTurbulence(10, 10, 0.143, 0.03, false, false, limits)
+	if steady.gust != 0 {
+		t.Errorf("got gust component %f, expected 0", steady.gust)
+	}
+	if steady.mechanical <= 0 {
+		t.Errorf("got wind component %f, expected >0", steady.mechanical)
+	}
+
+	// only the gust above the mean wind is turbulent
+	gusty := modelTurbulence(10, 18, 0.143, 0.03, false, false, limits)
+	if gusty.gust != 8 {
+		t.Errorf("got gust component %f, expected 8", gusty.gust)
+	}
+	want := math.Sqrt(gusty.gust*gusty.gust + gusty.mechanical*gusty.mechanical)
+	if math.Abs(gusty.total-want) > 1e-9 {
+		t.Errorf("got total %f, expected %f", gusty.total, want)
+	}
+
+	// rougher terrain and less stable air are more turbulent
+	rough := modelTurbulence(10, 10, 0.143, 0.5, false, false, limits)
+	if rough.mechanical <= steady.mechanical {
+		t.Errorf("got %f over rough terrain, expected more than %f", rough.mechanical, steady.mechanical)
+	}
+	stable := modelTurbulence(10, 10, 0.3, 0.03, false, false, limits)
+	unstable := modelTurbulence(10, 10, 0.1, 0.03, false, false, limits)
+	if !(unstable.mechanical > steady.mechanical && steady.mechanical > stable.mechanical) {
+		t.Errorf(
+			"got %f unstable, %f neutral, %f stable, expected decreasing turbulence",
+			unstable.mechanical, steady.mechanical, stable.mechanical,
+		)
+	}
+
+	// convection
+	tests := []struct {
+		conditions []weather.Conditions
+		celsius    float64
+		want       float64
+	}{
+		{nil, 10, 0},
+		{[]weather.Conditions{{Code: "RA"}}, 10, 0},
+		{[]weather.Conditions{{Prefix: "-", Code: "SHRA"}}, 10, 2},
+		{[]weather.Conditions{{Code: "TSRA"}}, 20, 6},
+		{[]weather.Conditions{{Code: "TSSN"}, {Code: "SHSN"}}, -2, 6},
+		// heavy snow is a snowstorm in DCS but is not convective
+		{[]weather.Conditions{{Prefix: "+", Code: "SN"}}, -10, 0},
+		{[]weather.Conditions{{Prefix: "+", Code: "SHSN"}}, -10, 2},
+	}
+	for _, test := range tests {
+		data := &weather.WeatherData{
+			Data: []weather.Data{{
+				Conditions:  test.conditions,
+				Temperature: &weather.Temperature{Celsius: test.celsius},
+			}},
+			NumResults: 1,
+		}
+
+		got := modelTurbulence(0, 0, 0.143, 0.03, checkStorms(data), checkShowers(data), limits)
+		if got.convective != test.want {
+			t.Errorf(
+				"got %f for %v at %.0f C, expected %f",
+				got.convective, test.conditions, test.celsius, test.want,
+			)
+		}
+	}
+
+	// components and total are limited
+	limits.maximum = 10
+	strong := modelTurbulence(40, 80, 0.05, 2, true, false, limits)
+	if strong.gust != limits.gustMaximum || strong.mechanical != limits.windMaximum {
+		t.Errorf("got components %f and %f, expected limits", strong.gust, strong.mechanical)
+	}
+	if strong.total != limits.maximum {
+		t.Errorf("got total %f, expected %f", strong.total, limits.maximum)
+	}
+}
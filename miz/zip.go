@@ -2,173 +2,395 @@ package miz
 
 import (
 	"archive/zip"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
 
 	"github.com/evogelsa/DCS-real-weather/v2/config"
 	"github.com/evogelsa/DCS-real-weather/v2/logger"
 )
 
-// Unzip will decompress a zip archive, moving all files and folders
-// within the zip file to dest, taken from https://golangcode.com/unzip-files-in-go/
-func Unzip() ([]string, error) {
-	logger.Infoln("unpacking mission file...")
+// legacyUnpacked is the directory missions were unpacked to by earlier
+// versions
+const legacyUnpacked = "mission_unpacked"
+
+// archive is the mission file being updated. Entries are read from the mission
+// file when needed, and only the entries that are changed are kept in memory
+type archive struct {
+	r       *zip.ReadCloser
+	files   map[string]*zip.File
+	changed map[string][]byte
+	added   []string // changed entries not in the mission file
+}
+
+// current is the open mission
+var current *archive
 
-	src := config.Get().RealWeather.Mission.Input
+// Open opens the src mission so it can be loaded and updated. The mission must
+// be closed with Close when done
+func Open(src string) error {
+	logger.Infoln("opening mission file...")
 	logger.Infoln("source file:", src)
-	dest := "mission_unpacked"
 
-	var filenames []string
+	Close()
 
 	r, err := zip.OpenReader(src)
 	if err != nil {
-		return filenames, err
+		return err
 	}
-	defer r.Close()
 
+	a := &archive{
+		r:       r,
+		files:   make(map[string]*zip.File, len(r.File)),
+		changed: make(map[string][]byte),
+	}
 	for _, f := range r.File {
+		a.files[f.Name] = f
+		logger.Debugf("found: %s", f.Name)
+	}
+	current = a
 
-		// Store filename/path for returning and using later on
-		fpath := filepath.Join(dest, f.Name)
+	logger.Infof("opened mission file with %d entries", len(r.File))
 
-		// Check for ZipSlip. More Info: http://bit.ly/2MsjAWE
-		if !strings.HasPrefix(
-			fpath,
-			filepath.Clean(dest)+string(os.PathSeparator),
-		) {
-			return filenames, fmt.Errorf("%s: illegal file path", fpath)
-		}
+	return nil
+}
 
-		filenames = append(filenames, fpath)
+// Close closes the open mission, discarding any changes not written by Zip
+func Close() {
+	if current == nil {
+		return
+	}
 
-		if f.FileInfo().IsDir() {
-			// Make Folder
-			err := os.MkdirAll(fpath, os.ModePerm)
-			if err != nil {
-				return filenames, err
-			}
-			continue
-		}
+	if current.r != nil {
+		current.r.Close()
+	}
+	current = nil
 
-		// Make File
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return filenames, err
-		}
+	logger.Infoln("closed mission file")
+}
 
-		outFile, err := os.OpenFile(
-			fpath,
-			os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-			f.Mode(),
-		)
-		if err != nil {
-			return filenames, err
-		}
+// readEntry returns the contents of the named entry of the open mission,
+// including any changes
+func readEntry(name string) ([]byte, error) {
+	if current == nil {
+		return nil, fmt.Errorf("no mission open")
+	}
 
-		rc, err := f.Open()
-		if err != nil {
-			return filenames, err
-		}
+	if b, ok := current.changed[name]; ok {
+		return b, nil
+	}
 
-		_, err = io.Copy(outFile, rc)
+	f, ok := current.files[name]
+	if !ok {
+		return nil, fmt.Errorf("mission has no %s: %w", name, fs.ErrNotExist)
+	}
 
-		// Close the file without defer to close before next iteration of loop
-		outFile.Close()
-		rc.Close()
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", name, err)
+	}
+	defer rc.Close()
 
-		if err != nil {
-			return filenames, err
-		}
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", name, err)
+	}
+
+	return b, nil
+}
+
+// writeEntry replaces the contents of the named entry of the open mission. The
+// change is written to the mission file by Zip
+func writeEntry(name string, b []byte) error {
+	if current == nil {
+		return fmt.Errorf("no mission open")
 	}
 
-	logger.Infoln("unpacked mission file")
-	for _, fn := range filenames {
-		logger.Debugf("unzipped: %s", fn)
+	if _, ok := current.files[name]; !ok && !slices.Contains(current.added, name) {
+		current.added = append(current.added, name)
 	}
+	current.changed[name] = b
 
-	return filenames, nil
+	return nil
+}
+
+// doEntry runs the named entry of the open mission in state
+func doEntry(state *lua.LState, name string) error {
+	b, err := readEntry(name)
+	if err != nil {
+		return err
+	}
+
+	fn, err := state.Load(bytes.NewReader(b), name)
+	if err != nil {
+		return err
+	}
+
+	state.Push(fn)
+	return state.PCall(0, lua.MultRet, nil)
 }
 
-// Zip takes the unpacked mission and recreates the mission file
-// taken from https://golangcode.com/create-zip-files-in-go/
-func Zip() error {
+const (
+	// backupTime is the format of the time in the name of a backup
+	backupTime = "20060102T150405.000Z"
+
+	// backupParseTime parses backup times with or without the milliseconds,
+	// which backups made by earlier versions do not have
+	backupParseTime = "20060102T150405Z"
+)
+
+// Zip writes the open mission with its changes to dest, then closes it. The
+// mission is written to a temporary file next to dest which replaces dest
+// once it is complete, so dest is never left partly written and may be the
+// mission being updated. If backups are enabled, the previous dest is kept as
+// a timestamped backup
+func Zip(dest string) error {
 	logger.Infoln("repacking mission file...")
 
-	baseFolder := "mission_unpacked/"
+	if current == nil {
+		return fmt.Errorf("no mission open")
+	}
 
-	dest := config.Get().RealWeather.Mission.Output
-	outFile, err := os.Create(dest)
+	outFile, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("error creating output file: %v", err)
 	}
+
+	// remove the temporary file unless it replaced dest
+	tmp := outFile.Name()
+	defer os.Remove(tmp)
 	defer outFile.Close()
 
 	w := zip.NewWriter(outFile)
 
-	addFiles(w, baseFolder, "")
+	if err := current.write(w); err != nil {
+		return fmt.Errorf("error adding files to output file: %v", err)
+	}
 
 	err = w.Close()
 	if err != nil {
 		return fmt.Errorf("error closing output file: %v", err)
 	}
 
+	// keep the permissions of the mission being replaced
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(dest); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := outFile.Chmod(mode); err != nil {
+		logger.Warnf("unable to set permissions of output file: %v", err)
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("error closing output file: %v", err)
+	}
+
+	// the mission is closed first so it can be replaced if it is dest
+	Close()
+
+	if backups := config.Get().RealWeather.Mission.Backups; backups > 0 {
+		if err := backup(dest, backups, time.Now()); err != nil {
+			return fmt.Errorf("error backing up %s: %v", dest, err)
+		}
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("error replacing output file: %v", err)
+	}
+
+	// the rename is only durable once the directory is written
+	if err := syncDir(filepath.Dir(dest)); err != nil {
+		logger.Warnf("unable to sync output directory: %v", err)
+	}
+
 	logger.Infoln("repacked mission file")
 
 	return nil
 }
 
-// Clean will remove the unpacked mission from directory
-func Clean() {
-	directory := "mission_unpacked/"
-	os.RemoveAll(directory)
-	logger.Infoln("removed unpacked mission")
+// write writes every entry of the mission to w in their original order,
+// followed by any new entries. Only changed entries are compressed again,
+// the rest are copied exactly as they are in the mission file
+func (a *archive) write(w *zip.Writer) error {
+	for _, f := range a.r.File {
+		if b, ok := a.changed[f.Name]; ok {
+			if err := writeChanged(w, f.FileHeader, b); err != nil {
+				return err
+			}
+			logger.Debugf("zipped changed: %s", f.Name)
+			continue
+		}
+
+		// copies the compressed data with its header, keeping the method,
+		// crc, and times
+		if err := w.Copy(f); err != nil {
+			return fmt.Errorf("error copying %v: %v", f.Name, err)
+		}
+		logger.Debugf("copied: %s", f.Name)
+	}
+
+	for _, name := range a.added {
+		header := zip.FileHeader{Name: name, Method: zip.Deflate}
+		if err := writeChanged(w, header, a.changed[name]); err != nil {
+			return err
+		}
+		logger.Debugf("zipped new: %s", name)
+	}
+
+	return nil
 }
 
-// addFiles handles adding each file in directory to zip archive
-// taken from https://golangcode.com/create-zip-files-in-go/
-func addFiles(w *zip.Writer, basePath, baseInZip string) error {
-	files, err := os.ReadDir(basePath)
+// writeChanged writes an entry with the header and new contents b. Entries
+// that were stored uncompressed stay uncompressed
+func writeChanged(w *zip.Writer, header zip.FileHeader, b []byte) error {
+	if header.Method != zip.Store {
+		header.Method = zip.Deflate
+	}
+	header.Modified = time.Now()
+
+	// extra fields hold the old sizes and times
+	header.Extra = nil
+
+	f, err := w.CreateHeader(&header)
 	if err != nil {
-		return fmt.Errorf("error reading directory %v: %v", basePath, err)
-	}
-
-	for _, file := range files {
-		logger.Debugf("zipped: %s", basePath+file.Name())
-		if !file.IsDir() {
-			dat, err := os.ReadFile(basePath + file.Name())
-			if err != nil {
-				return fmt.Errorf(
-					"error reading file %v: %v",
-					basePath+file.Name(),
-					err,
-				)
-			}
+		return fmt.Errorf("error creating file %v: %v", header.Name, err)
+	}
 
-			// Add some files to the archive.
-			f, err := w.Create(baseInZip + file.Name())
-			if err != nil {
-				return fmt.Errorf(
-					"error creating file %v: %v",
-					baseInZip+file.Name(),
-					err,
-				)
-			}
+	if _, err := f.Write(b); err != nil {
+		return fmt.Errorf("error writing %v: %v", header.Name, err)
+	}
 
-			_, err = f.Write(dat)
-			if err != nil {
-				return fmt.Errorf("error writing data: %v", err)
-			}
+	return nil
+}
 
-		} else if file.IsDir() {
-			newBase := basePath + file.Name() + "/"
-			err := addFiles(w, newBase, baseInZip+file.Name()+"/")
-			if err != nil {
-				return fmt.Errorf("error adding files from %v: %v", baseInZip+file.Name()+"/", err)
-			}
+// syncDir flushes the entries of dir to disk so files renamed into it are not
+// lost. Directories cannot be synced on windows, where renames are already
+// written through
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// backup copies path to a backup named with the time t, then removes the
+// oldest backups of path so only keep remain. If a backup with the same time
+// exists, the next free millisecond is used. Nothing is done if path does not
+// exist
+func backup(path string, keep int, t time.Time) error {
+	src, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var name string
+	var dst *os.File
+	for t = t.UTC(); ; t = t.Add(time.Millisecond) {
+		name = fmt.Sprintf("%s.%s.bak", path, t.Format(backupTime))
+		dst, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	logger.Infof("backed up %s to %s", path, name)
+
+	// backups of path are the files in its directory named like the backup
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	type backupFile struct {
+		path string
+		made time.Time
+	}
+
+	var backups []backupFile
+	prefix := filepath.Base(path) + "."
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, ".bak")
+		if !ok {
+			continue
+		}
+		made, err := time.Parse(backupParseTime, stamp)
+		if err != nil {
+			continue
 		}
+		backups = append(backups, backupFile{filepath.Join(filepath.Dir(path), entry.Name()), made})
+	}
+
+	// names with and without milliseconds do not sort by time
+	slices.SortFunc(backups, func(a, b backupFile) int {
+		return a.made.Compare(b.made)
+	})
+	for len(backups) > keep {
+		if err := os.Remove(backups[0].path); err != nil {
+			return err
+		}
+		logger.Infof("removed old backup %s", backups[0].path)
+		backups = backups[1:]
 	}
 
 	return nil
 }
+
+// RemoveUnpacked removes the directory missions were unpacked to by earlier
+// versions, which could be left behind if they were interrupted
+func RemoveUnpacked() {
+	if _, err := os.Stat(legacyUnpacked); err != nil {
+		return
+	}
+
+	if err := os.RemoveAll(legacyUnpacked); err != nil {
+		logger.Errorf("unable to remove %s: %v", legacyUnpacked, err)
+		return
+	}
+
+	logger.Infof("removed %s left by an earlier version", legacyUnpacked)
+}
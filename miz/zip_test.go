@@ -0,0 +1,280 @@
+package miz
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestZip checks changed entries are written with the rest of the mission in
+// their original order, and the mission can be written over itself in one step
+func TestZip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mission.miz")
+
+	entries := []struct {
+		name, content string
+	}{
+		{"mission", "mission = {}"},
+		{"l10n/", ""},
+		{"l10n/DEFAULT/dictionary", "dictionary = {}"},
+		{"l10n/DEFAULT/radio.ogg", "sound"},
+		{"options", "options = {}"},
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(out)
+	for _, entry := range entries {
+		f, err := w.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	if err := Open(path); err != nil {
+		t.Fatalf("error opening mission: %v", err)
+	}
+	defer Close()
+
+	if err := writeEntry("mission", []byte("mission = { updated = true }")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEntry("l10n/RU/dictionary", []byte("dictionary = {}")); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes are read back before they are written
+	if b, err := readEntry("mission"); err != nil || string(b) != "mission = { updated = true }" {
+		t.Errorf("got %q, %v reading changed mission", b, err)
+	}
+	if _, err := readEntry("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v reading missing entry, expected not exist", err)
+	}
+
+	if err := Zip(path); err != nil {
+		t.Fatalf("error zipping mission: %v", err)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("error opening zipped mission: %v", err)
+	}
+	defer r.Close()
+
+	entries[0].content = "mission = { updated = true }"
+	entries = append(entries, struct{ name, content string }{"l10n/RU/dictionary", "dictionary = {}"})
+
+	if len(r.File) != len(entries) {
+		t.Fatalf("got %d entries, expected %d", len(r.File), len(entries))
+	}
+	for i, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+
+		if f.Name != entries[i].name || string(b) != entries[i].content {
+			t.Errorf("got %s with %q, expected %s with %q", f.Name, b, entries[i].name, entries[i].content)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files next to the mission, expected only the mission", len(files))
+	}
+
+	// the mission is closed once written
+	if err := writeEntry("mission", nil); err == nil {
+		t.Errorf("expected error changing mission after it was written")
+	}
+}
+
+// TestZipCopiesUnchanged checks unchanged entries are copied byte for byte
+// with their headers, and only the changed entry is compressed again
+func TestZipCopiesUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "mission.miz")
+	dest := filepath.Join(dir, "realweather.miz")
+
+	modified := time.Date(2023, time.June, 1, 8, 30, 0, 0, time.UTC)
+	headers := []zip.FileHeader{
+		{Name: "KNEEBOARD/IMAGES/map.png", Method: zip.Deflate, Modified: modified},
+		{Name: "mission", Method: zip.Deflate, Modified: modified},
+		{Name: "l10n/DEFAULT/radio.ogg", Method: zip.Store, Modified: modified},
+		{Name: "l10n/DEFAULT/script.lua", Method: zip.Deflate, Modified: modified},
+	}
+
+	out, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(out)
+	for i := range headers {
+		f, err := w.CreateHeader(&headers[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(strings.Repeat(headers[i].Name, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	if err := Open(src); err != nil {
+		t.Fatalf("error opening mission: %v", err)
+	}
+	defer Close()
+
+	if err := writeEntry("mission", []byte("mission = {}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Zip(dest); err != nil {
+		t.Fatalf("error zipping mission: %v", err)
+	}
+
+	before, err := zip.OpenReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer before.Close()
+
+	after, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer after.Close()
+
+	if len(after.File) != len(before.File) {
+		t.Fatalf("got %d entries, expected %d", len(after.File), len(before.File))
+	}
+
+	raw := func(f *zip.File) []byte {
+		r, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	for i, a := range after.File {
+		b := before.File[i]
+		if a.Name != b.Name {
+			t.Errorf("got %s at %d, expected %s", a.Name, i, b.Name)
+			continue
+		}
+
+		if a.Name == "mission" {
+			if a.Method != zip.Deflate || a.CRC32 == b.CRC32 {
+				t.Errorf("got method %d crc %x for changed mission", a.Method, a.CRC32)
+			}
+			continue
+		}
+
+		if a.Method != b.Method || a.CRC32 != b.CRC32 || !a.Modified.Equal(b.Modified) {
+			t.Errorf(
+				"got %s with method %d crc %x modified %s, expected %d %x %s",
+				a.Name, a.Method, a.CRC32, a.Modified, b.Method, b.CRC32, b.Modified,
+			)
+		}
+		if !bytes.Equal(raw(a), raw(b)) {
+			t.Errorf("compressed data of %s changed", a.Name)
+		}
+	}
+}
+
+// TestBackup checks backups are made without replacing each other and only
+// the newest are kept, including backups named by earlier versions
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mission.miz")
+
+	// nothing to back up yet
+	start := time.Date(2024, time.April, 13, 12, 0, 0, 0, time.UTC)
+	if err := backup(path, 2, start); err != nil {
+		t.Fatalf("error backing up missing mission: %v", err)
+	}
+
+	// unrelated files are left alone, and a backup without milliseconds from
+	// an earlier version is the oldest
+	for _, name := range []string{
+		"mission.miz.notes.bak",
+		"other.miz.20240413T110000Z.bak",
+		"mission.miz.20240413T120000Z.bak",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last two backups are made within the same millisecond
+	times := []time.Time{
+		start,
+		start.Add(time.Hour),
+		start.Add(2 * time.Hour),
+		start.Add(2*time.Hour + time.Microsecond),
+	}
+	for i, at := range times {
+		if err := os.WriteFile(path, []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := backup(path, 3, at); err != nil {
+			t.Fatalf("error backing up mission: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	want := []string{
+		"mission.miz",
+		"mission.miz.20240413T130000.000Z.bak",
+		"mission.miz.20240413T140000.000Z.bak",
+		"mission.miz.20240413T140000.001Z.bak",
+		"mission.miz.notes.bak",
+		"other.miz.20240413T110000Z.bak",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("got %v, expected %v", names, want)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "mission.miz.20240413T140000.001Z.bak"))
+	if err != nil || len(b) != 1 || b[0] != 3 {
+		t.Errorf("got backup %v, expected the latest mission", b)
+	}
+}
@@ -0,0 +1,149 @@
+// Package theatre converts between DCS mission coordinates and latitude and
+// longitude. Each DCS theatre uses a transverse mercator projection of the
+// WGS84 ellipsoid with its own central meridian and false origin. Mission x
+// is the northing and mission z (y in the mission file) is the easting
+package theatre
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// WGS84 ellipsoid
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+	scaleFactor   = 0.9996
+
+	degToRad = math.Pi / 180
+	radToDeg = 180 / math.Pi
+)
+
+var (
+	eccentricity2       = flattening * (2 - flattening)
+	secondEccentricity2 = eccentricity2 / (1 - eccentricity2)
+)
+
+// LocationSource is where the location of a mission is taken from
+type LocationSource string
+
+const (
+	LocationConfig   LocationSource = "config"   // configured latitude and longitude
+	LocationBullseye LocationSource = "bullseye" // blue bullseye
+	LocationUnits    LocationSource = "units"    // center of all unit groups
+	LocationAirbase  LocationSource = "airbase"  // airbase most aircraft start from
+)
+
+// Theatre describes the projection used by a DCS theatre
+type Theatre struct {
+	Name            string
+	CentralMeridian float64 // degrees
+	FalseEasting    float64 // meters
+	FalseNorthing   float64 // meters
+}
+
+// theatres maps the value of mission.theatre to its projection
+var theatres = map[string]Theatre{
+	"Afghanistan":        {"Afghanistan", 63, -300149.9999999864, -3759657.000000049},
+	"Caucasus":           {"Caucasus", 33, -99516.9999999732, -4998114.999999984},
+	"Falklands":          {"Falklands", -57, 147639.99999997593, 5815417.000000032},
+	"GermanyCW":          {"GermanyCW", 21, 35427.619999985734, -6061633.128000011},
+	"Iraq":               {"Iraq", 45, 72290.00000004497, -3680057.0000000005},
+	"Kola":               {"Kola", 21, -62702.00000000087, -7543625.999999979},
+	"MarianaIslands":     {"MarianaIslands", 147, 238417.99999989968, -1491840.000000048},
+	"MarianaIslandsWWII": {"MarianaIslandsWWII", 147, 238417.99999989968, -1491840.000000048},
+	"Nevada":             {"Nevada", -117, -193996.80999964548, -4410028.063999966},
+	"Normandy":           {"Normandy", -3, -195526.00000000204, -5484812.999999951},
+	"PersianGulf":        {"PersianGulf", 57, 75755.99999999645, -2894933.0000000377},
+	"SinaiMap":           {"SinaiMap", 33, 169221.9999999585, -3325312.9999999693},
+	"Syria":              {"Syria", 39, 282801.00000003993, -3879865.9999999935},
+	"TheChannel":         {"TheChannel", 3, 99376.00000000288, -5636889.00000001},
+}
+
+// Get returns the theatre with the given name as found in mission.theatre
+func Get(name string) (Theatre, error) {
+	t, ok := theatres[name]
+	if !ok {
+		return Theatre{}, fmt.Errorf("unsupported theatre \"%s\"", name)
+	}
+	return t, nil
+}
+
+// Names returns the names of all supported theatres in sorted order
+func Names() []string {
+	names := make([]string, 0, len(theatres))
+	for name := range theatres {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ToLatLon converts mission x and z coordinates to latitude and longitude in
+// degrees
+func (t Theatre) ToLatLon(x, z float64) (latitude, longitude float64) {
+	e2 := eccentricity2
+	ep2 := secondEccentricity2
+
+	easting := z - t.FalseEasting
+	northing := x - t.FalseNorthing
+
+	// footpoint latitude
+	m := northing / scaleFactor
+	mu := m / (semiMajorAxis * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	phi1 := mu +
+		(3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sin1, cos1, tan1 := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	c1 := ep2 * cos1 * cos1
+	t1 := tan1 * tan1
+	n1 := semiMajorAxis / math.Sqrt(1-e2*sin1*sin1)
+	r1 := semiMajorAxis * (1 - e2) / math.Pow(1-e2*sin1*sin1, 1.5)
+	d := easting / (n1 * scaleFactor)
+
+	phi := phi1 - (n1*tan1/r1)*(d*d/2-
+		(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+
+	lambda := (d -
+		(1+2*t1+c1)*math.Pow(d, 3)/6 +
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120) / cos1
+
+	return phi * radToDeg, t.CentralMeridian + lambda*radToDeg
+}
+
+// FromLatLon converts latitude and longitude in degrees to mission x and z
+// coordinates
+func (t Theatre) FromLatLon(latitude, longitude float64) (x, z float64) {
+	e2 := eccentricity2
+	ep2 := secondEccentricity2
+
+	phi := latitude * degToRad
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+
+	n := semiMajorAxis / math.Sqrt(1-e2*sin*sin)
+	tt := tan * tan
+	c := ep2 * cos * cos
+	a := (longitude - t.CentralMeridian) * degToRad * cos
+
+	// meridional arc length from the equator
+	m := semiMajorAxis * ((1-e2/4-3*e2*e2/64-5*e2*e2*e2/256)*phi -
+		(3*e2/8+3*e2*e2/32+45*e2*e2*e2/1024)*math.Sin(2*phi) +
+		(15*e2*e2/256+45*e2*e2*e2/1024)*math.Sin(4*phi) -
+		(35*e2*e2*e2/3072)*math.Sin(6*phi))
+
+	easting := scaleFactor * n * (a +
+		(1-tt+c)*math.Pow(a, 3)/6 +
+		(5-18*tt+tt*tt+72*c-58*ep2)*math.Pow(a, 5)/120)
+
+	northing := scaleFactor * (m + n*tan*(a*a/2+
+		(5-tt+9*c+4*c*c)*math.Pow(a, 4)/24+
+		(61-58*tt+tt*tt+600*c-330*ep2)*math.Pow(a, 6)/720))
+
+	return northing + t.FalseNorthing, easting + t.FalseEasting
+}
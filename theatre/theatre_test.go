@@ -0,0 +1,39 @@
+package theatre
+
+import (
+	"math"
+	"testing"
+)
+
+// TestProjection checks known mission coordinates and that every theatre
+// converts back to within a couple meters of the same location
+func TestProjection(t *testing.T) {
+	caucasus, err := Get("Caucasus")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Kutaisi airbase in the Caucasus mission editor
+	lat, lon := caucasus.ToLatLon(-284860, 683839)
+	if math.Abs(lat-42.1767) > 0.01 || math.Abs(lon-42.4826) > 0.01 {
+		t.Errorf("got %f, %f, expected 42.1767, 42.4826", lat, lon)
+	}
+
+	for _, name := range Names() {
+		th, _ := Get(name)
+
+		for _, x := range []float64{-300000, 0, 300000} {
+			for _, z := range []float64{-300000, 0, 300000} {
+				lat, lon := th.ToLatLon(x, z)
+				gotX, gotZ := th.FromLatLon(lat, lon)
+				if math.Abs(gotX-x) > 2 || math.Abs(gotZ-z) > 2 {
+					t.Errorf("%s: %f, %f converted back to %f, %f", name, x, z, gotX, gotZ)
+				}
+			}
+		}
+	}
+
+	if _, err := Get("Moon"); err == nil {
+		t.Errorf("expected error for unknown theatre")
+	}
+}
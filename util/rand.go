@@ -0,0 +1,25 @@
+package util
+
+import (
+	"math/rand"
+	"time"
+)
+
+// rng is the source of every random choice so that runs can be reproduced
+// from a seed. It is seeded from the time until Seed is called
+var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Seed reseeds the random number generator used by Intn and Float64
+func Seed(seed int64) {
+	rng = rand.New(rand.NewSource(seed))
+}
+
+// Intn returns a random int in [0, n). It panics if n <= 0
+func Intn(n int) int {
+	return rng.Intn(n)
+}
+
+// Float64 returns a random float64 in [0.0, 1.0)
+func Float64() float64 {
+	return rng.Float64()
+}
@@ -0,0 +1,345 @@
+package weather
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+var (
+	// NOAA cycle files have a timestamp line before each report
+	archiveNOAATimeRE = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2})$`)
+	// Ogimet exports prefix each report with a YYYYMMDDHHMM timestamp
+	archiveOgimetRE = regexp.MustCompile(`^(\d{12})\s+(.*)$`)
+)
+
+const (
+	// archiveWarnOffset is how far a report may be from the requested time
+	// before a warning is logged, about the time between routine reports
+	archiveWarnOffset = 90 * time.Minute
+
+	// archiveMaxOffset is how far a report may be from the requested time
+	// before it is rejected
+	archiveMaxOffset = 12 * time.Hour
+)
+
+// ArchiveSource describes where the archive provider finds past observations
+// and the time of the observation to find
+type ArchiveSource struct {
+	Path string
+	Time time.Time
+}
+
+// archive finds past observations in a local archive of METARs
+type archive struct {
+	config struct {
+		Enable bool   `toml:"enable"`
+		Path   string `toml:"path"`
+		Time   string `toml:"time"`
+	}
+	time time.Time
+}
+
+func init() {
+	Register(&archive{})
+}
+
+func (p *archive) Name() API {
+	return APIArchive
+}
+
+func (p *archive) Capabilities() Capability {
+	return CapSurface
+}
+
+func (p *archive) Configure(decode func(v any) error) error {
+	if err := decode(&p.config); err != nil {
+		return err
+	}
+
+	if !p.config.Enable {
+		return nil
+	}
+
+	if p.config.Path == "" {
+		return fmt.Errorf("archive enabled but missing path")
+	}
+
+	t, err := ParseArchiveTime(p.config.Time)
+	if err != nil {
+		return fmt.Errorf("archive enabled but time is invalid: %v", err)
+	}
+	p.time = t
+
+	return nil
+}
+
+func (p *archive) Enabled() bool {
+	return p.config.Enable
+}
+
+// Cacheable returns false since local files may change between runs
+func (p *archive) Cacheable() bool {
+	return false
+}
+
+func (p *archive) GetWeather(req Request) (WeatherData, error) {
+	return getWeatherArchive(req.ICAO, ArchiveSource{Path: p.config.Path, Time: p.time})
+}
+
+// archiveReport is a single raw observation found in the archive
+type archiveReport struct {
+	Time time.Time
+	Raw  string
+}
+
+// ParseArchiveTime parses the time of the observation to find in the archive.
+// Times are always UTC
+func ParseArchiveTime(s string) (time.Time, error) {
+	for _, layout := range []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse archive time \"%s\"", s)
+}
+
+// getWeatherArchive finds the observation for icao closest to the source time
+// in a local archive. The archive may be an Iowa Environmental Mesonet ASOS
+// CSV export, a file of raw METARs, or a directory of either
+func getWeatherArchive(icao string, source ArchiveSource) (WeatherData, error) {
+	logger.Infoln("getting weather from archive...")
+
+	info, err := os.Stat(source.Path)
+	if err != nil {
+		return WeatherData{}, fmt.Errorf("unable to read archive: %v", err)
+	}
+
+	var reports []archiveReport
+	if info.IsDir() {
+		err = filepath.WalkDir(source.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			r, err := readArchiveFile(path, icao, source.Time)
+			if err != nil {
+				logger.Warnf("skipping archive file %s: %v", path, err)
+				return nil
+			}
+			reports = append(reports, r...)
+
+			return nil
+		})
+	} else {
+		reports, err = readArchiveFile(source.Path, icao, source.Time)
+	}
+	if err != nil {
+		return WeatherData{}, fmt.Errorf("unable to read archive: %v", err)
+	}
+
+	if len(reports) == 0 {
+		return WeatherData{}, fmt.Errorf("no archived reports found for icao \"%s\"", icao)
+	}
+
+	// find report closest to requested time
+	closest := reports[0]
+	for _, r := range reports[1:] {
+		if absDuration(r.Time.Sub(source.Time)) < absDuration(closest.Time.Sub(source.Time)) {
+			closest = r
+		}
+	}
+
+	offset := absDuration(closest.Time.Sub(source.Time))
+	if offset > archiveMaxOffset {
+		return WeatherData{}, fmt.Errorf(
+			"closest archived report for icao \"%s\" is from %s, more than %s from %s",
+			icao,
+			closest.Time.Format(time.RFC3339),
+			archiveMaxOffset,
+			source.Time.Format(time.RFC3339),
+		)
+	} else if offset > archiveWarnOffset {
+		logger.Warnf(
+			"closest archived report is %s from the requested time",
+			offset,
+		)
+	}
+
+	logger.Infow(
+		"found archived report:",
+		"requested", source.Time.Format(time.RFC3339),
+		"observed", closest.Time.Format(time.RFC3339),
+		"metar", closest.Raw,
+	)
+	logger.Infoln("parsing weather...")
+
+	data, err := DecodeMETAR(closest.Raw, closest.Time)
+	if err != nil {
+		return WeatherData{}, fmt.Errorf("error decoding archived METAR: %v", err)
+	}
+
+	logger.Infoln("parsed weather")
+
+	return data, nil
+}
+
+// readArchiveFile reads all reports for icao from the given file. Reports
+// without a full timestamp are resolved against target
+func readArchiveFile(path, icao string, target time.Time) ([]archiveReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readArchiveCSV(f, icao)
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return readArchiveText(string(b), icao, target), nil
+}
+
+// readArchiveCSV reads an IEM ASOS CSV export, which must contain at least
+// the station, valid, and metar columns
+func readArchiveCSV(r io.Reader, icao string) ([]archiveReport, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read csv header: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"station", "valid", "metar"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv is missing column \"%s\"", name)
+		}
+	}
+
+	var reports []archiveReport
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(record) <= max(columns["station"], columns["valid"], columns["metar"]) {
+			continue
+		}
+
+		// IEM uses 3 letter identifiers for US stations
+		station := strings.ToUpper(record[columns["station"]])
+		if station != strings.ToUpper(icao) && "K"+station != strings.ToUpper(icao) {
+			continue
+		}
+
+		t, err := time.Parse("2006-01-02 15:04", record[columns["valid"]])
+		if err != nil {
+			logger.Debugf("skipping archive record with bad time: %v", err)
+			continue
+		}
+
+		raw := record[columns["metar"]]
+		if raw == "" || raw == "M" {
+			continue
+		}
+
+		reports = append(reports, archiveReport{Time: t, Raw: raw})
+	}
+
+	return reports, nil
+}
+
+// readArchiveText reads raw METARs from text. Timestamps are taken from NOAA
+// cycle file headers or Ogimet prefixes if present, otherwise they are
+// resolved from the METAR itself relative to target
+func readArchiveText(text, icao string, target time.Time) []archiveReport {
+	var reports []archiveReport
+	var stamp time.Time
+
+	for _, line := range SplitMETARs(text) {
+		if m := archiveNOAATimeRE.FindStringSubmatch(line); m != nil {
+			stamp, _ = time.Parse("2006/01/02 15:04", m[1])
+			continue
+		}
+
+		t := stamp
+		stamp = time.Time{}
+
+		raw := line
+		if m := archiveOgimetRE.FindStringSubmatch(line); m != nil {
+			t, _ = time.Parse("200601021504", m[1])
+			raw = m[2]
+		}
+
+		if !strings.EqualFold(archiveICAO(raw), icao) {
+			continue
+		}
+
+		if t.IsZero() {
+			wx, err := DecodeMETAR(raw, target)
+			if err != nil {
+				logger.Debugf("skipping archived report: %v", err)
+				continue
+			}
+			t, _ = time.Parse("2006-01-02T15:04:05", wx.Data[0].Observed)
+		}
+
+		reports = append(reports, archiveReport{Time: t, Raw: raw})
+	}
+
+	return reports
+}
+
+// archiveICAO returns the station identifier of a raw METAR
+func archiveICAO(raw string) string {
+	fields := strings.Fields(raw)
+	for len(fields) > 0 && (fields[0] == "METAR" || fields[0] == "SPECI") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
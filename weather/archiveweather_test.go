@@ -0,0 +1,65 @@
+package weather
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestGetWeatherArchive writes archives in each supported format and checks
+// the closest observation is found
+func TestGetWeatherArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"iem.csv": "station,valid,metar\n" +
+			"OKBK,1991-01-17 11:00,OKBK 171100Z 32010KT 9999 FEW030 12/02 Q1019\n" +
+			"OKBK,1991-01-17 12:00,OKBK 171200Z 33012KT 8000 SCT030 13/02 Q1018\n" +
+			"OKAS,1991-01-17 12:00,OKAS 171200Z 00000KT CAVOK 14/03 Q1018\n",
+		"noaa.txt": "1991/01/17 14:00\n" +
+			"OKBK 171400Z 34015KT 6000 BKN030 14/02 Q1017\n",
+		"ogimet.txt": "199101171300 METAR OKBK 171300Z 33014KT 7000 SCT025 14/02 Q1017=\n",
+		"raw.txt":    "OKBK 171000Z 31008KT 9999 SKC 10/01 Q1020\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		at       time.Time
+		observed string
+	}{
+		{time.Date(1991, time.January, 17, 9, 0, 0, 0, time.UTC), "1991-01-17T10:00:00"},
+		{time.Date(1991, time.January, 17, 12, 10, 0, 0, time.UTC), "1991-01-17T12:00:00"},
+		{time.Date(1991, time.January, 17, 12, 50, 0, 0, time.UTC), "1991-01-17T13:00:00"},
+		{time.Date(1991, time.January, 18, 0, 0, 0, 0, time.UTC), "1991-01-17T14:00:00"},
+	}
+
+	for _, test := range tests {
+		data, err := getWeatherArchive("OKBK", ArchiveSource{Path: dir, Time: test.at})
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.at, err)
+		}
+
+		if data.Data[0].Observed != test.observed {
+			t.Errorf("%v: got observation %s expected %s", test.at, data.Data[0].Observed, test.observed)
+		}
+	}
+
+	if _, err := getWeatherArchive("KJFK", ArchiveSource{Path: dir, Time: tests[0].at}); err == nil {
+		t.Errorf("expected error for station not in archive")
+	}
+
+	// reports far from the requested time are not used
+	for _, source := range []ArchiveSource{
+		{Path: dir, Time: time.Date(1991, time.January, 16, 12, 0, 0, 0, time.UTC)},
+		{Path: filepath.Join(dir, "iem.csv"), Time: time.Date(1992, time.January, 17, 12, 0, 0, 0, time.UTC)},
+	} {
+		if _, err := getWeatherArchive("OKBK", source); err == nil {
+			t.Errorf("%v: expected error for report too far from time", source.Time)
+		}
+	}
+}
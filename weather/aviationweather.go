@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +28,7 @@ type aviationWeatherData struct {
 	Latitude   *float64                `yaml:"lat,omitempty"`
 	Longitude  *float64                `yaml:"lon,omitempty"`
 	ReportTime *string                 `yaml:"reportTime,omitempty"`
+	RawTAF     *string                 `yaml:"rawTaf,omitempty"`
 }
 
 type aviationWeatherClouds struct {
@@ -35,6 +36,37 @@ type aviationWeatherClouds struct {
 	Base  *float64 `json:"base,omitempty"`
 }
 
+// aviationWeather gets weather from the aviationweather.gov API
+type aviationWeather struct {
+	config struct {
+		Enable bool `toml:"enable"`
+	}
+}
+
+func init() {
+	Register(&aviationWeather{})
+}
+
+func (p *aviationWeather) Name() API {
+	return APIAviationWeather
+}
+
+func (p *aviationWeather) Capabilities() Capability {
+	return CapSurface | CapForecast
+}
+
+func (p *aviationWeather) Configure(decode func(v any) error) error {
+	return decode(&p.config)
+}
+
+func (p *aviationWeather) Enabled() bool {
+	return p.config.Enable
+}
+
+func (p *aviationWeather) GetWeather(req Request) (WeatherData, error) {
+	return getWeatherAviationWeather(req.ICAO)
+}
+
 func getWeatherAviationWeather(icao string) (WeatherData, error) {
 	logger.Infoln("getting weather from aviation weather...")
 
@@ -44,7 +76,7 @@ func getWeatherAviationWeather(icao string) (WeatherData, error) {
 
 	request, err := http.NewRequest(
 		"GET",
-		"https://aviationweather.gov/api/data/metar?ids="+icao+"&format=json",
+		"https://aviationweather.gov/api/data/metar?ids="+icao+"&format=json&taf=true",
 		nil,
 	)
 	if err != nil {
@@ -125,6 +157,8 @@ func convertAviationWeather(data []aviationWeatherData) WeatherData {
 
 	convertTime(&res, data)
 
+	convertForecast(&res, data)
+
 	logger.Infoln("parsed weather")
 
 	return res
@@ -150,13 +184,12 @@ func convertWind(out *WeatherData, data []aviationWeatherData) {
 
 	if data[0].WindDir != nil {
 		// winddir may be a number or text for variable, e.g. "VRB"
-		// if text, randomize direction, otherwise parse as float
+		// if text, mark the wind variable, otherwise parse as float
 		var v float64
 		if err := json.Unmarshal([]byte(*data[0].WindDir), &v); err == nil {
 			out.Data[0].Wind.Degrees = v
 		} else {
-			logger.Infoln("converting variable winds to random direction")
-			out.Data[0].Wind.Degrees = float64(rand.Intn(36) * 10)
+			out.Data[0].Wind.Variable = true
 		}
 	}
 
@@ -169,26 +202,52 @@ func convertWind(out *WeatherData, data []aviationWeatherData) {
 	}
 }
 
-// convertVisibility converts the visiblity
+// convertVisibility converts the visiblity. If it cannot be parsed it is left
+// out, and defaults to unrestricted when the weather is validated
 func convertVisibility(out *WeatherData, data []aviationWeatherData) {
 	if data[0].Visibility != nil {
-		out.Data[0].Visibility = &Visibility{}
+		miles, err := parseMiles(*data[0].Visibility)
+		if err != nil {
+			logger.Errorf("failed to parse visibility from aviation weather: %v", err)
+			return
+		}
 
-		var vis int
-		n, err := fmt.Sscanf(*data[0].Visibility, "%d", &vis)
-		if n == 1 && err == nil {
-			out.Data[0].Visibility.MetersFloat = float64(vis) * MilesToMeters
-		} else {
-			n, err := fmt.Sscanf(*data[0].Visibility, "%d+", &vis)
-			if n == 1 && err == nil {
-				out.Data[0].Visibility.MetersFloat = float64(vis) * MilesToMeters
-			} else {
-				logger.Errorf("failed to parse visibility from aviation weather: %v", err)
-				out.Data[0].Visibility.MetersFloat = 9000
-				logger.Warnln("defaulting visibility to 9000 meters")
+		out.Data[0].Visibility = &Visibility{MetersFloat: miles * MilesToMeters}
+	}
+}
+
+// parseMiles parses statute mile visibility as given by aviation weather, such
+// as "10+", "6", "1 1/2", "1/2", or "0.25", and returns the value in miles
+func parseMiles(s string) (float64, error) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(s), "+"))
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, fmt.Errorf("invalid visibility \"%s\"", s)
+	}
+
+	var miles float64
+	for _, field := range fields {
+		// M and P are less than and more than, as in a METAR
+		field = strings.TrimLeft(field, "MP")
+
+		numerator, denominator, fraction := strings.Cut(field, "/")
+
+		value, err := strconv.ParseFloat(numerator, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid visibility \"%s\"", s)
+		}
+
+		if fraction {
+			d, err := strconv.ParseFloat(denominator, 64)
+			if err != nil || d <= 0 {
+				return 0, fmt.Errorf("invalid visibility \"%s\"", s)
 			}
+			value /= d
 		}
+
+		miles += value
 	}
+
+	return miles, nil
 }
 
 // convertAltimeter converts the altimeter setting
@@ -218,6 +277,13 @@ func convertConditions(out *WeatherData, data []aviationWeatherData) {
 			}
 		}
 
+		// check for haze
+		for _, code := range HazeCodes() {
+			if strings.Contains(*data[0].Conditions, code) {
+				out.Data[0].Conditions = append(out.Data[0].Conditions, Conditions{Code: code})
+			}
+		}
+
 		// check for storms
 		for _, code := range StormCodes() {
 			if strings.Contains(*data[0].Conditions, code) {
@@ -278,3 +344,19 @@ func convertTime(out *WeatherData, data []aviationWeatherData) {
 		}
 	}
 }
+
+// convertForecast decodes the TAF included with the METAR
+func convertForecast(out *WeatherData, data []aviationWeatherData) {
+	if data[0].RawTAF == nil || *data[0].RawTAF == "" {
+		logger.Warnln("no forecast returned by aviation weather")
+		return
+	}
+
+	forecast, err := DecodeTAF(*data[0].RawTAF, time.Now().UTC())
+	if err != nil {
+		logger.Warnf("unable to decode forecast from aviation weather: %v", err)
+		return
+	}
+
+	out.Forecast = forecast
+}
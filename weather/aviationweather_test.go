@@ -0,0 +1,56 @@
+package weather
+
+import (
+	"math"
+	"testing"
+)
+
+// TestParseMiles checks whole, fractional, and decimal miles are parsed
+func TestParseMiles(t *testing.T) {
+	tests := []struct {
+		input string
+		miles float64
+	}{
+		{"10+", 10},
+		{"6", 6},
+		{"1/2", 0.5},
+		{"1 1/2", 1.5},
+		{"0.25", 0.25},
+		{"M1/4", 0.25},
+		{"P6", 6},
+		{" 3 ", 3},
+	}
+
+	for _, test := range tests {
+		miles, err := parseMiles(test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+		} else if math.Abs(miles-test.miles) > 1e-9 {
+			t.Errorf("%q: got %v miles, expected %v", test.input, miles, test.miles)
+		}
+	}
+
+	for _, input := range []string{"", "+", "1/0", "one", "1 2 3", "1/"} {
+		if _, err := parseMiles(input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+// TestConvertVisibility checks low visibility is kept and visibility which
+// cannot be parsed is left out
+func TestConvertVisibility(t *testing.T) {
+	half := "1/2"
+	out := WeatherData{Data: []Data{{}}}
+	convertVisibility(&out, []aviationWeatherData{{Visibility: &half}})
+	if out.Data[0].Visibility == nil || math.Abs(out.Data[0].Visibility.MetersFloat-0.5*MilesToMeters) > 1e-9 {
+		t.Errorf("got %v, expected 1/2 mile", out.Data[0].Visibility)
+	}
+
+	bad := "unknown"
+	out = WeatherData{Data: []Data{{}}}
+	convertVisibility(&out, []aviationWeatherData{{Visibility: &bad}})
+	if out.Data[0].Visibility != nil {
+		t.Errorf("got %v, expected no visibility", out.Data[0].Visibility)
+	}
+}
@@ -0,0 +1,383 @@
+package weather
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// BlendMethod is how an element of the weather is combined across stations
+type BlendMethod string
+
+const (
+	BlendWeighted   BlendMethod = "weighted"    // inverse distance weighted average
+	BlendMean       BlendMethod = "mean"        // average of all stations
+	BlendNearest    BlendMethod = "nearest"     // value from the nearest station
+	BlendWorst      BlendMethod = "worst"       // most restrictive value
+	BlendVectorMean BlendMethod = "vector-mean" // average of wind vectors
+)
+
+// BlendOptions sets the method used to blend each element of the weather
+type BlendOptions struct {
+	Pressure    BlendMethod
+	Temperature BlendMethod // also used for dewpoint
+	Wind        BlendMethod
+	Visibility  BlendMethod
+	Clouds      BlendMethod
+	Conditions  BlendMethod
+}
+
+// BlendMethods returns the methods supported for each element of the weather
+func BlendMethods() map[string][]BlendMethod {
+	return map[string][]BlendMethod{
+		"pressure":    {BlendWeighted, BlendMean, BlendNearest},
+		"temperature": {BlendWeighted, BlendMean, BlendNearest},
+		"wind":        {BlendVectorMean, BlendWeighted, BlendNearest},
+		"visibility":  {BlendWorst, BlendWeighted, BlendMean, BlendNearest},
+		"clouds":      {BlendWorst, BlendNearest},
+		"conditions":  {BlendWorst, BlendNearest},
+	}
+}
+
+// blendStation is a station's observation with its weight when blending
+type blendStation struct {
+	data     Data
+	distance float64
+	weight   float64
+}
+
+// Blend combines the observations of several stations into one. location is
+// the longitude and latitude the stations are weighted from. The station,
+// time, and forecast of the result are taken from the nearest station
+func Blend(stations []WeatherData, location []float64, options BlendOptions) (WeatherData, error) {
+	var blend []blendStation
+	for _, station := range stations {
+		if station.NumResults < 1 || len(station.Data) < 1 {
+			continue
+		}
+
+		data := station.Data[0]
+		distance := math.Inf(1)
+		if len(location) >= 2 && data.Station != nil && data.Station.Geometry != nil &&
+			len(data.Station.Geometry.Coordinates) >= 2 {
+			coords := data.Station.Geometry.Coordinates
+			distance = Distance(location[1], location[0], coords[1], coords[0])
+		}
+
+		// stations within a km are treated the same to avoid dividing by zero
+		weight := 1 / math.Pow(math.Max(distance, 1), 2)
+
+		blend = append(blend, blendStation{data: data, distance: distance, weight: weight})
+	}
+
+	if len(blend) == 0 {
+		return WeatherData{}, fmt.Errorf("no observations to blend")
+	}
+
+	// nearest station first
+	slices.SortStableFunc(blend, func(a, b blendStation) int {
+		switch {
+		case a.distance < b.distance:
+			return -1
+		case a.distance > b.distance:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	// if no distance is known all stations are weighted equally
+	if math.IsInf(blend[0].distance, 1) {
+		for i := range blend {
+			blend[i].weight = 1
+		}
+	}
+
+	var forecast *Forecast
+	for _, station := range stations {
+		if len(station.Data) > 0 && station.Data[0].ICAO == blend[0].data.ICAO {
+			forecast = station.Forecast
+			break
+		}
+	}
+
+	nearest := blend[0].data
+	result := Data{
+		ICAO:     nearest.ICAO,
+		Observed: nearest.Observed,
+		Station:  nearest.Station,
+	}
+
+	result.Barometer = blendBarometer(blend, options.Pressure)
+	result.Temperature, result.Dewpoint = blendTemperature(blend, options.Temperature)
+	result.Wind = blendWind(blend, options.Wind)
+	result.Visibility = blendVisibility(blend, options.Visibility)
+	result.Clouds = blendClouds(blend, options.Clouds)
+	result.Conditions = blendConditions(blend, options.Conditions)
+
+	return WeatherData{
+		Data:       []Data{result},
+		NumResults: 1,
+		Forecast:   forecast,
+	}, nil
+}
+
+// blendMean returns the average of the values that are present using the
+// given method
+func blendMean(blend []blendStation, method BlendMethod, value func(Data) (float64, bool)) (float64, bool) {
+	var sum, total float64
+	for _, station := range blend {
+		v, ok := value(station.data)
+		if !ok {
+			continue
+		}
+
+		switch method {
+		case BlendNearest:
+			return v, true
+		case BlendMean:
+			sum += v
+			total++
+		default:
+			sum += v * station.weight
+			total += station.weight
+		}
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+
+	return sum / total, true
+}
+
+func blendBarometer(blend []blendStation, method BlendMethod) *Barometer {
+	hg, ok := blendMean(blend, method, func(d Data) (float64, bool) {
+		if d.Barometer == nil {
+			return 0, false
+		}
+		return d.Barometer.Hg, true
+	})
+	if !ok {
+		return nil
+	}
+
+	return &Barometer{Hg: hg}
+}
+
+func blendTemperature(blend []blendStation, method BlendMethod) (*Temperature, *Dewpoint) {
+	var temperature *Temperature
+	var dewpoint *Dewpoint
+
+	if c, ok := blendMean(blend, method, func(d Data) (float64, bool) {
+		if d.Temperature == nil {
+			return 0, false
+		}
+		return d.Temperature.Celsius, true
+	}); ok {
+		temperature = &Temperature{Celsius: c}
+	}
+
+	if c, ok := blendMean(blend, method, func(d Data) (float64, bool) {
+		if d.Dewpoint == nil {
+			return 0, false
+		}
+		return d.Dewpoint.Celsius, true
+	}); ok {
+		dewpoint = &Dewpoint{Celsius: c}
+	}
+
+	// averaging may leave the dewpoint above the temperature
+	if temperature != nil && dewpoint != nil {
+		dewpoint.Celsius = math.Min(dewpoint.Celsius, temperature.Celsius)
+	}
+
+	return temperature, dewpoint
+}
+
+// blendWind averages the wind as vectors so opposing winds cancel out instead
+// of averaging to a perpendicular direction. Variable wind has no direction and
+// adds nothing to the vectors, unless every station is variable and the blend
+// is variable too. Gusts are blended as the spread above the mean wind of the
+// stations reporting them, then added to the blended wind
+func blendWind(blend []blendStation, method BlendMethod) *Wind {
+	if method == BlendNearest {
+		for _, station := range blend {
+			if station.data.Wind != nil {
+				wind := *station.data.Wind
+				return &wind
+			}
+		}
+		return nil
+	}
+
+	var u, v, total, speed, spread, gusting float64
+	variable := true
+	for _, station := range blend {
+		wind := station.data.Wind
+		if wind == nil {
+			continue
+		}
+
+		weight := station.weight
+		if method == BlendVectorMean {
+			weight = 1
+		}
+
+		if !wind.Variable {
+			u += -wind.SpeedMPS * math.Sin(wind.Degrees*degToRad) * weight
+			v += -wind.SpeedMPS * math.Cos(wind.Degrees*degToRad) * weight
+			variable = false
+		}
+		speed += wind.SpeedMPS * weight
+		total += weight
+
+		if wind.GustMPS > wind.SpeedMPS {
+			spread += (wind.GustMPS - wind.SpeedMPS) * weight
+			gusting += weight
+		}
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	u /= total
+	v /= total
+
+	degrees := math.Mod(math.Atan2(-u, -v)/degToRad+360, 360)
+
+	wind := &Wind{
+		Degrees:  math.Round(degrees),
+		SpeedMPS: math.Hypot(u, v),
+	}
+	if variable {
+		wind = &Wind{Variable: true, SpeedMPS: speed / total}
+	}
+
+	if gusting > 0 {
+		wind.GustMPS = wind.SpeedMPS + spread/gusting
+	}
+
+	return wind
+}
+
+func blendVisibility(blend []blendStation, method BlendMethod) *Visibility {
+	if method == BlendWorst {
+		var worst *Visibility
+		for _, station := range blend {
+			vis := station.data.Visibility
+			if vis != nil && (worst == nil || vis.MetersFloat < worst.MetersFloat) {
+				worst = &Visibility{MetersFloat: vis.MetersFloat}
+			}
+		}
+		return worst
+	}
+
+	meters, ok := blendMean(blend, method, func(d Data) (float64, bool) {
+		if d.Visibility == nil {
+			return 0, false
+		}
+		return d.Visibility.MetersFloat, true
+	})
+	if !ok {
+		return nil
+	}
+
+	return &Visibility{MetersFloat: meters}
+}
+
+// blendClouds uses the cloud layers of a single station so layers from
+// different stations are not mixed. The worst clouds are those with the
+// lowest ceiling, or the most coverage if there is no ceiling
+func blendClouds(blend []blendStation, method BlendMethod) []Clouds {
+	var best []Clouds
+	bestCeiling, bestCover := math.Inf(1), -1
+
+	for _, station := range blend {
+		clouds := station.data.Clouds
+		if len(clouds) == 0 {
+			continue
+		}
+
+		if method == BlendNearest {
+			return slices.Clone(clouds)
+		}
+
+		ceiling, cover := math.Inf(1), 0
+		for _, layer := range clouds {
+			c := cloudCover(layer.Code)
+			if c >= cloudCover("BKN") && layer.Meters < ceiling {
+				ceiling = layer.Meters
+			}
+			cover = max(cover, c)
+		}
+
+		if ceiling < bestCeiling || (ceiling == bestCeiling && cover > bestCover) {
+			best, bestCeiling, bestCover = clouds, ceiling, cover
+		}
+	}
+
+	return slices.Clone(best)
+}
+
+// cloudCover ranks cloud codes from clear to overcast
+func cloudCover(code string) int {
+	switch code {
+	case "FEW":
+		return 1
+	case "SCT":
+		return 2
+	case "BKN":
+		return 3
+	case "OVC", "VV":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// blendConditions uses the weather of the station with the most significant
+// weather, storms first, then precipitation, fog, and dust
+func blendConditions(blend []blendStation, method BlendMethod) []Conditions {
+	var worst []Conditions
+	worstSeverity := 0
+
+	for _, station := range blend {
+		if method == BlendNearest {
+			return slices.Clone(station.data.Conditions)
+		}
+
+		severity := 0
+		for _, condition := range station.data.Conditions {
+			severity = max(severity, conditionSeverity(condition))
+		}
+
+		if severity > worstSeverity {
+			worst, worstSeverity = station.data.Conditions, severity
+		}
+	}
+
+	return slices.Clone(worst)
+}
+
+// conditionSeverity ranks weather from insignificant to thunderstorms, with
+// heavy intensity ranking above light or moderate
+func conditionSeverity(condition Conditions) int {
+	severity := 0
+	obscurations := append(HazeCodes(), DustCodes()...)
+	for rank, codes := range [][]string{obscurations, FogCodes(), PrecipCodes(), StormCodes()} {
+		for _, code := range codes {
+			if strings.Contains(condition.Code, code) {
+				severity = 2 * (rank + 1)
+			}
+		}
+	}
+
+	if severity > 0 && condition.Prefix == "+" {
+		severity++
+	}
+
+	return severity
+}
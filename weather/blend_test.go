@@ -0,0 +1,137 @@
+package weather
+
+import (
+	"math"
+	"testing"
+)
+
+// blendData returns an observation at the given location for blending
+func blendData(icao string, lat, lon float64, data Data) WeatherData {
+	data.ICAO = icao
+	data.Station = &Station{Geometry: &Geometry{Coordinates: []float64{lon, lat}}}
+	return WeatherData{Data: []Data{data}, NumResults: 1}
+}
+
+// TestBlend checks each element is blended with its method
+func TestBlend(t *testing.T) {
+	stations := []WeatherData{
+		blendData("UGSB", 41.6103, 41.5997, Data{
+			Barometer:  &Barometer{Hg: 30.00},
+			Wind:       &Wind{Degrees: 90, SpeedMPS: 5},
+			Visibility: &Visibility{MetersFloat: 9999},
+			Clouds:     []Clouds{{Code: "OVC", Meters: 1500}},
+			Conditions: []Conditions{{Code: "BR"}},
+		}),
+		blendData("UGKO", 42.1767, 42.4826, Data{
+			Barometer:  &Barometer{Hg: 29.00},
+			Wind:       &Wind{Degrees: 270, SpeedMPS: 5},
+			Visibility: &Visibility{MetersFloat: 3000},
+			Clouds:     []Clouds{{Code: "BKN", Meters: 600}, {Code: "OVC", Meters: 2000}},
+			Conditions: []Conditions{{Prefix: "+", Code: "TSRA"}},
+		}),
+	}
+
+	// near Kutaisi
+	location := []float64{42.4, 42.1}
+
+	data, err := Blend(stations, location, BlendOptions{
+		Pressure:    BlendWeighted,
+		Temperature: BlendWeighted,
+		Wind:        BlendVectorMean,
+		Visibility:  BlendWorst,
+		Clouds:      BlendWorst,
+		Conditions:  BlendWorst,
+	})
+	if err != nil {
+		t.Fatalf("error blending: %v", err)
+	}
+
+	result := data.Data[0]
+	if result.ICAO != "UGKO" {
+		t.Errorf("got icao %s, expected nearest station UGKO", result.ICAO)
+	}
+
+	if hg := result.Barometer.Hg; hg <= 29.00 || hg >= 29.5 {
+		t.Errorf("got pressure %.2f, expected closer to UGKO", hg)
+	}
+
+	if result.Wind.SpeedMPS > 1e-9 {
+		t.Errorf("got wind speed %f, expected opposing winds to cancel", result.Wind.SpeedMPS)
+	}
+
+	if result.Visibility.MetersFloat != 3000 {
+		t.Errorf("got visibility %.0f, expected 3000", result.Visibility.MetersFloat)
+	}
+
+	if len(result.Clouds) != 2 || result.Clouds[0].Meters != 600 {
+		t.Errorf("got clouds %v, expected clouds of UGKO", result.Clouds)
+	}
+
+	if len(result.Conditions) != 1 || result.Conditions[0].Code != "TSRA" {
+		t.Errorf("got conditions %v, expected conditions of UGKO", result.Conditions)
+	}
+
+	// nearest ignores the other stations entirely
+	data, err = Blend(stations, location, BlendOptions{
+		Pressure: BlendNearest,
+		Wind:     BlendNearest,
+	})
+	if err != nil {
+		t.Fatalf("error blending: %v", err)
+	}
+
+	if hg := data.Data[0].Barometer.Hg; math.Abs(hg-29.00) > 1e-9 {
+		t.Errorf("got pressure %.2f, expected 29.00", hg)
+	}
+
+	if wind := data.Data[0].Wind; wind.Degrees != 270 || wind.SpeedMPS != 5 {
+		t.Errorf("got wind %v, expected wind of UGKO", wind)
+	}
+}
+
+// TestBlendWind checks the gust spread is blended over the stations reporting
+// gusts and added to the blended wind, and variable wind adds no direction
+func TestBlendWind(t *testing.T) {
+	tests := []struct {
+		winds []Wind
+		speed float64
+		gust  float64
+	}{
+		// the calm station does not lower the gust below the wind
+		{[]Wind{{Degrees: 90, SpeedMPS: 10, GustMPS: 15}, {Degrees: 90, SpeedMPS: 10}}, 10, 15},
+		// opposing winds cancel, leaving only the spread
+		{[]Wind{{Degrees: 90, SpeedMPS: 10, GustMPS: 14}, {Degrees: 270, SpeedMPS: 10, GustMPS: 16}}, 0, 5},
+		// no gusts reported
+		{[]Wind{{Degrees: 90, SpeedMPS: 10}, {Degrees: 90, SpeedMPS: 6}}, 8, 0},
+		// variable wind has no direction to add
+		{[]Wind{{Degrees: 90, SpeedMPS: 10}, {Variable: true, SpeedMPS: 2}}, 5, 0},
+	}
+
+	for _, test := range tests {
+		var blend []blendStation
+		for _, wind := range test.winds {
+			w := wind
+			blend = append(blend, blendStation{data: Data{Wind: &w}, weight: 1})
+		}
+
+		wind := blendWind(blend, BlendVectorMean)
+		if math.Abs(wind.SpeedMPS-test.speed) > 1e-9 || math.Abs(wind.GustMPS-test.gust) > 1e-9 {
+			t.Errorf(
+				"%v: got %.2f G%.2f, expected %.2f G%.2f",
+				test.winds, wind.SpeedMPS, wind.GustMPS, test.speed, test.gust,
+			)
+		}
+		if wind.Variable {
+			t.Errorf("%v: got variable wind, expected a direction", test.winds)
+		}
+	}
+
+	// the blend of variable winds is variable
+	wind := blendWind([]blendStation{
+		{data: Data{Wind: &Wind{Variable: true, SpeedMPS: 2}}, weight: 1},
+		{data: Data{Wind: &Wind{Variable: true, SpeedMPS: 4}}, weight: 1},
+	}, BlendWeighted)
+	if !wind.Variable || wind.SpeedMPS != 3 {
+		t.Errorf("got %+v, expected variable wind at 3 m/s", *wind)
+	}
+}
@@ -0,0 +1,241 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+// Cacheable is implemented by providers to opt out of the response cache,
+// e.g. providers which read local files that may change between runs
+type Cacheable interface {
+	Cacheable() bool
+}
+
+// cacheEntry is a normalized provider response stored in the cache
+type cacheEntry struct {
+	Provider API             `json:"provider"`
+	Fetched  time.Time       `json:"fetched"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// diskCache stores provider responses as json files under dir
+type diskCache struct {
+	dir         string
+	ttl         time.Duration
+	fallback    bool
+	fallbackAge time.Duration
+}
+
+// cache is nil when caching is disabled
+var cache *diskCache
+
+// InitCache enables caching of provider responses in dir. Responses are reused
+// for ttl. If fallback is set, the last known good observation for an icao is
+// used when every provider fails, provided it is no older than fallbackAge.
+// A fallbackAge of 0 allows observations of any age
+func InitCache(dir string, ttl time.Duration, fallback bool, fallbackAge time.Duration) {
+	cache = &diskCache{
+		dir:         dir,
+		ttl:         ttl,
+		fallback:    fallback,
+		fallbackAge: fallbackAge,
+	}
+}
+
+// cacheable returns whether responses from p should be cached
+func cacheable(p Provider) bool {
+	if c, ok := p.(Cacheable); ok {
+		return c.Cacheable()
+	}
+	return true
+}
+
+// surfaceKey is the cache key for surface weather at the requested icao and
+// location from the provider. Locations are rounded to around 1 km
+func surfaceKey(name API, req Request) string {
+	var parts []string
+	if req.ICAO != "" {
+		parts = append(parts, strings.ToUpper(req.ICAO))
+	}
+	if len(req.Location) >= 2 {
+		parts = append(parts, fmt.Sprintf("%.2f_%.2f", req.Location[1], req.Location[0]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return filepath.Join("surface", string(name), strings.Join(parts, "_")+".json")
+}
+
+// lastGoodKey is the cache key for the last known good observation at icao.
+// There is no key without an icao, since the observation would be shared by
+// every location
+func lastGoodKey(icao string) string {
+	if icao == "" {
+		return ""
+	}
+	return filepath.Join("last-good", strings.ToUpper(icao)+".json")
+}
+
+// windsAloftKey is the cache key for winds aloft at a location and time from
+// the provider. Locations are rounded to around 1 km
+func windsAloftKey(name API, req Request) string {
+	if len(req.Location) < 2 {
+		return ""
+	}
+	file := fmt.Sprintf("%.2f_%.2f", req.Location[1], req.Location[0])
+	if !req.Time.IsZero() {
+		file += req.Time.UTC().Format("_200601021504")
+	}
+	return filepath.Join("winds-aloft", string(name), file+".json")
+}
+
+// load reads the entry for key into v. Entries older than maxAge are ignored
+// unless maxAge is 0
+func (c *diskCache) load(key string, maxAge time.Duration, v any) (cacheEntry, bool) {
+	var entry cacheEntry
+	if c == nil || key == "" {
+		return entry, false
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.dir, key))
+	if err != nil {
+		return entry, false
+	}
+
+	if err := json.Unmarshal(b, &entry); err != nil {
+		logger.Warnf("ignoring unreadable cache entry %s: %v", key, err)
+		return entry, false
+	}
+
+	if maxAge > 0 && time.Since(entry.Fetched) > maxAge {
+		return entry, false
+	}
+
+	if err := json.Unmarshal(entry.Data, v); err != nil {
+		logger.Warnf("ignoring unreadable cache entry %s: %v", key, err)
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// store writes v as the entry for key
+func (c *diskCache) store(key string, name API, v any) {
+	if c == nil || key == "" {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Warnf("unable to cache response from %s: %v", name, err)
+		return
+	}
+
+	b, err := json.Marshal(cacheEntry{
+		Provider: name,
+		Fetched:  time.Now().UTC(),
+		Data:     data,
+	})
+	if err != nil {
+		logger.Warnf("unable to cache response from %s: %v", name, err)
+		return
+	}
+
+	path := filepath.Join(c.dir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logger.Warnf("unable to create cache directory: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		logger.Warnf("unable to write cache: %v", err)
+	}
+}
+
+// cachedWeather returns surface weather cached from the provider for the
+// request within the ttl, unless the request is a refresh
+func (c *diskCache) cachedWeather(p Provider, req Request) (WeatherData, bool) {
+	var data WeatherData
+	if c == nil || c.ttl <= 0 || !cacheable(p) || req.Refresh {
+		return data, false
+	}
+
+	entry, ok := c.load(surfaceKey(p.Name(), req), c.ttl, &data)
+	if ok {
+		logger.Infof(
+			"using weather from %s cached at %s",
+			p.Name(),
+			entry.Fetched.Format(time.RFC3339),
+		)
+	}
+
+	return data, ok
+}
+
+// storeWeather caches surface weather from the provider for the request. If the
+// provider reports observations, it is also recorded as the last known good
+// observation for the requested icao
+func (c *diskCache) storeWeather(p Provider, req Request, data WeatherData) {
+	if c == nil || !cacheable(p) {
+		return
+	}
+
+	c.store(surfaceKey(p.Name(), req), p.Name(), data)
+	if !modeled(p.Name()) {
+		c.store(lastGoodKey(req.ICAO), p.Name(), data)
+	}
+}
+
+// lastGoodWeather returns the last known good observation for icao if it is
+// within the fallback age
+func (c *diskCache) lastGoodWeather(icao string) (WeatherData, API, bool) {
+	var data WeatherData
+	if c == nil || !c.fallback {
+		return data, "", false
+	}
+
+	entry, ok := c.load(lastGoodKey(icao), c.fallbackAge, &data)
+	if ok {
+		logger.Warnf(
+			"using last known good weather from %s fetched at %s",
+			entry.Provider,
+			entry.Fetched.Format(time.RFC3339),
+		)
+	}
+
+	return data, entry.Provider, ok
+}
+
+// cachedWindsAloft returns winds aloft cached from the provider within the ttl
+func (c *diskCache) cachedWindsAloft(p Provider, req Request) (WindsAloft, bool) {
+	var data WindsAloft
+	if c == nil || c.ttl <= 0 || !cacheable(p) {
+		return data, false
+	}
+
+	entry, ok := c.load(windsAloftKey(p.Name(), req), c.ttl, &data)
+	if ok {
+		logger.Infof(
+			"using winds aloft from %s cached at %s",
+			p.Name(),
+			entry.Fetched.Format(time.RFC3339),
+		)
+	}
+
+	return data, ok
+}
+
+// storeWindsAloft caches winds aloft from the provider
+func (c *diskCache) storeWindsAloft(p Provider, req Request, data WindsAloft) {
+	if c == nil || !cacheable(p) {
+		return
+	}
+
+	c.store(windsAloftKey(p.Name(), req), p.Name(), data)
+}
@@ -0,0 +1,149 @@
+package weather
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCacheFallback checks cached responses are reused within the ttl and the
+// last known good observation is used once every provider fails
+func TestCacheFallback(t *testing.T) {
+	p := &testProvider{name: "test-cached", icao: "CACH"}
+	p.config.Enable = true
+	Register(p)
+
+	InitCache(t.TempDir(), time.Hour, true, 0)
+	defer func() { cache = nil }()
+
+	priority := []API{"test-cached"}
+
+	if _, _, err := GetWeather(Request{ICAO: "CACH"}, priority); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// served from the cache within the ttl
+	p.err = errors.New("unavailable")
+	data, name, err := GetWeather(Request{ICAO: "CACH"}, priority)
+	if err != nil || name != "test-cached" || data.Data[0].ICAO != "CACH" {
+		t.Fatalf("expected cached weather, got %v from %s: %v", data, name, err)
+	}
+
+	// expired, falls back to last known good
+	cache.ttl = 0
+	data, name, err = GetWeather(Request{ICAO: "CACH"}, priority)
+	if err != nil || name != "test-cached" || data.Data[0].ICAO != "CACH" {
+		t.Fatalf("expected last known good weather, got %v from %s: %v", data, name, err)
+	}
+
+	// nothing is known about other stations
+	if _, _, err := GetWeather(Request{ICAO: "NONE"}, priority); err == nil {
+		t.Errorf("expected error for station without last known good weather")
+	}
+
+	// too old to fall back to
+	cache.fallbackAge = time.Nanosecond
+	if _, _, err := GetWeather(Request{ICAO: "CACH"}, priority); err == nil {
+		t.Errorf("expected error for last known good weather older than the max age")
+	}
+
+	cache.fallbackAge = 0
+	cache.fallback = false
+	if _, _, err := GetWeather(Request{ICAO: "CACH"}, priority); err == nil {
+		t.Errorf("expected error with fallback disabled")
+	}
+}
+
+// TestCacheFallbackModeled checks model weather is cached but is not kept as
+// a last known good observation
+func TestCacheFallbackModeled(t *testing.T) {
+	p := &stationProvider{
+		testProvider: testProvider{name: "test-cached-model"},
+		stations:     []string{"MODL"},
+		model:        true,
+	}
+	p.config.Enable = true
+	Register(p)
+
+	InitCache(t.TempDir(), time.Hour, true, 0)
+	defer func() { cache = nil }()
+
+	priority := []API{"test-cached-model"}
+
+	if _, _, err := GetWeather(Request{ICAO: "MODL"}, priority); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, ok := cache.lastGoodWeather("MODL"); ok {
+		t.Errorf("expected no last known good weather from a model")
+	}
+}
+
+// TestCacheLocation checks weather requested by location is cached for that
+// location only, and is not kept as a last known good observation
+func TestCacheLocation(t *testing.T) {
+	p := &testProvider{name: "test-located", icao: "LOCA"}
+	p.config.Enable = true
+	Register(p)
+
+	InitCache(t.TempDir(), time.Hour, true, 0)
+	defer func() { cache = nil }()
+
+	priority := []API{"test-located"}
+	here := Request{Location: []float64{42.48, 42.18}}
+	there := Request{Location: []float64{44.95, 41.67}}
+
+	if _, _, err := GetWeather(here, priority); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// another location is not served from the cache
+	p.icao = "LOCB"
+	data, _, err := GetWeather(there, priority)
+	if err != nil || data.Data[0].ICAO != "LOCB" {
+		t.Fatalf("expected new weather for other location, got %v: %v", data, err)
+	}
+
+	// the same location is
+	data, _, err = GetWeather(here, priority)
+	if err != nil || data.Data[0].ICAO != "LOCA" {
+		t.Fatalf("expected cached weather for location, got %v: %v", data, err)
+	}
+
+	// without an icao there is no last known good observation
+	p.err = errors.New("unavailable")
+	if _, _, err := GetWeather(Request{Location: []float64{10, 10}}, priority); err == nil {
+		t.Errorf("expected error for location without cached weather")
+	}
+}
+
+// TestCacheRefresh checks a refresh skips cached weather within the ttl but
+// still caches the new response
+func TestCacheRefresh(t *testing.T) {
+	p := &testProvider{name: "test-refresh", icao: "REFA"}
+	p.config.Enable = true
+	Register(p)
+
+	InitCache(t.TempDir(), time.Hour, true, 0)
+	defer func() { cache = nil }()
+
+	priority := []API{"test-refresh"}
+
+	if _, _, err := GetWeather(Request{ICAO: "REFA"}, priority); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a new report is seen within the ttl
+	p.icao = "REFB"
+	data, _, err := GetWeather(Request{ICAO: "REFA", Refresh: true}, priority)
+	if err != nil || data.Data[0].ICAO != "REFB" {
+		t.Fatalf("expected new weather, got %v: %v", data, err)
+	}
+
+	// and replaces the cached one
+	p.err = errors.New("unavailable")
+	data, _, err = GetWeather(Request{ICAO: "REFA"}, priority)
+	if err != nil || data.Data[0].ICAO != "REFB" {
+		t.Fatalf("expected refreshed weather from the cache, got %v: %v", data, err)
+	}
+}
@@ -11,24 +11,26 @@ import (
 )
 
 type WeatherData struct {
-	Data       []Data `json:"data,omitempty"`
-	NumResults int    `json:"results,omitempty"`
+	Data       []Data    `json:"data,omitempty"`
+	NumResults int       `json:"results,omitempty"`
+	Forecast   *Forecast `json:"forecast,omitempty"`
 }
 
 type Data struct {
-	Barometer      *Barometer   `json:"barometer,omitempty"`
-	Clouds         []Clouds     `json:"clouds,omitempty"`
-	Conditions     []Conditions `json:"conditions,omitempty"`
-	Dewpoint       *Dewpoint    `json:"dewpoint,omitempty"`
-	FlightCategory string       `json:"flight_category,omitempty"`
-	ICAO           string       `json:"icao,omitempty"`
-	ID             string       `json:"id,omitempty"`
-	Observed       string       `json:"observed,omitempty"`
-	RawText        string       `json:"raw_text,omitempty"`
-	Station        *Station     `json:"station,omitempty"`
-	Temperature    *Temperature `json:"temperature,omitempty"`
-	Visibility     *Visibility  `json:"visibility,omitempty"`
-	Wind           *Wind        `json:"wind,omitempty"`
+	Barometer         *Barometer          `json:"barometer,omitempty"`
+	Clouds            []Clouds            `json:"clouds,omitempty"`
+	Conditions        []Conditions        `json:"conditions,omitempty"`
+	Dewpoint          *Dewpoint           `json:"dewpoint,omitempty"`
+	FlightCategory    string              `json:"flight_category,omitempty"`
+	ICAO              string              `json:"icao,omitempty"`
+	ID                string              `json:"id,omitempty"`
+	Observed          string              `json:"observed,omitempty"`
+	RawText           string              `json:"raw_text,omitempty"`
+	RunwayVisualRange []RunwayVisualRange `json:"rvr,omitempty"`
+	Station           *Station            `json:"station,omitempty"`
+	Temperature       *Temperature        `json:"temperature,omitempty"`
+	Visibility        *Visibility         `json:"visibility,omitempty"`
+	Wind              *Wind               `json:"wind,omitempty"`
 }
 
 type Barometer struct {
@@ -45,10 +47,12 @@ type Clouds struct {
 	// Feet          float64 `json:"feet,omitempty"`
 	Meters float64 `json:"meters,omitempty"`
 	// Text          string  `json:"text,omitempty"`
+	Type string `json:"type,omitempty"` // CB or TCU if reported
 }
 
 type Conditions struct {
-	Code string `json:"code,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Prefix string `json:"prefix,omitempty"` // intensity, "-" or "+"
 	// Text string `json:"text,omitempty"`
 }
 
@@ -88,6 +92,59 @@ type Wind struct {
 	// GustKTS  float64 `json:"gust_kts,omitempty"`
 	// GustMPH  float64 `json:"gust_mph,omitempty"`
 	GustMPS float64 `json:"gust_mps,omitempty"`
+	// variable wind direction range, e.g. 240V300
+	VariableFrom float64 `json:"variable_from,omitempty"`
+	VariableTo   float64 `json:"variable_to,omitempty"`
+	// wind reported as variable (VRB) has no direction. A direction is chosen
+	// when it is applied to the mission
+	Variable bool `json:"variable,omitempty"`
+}
+
+type RunwayVisualRange struct {
+	Runway    string  `json:"runway,omitempty"`
+	Prefix    string  `json:"prefix,omitempty"` // M for less than, P for more than
+	Meters    float64 `json:"meters,omitempty"`
+	MaxMeters float64 `json:"max_meters,omitempty"` // set if RVR is variable
+}
+
+// checkWX gets weather from the CheckWX API
+type checkWX struct {
+	config struct {
+		Enable bool   `toml:"enable"`
+		Key    string `toml:"key"`
+	}
+}
+
+func init() {
+	Register(&checkWX{})
+}
+
+func (p *checkWX) Name() API {
+	return APICheckWX
+}
+
+func (p *checkWX) Capabilities() Capability {
+	return CapSurface | CapForecast
+}
+
+func (p *checkWX) Configure(decode func(v any) error) error {
+	if err := decode(&p.config); err != nil {
+		return err
+	}
+
+	if p.config.Enable && p.config.Key == "" {
+		return fmt.Errorf("checkwx enabled but missing api key")
+	}
+
+	return nil
+}
+
+func (p *checkWX) Enabled() bool {
+	return p.config.Enable
+}
+
+func (p *checkWX) GetWeather(req Request) (WeatherData, error) {
+	return getWeatherCheckWX(req.ICAO, p.config.Key)
 }
 
 func getWeatherCheckWX(icao, apiKey string) (WeatherData, error) {
@@ -143,5 +200,60 @@ func getWeatherCheckWX(icao, apiKey string) (WeatherData, error) {
 
 	logger.Infoln("parsed weather")
 
+	// a missing forecast is not fatal, the observation can still be used
+	if forecast, err := getForecastCheckWX(icao, apiKey); err == nil {
+		res.Forecast = forecast
+	} else {
+		logger.Warnf("unable to get forecast from CheckWX: %v", err)
+	}
+
 	return res, nil
 }
+
+// getForecastCheckWX gets the raw TAF from CheckWX and decodes it
+func getForecastCheckWX(icao, apiKey string) (*Forecast, error) {
+	logger.Infoln("getting forecast from CheckWX...")
+
+	timeout := time.Duration(5 * time.Second)
+	client := http.Client{Timeout: timeout}
+
+	request, err := http.NewRequest(
+		"GET",
+		"https://api.checkwx.com/taf/"+icao,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-API-Key", apiKey)
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to CheckWX: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CheckWX bad status: %v", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CheckWX response: %v", err)
+	}
+
+	logger.Infoln("got forecast data:", string(body))
+
+	var res struct {
+		Data []string `json:"data"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Data) < 1 {
+		return nil, fmt.Errorf("CheckWX returned no forecast for icao \"%s\"", icao)
+	}
+
+	return DecodeTAF(res.Data[0], time.Now().UTC())
+}
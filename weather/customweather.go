@@ -9,6 +9,50 @@ import (
 	"github.com/evogelsa/DCS-real-weather/v2/logger"
 )
 
+// custom reads weather from a JSON file in the CheckWX format
+type custom struct {
+	config struct {
+		Enable   bool   `toml:"enable"`
+		File     string `toml:"file"`
+		Override bool   `toml:"override"`
+	}
+}
+
+func init() {
+	Register(&custom{})
+}
+
+func (p *custom) Name() API {
+	return APICustom
+}
+
+func (p *custom) Capabilities() Capability {
+	return CapSurface
+}
+
+func (p *custom) Configure(decode func(v any) error) error {
+	return decode(&p.config)
+}
+
+func (p *custom) Enabled() bool {
+	return p.config.Enable
+}
+
+// Cacheable returns false since local files may change between runs
+func (p *custom) Cacheable() bool {
+	return false
+}
+
+// Override returns whether custom weather should override the weather of the
+// other providers
+func (p *custom) Override() bool {
+	return p.config.Override
+}
+
+func (p *custom) GetWeather(req Request) (WeatherData, error) {
+	return getWeatherCustom(p.config.File)
+}
+
 func getWeatherCustom(filename string) (WeatherData, error) {
 	var data WeatherData
 
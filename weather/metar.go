@@ -0,0 +1,486 @@
+package weather
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+// regular expressions for each METAR group
+var (
+	metarICAORE       = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}$`)
+	metarTimeRE       = regexp.MustCompile(`^(\d{2})(\d{2})(\d{2})Z$`)
+	metarWindRE       = regexp.MustCompile(`^(\d{3}|VRB|///)(\d{2,3}|//)(?:G(\d{2,3}))?(KT|MPS|KMH)$`)
+	metarVariableRE   = regexp.MustCompile(`^(\d{3})V(\d{3})$`)
+	metarVisMetersRE  = regexp.MustCompile(`^(\d{4})(NDV)?$`)
+	metarVisDirRE     = regexp.MustCompile(`^(\d{4})(N|NE|E|SE|S|SW|W|NW)$`)
+	metarVisWholeRE   = regexp.MustCompile(`^\d$`)
+	metarVisSMRE      = regexp.MustCompile(`^([MP])?(\d+)(?:/(\d+))?SM$`)
+	metarRVRRE        = regexp.MustCompile(`^R(\d{2}[LCR]?)/([MP])?(\d{4})(?:V([MP])?(\d{4}))?(FT)?(?:/?[UDN])?$`)
+	metarWeatherRE    = regexp.MustCompile(`^(-|\+|VC)?((?:MI|PR|BC|DR|BL|SH|TS|FZ)*)((?:DZ|RA|SN|SG|IC|PL|GR|GS|UP|BR|FG|FU|VA|DU|SA|HZ|PY|PO|SQ|FC|SS|DS)*)$`)
+	metarCloudRE      = regexp.MustCompile(`^(FEW|SCT|BKN|OVC|VV)(\d{3}|///)(CB|TCU|///)?$`)
+	metarTempRE       = regexp.MustCompile(`^(M?\d{2})/(M?\d{2})?$`)
+	metarAltimeterRE  = regexp.MustCompile(`^([AQ])(\d{4})$`)
+	metarPhenomenonRE = regexp.MustCompile(`..`)
+)
+
+// metarStopTokens end the decoding of the observation part of a METAR. Trends
+// and remarks follow these and are not part of the current conditions
+var metarStopTokens = []string{"RMK", "NOSIG", "BECMG", "TEMPO"}
+
+// METARSource describes where the METAR provider reads its raw METAR from.
+// Text is used if not empty, otherwise the report is read from File
+type METARSource struct {
+	Text string `toml:"text"`
+	File string `toml:"file"`
+}
+
+// rawMETAR decodes weather from raw METAR text given in the config or a file
+type rawMETAR struct {
+	config struct {
+		Enable bool `toml:"enable"`
+		METARSource
+	}
+}
+
+func init() {
+	Register(&rawMETAR{})
+}
+
+func (p *rawMETAR) Name() API {
+	return APIMETAR
+}
+
+func (p *rawMETAR) Capabilities() Capability {
+	return CapSurface
+}
+
+func (p *rawMETAR) Configure(decode func(v any) error) error {
+	if err := decode(&p.config); err != nil {
+		return err
+	}
+
+	if p.config.Enable && p.config.Text == "" && p.config.File == "" {
+		return fmt.Errorf("metar enabled but missing text and file")
+	}
+
+	return nil
+}
+
+func (p *rawMETAR) Enabled() bool {
+	return p.config.Enable
+}
+
+// Cacheable returns false since local files may change between runs
+func (p *rawMETAR) Cacheable() bool {
+	return false
+}
+
+func (p *rawMETAR) GetWeather(req Request) (WeatherData, error) {
+	return getWeatherMETAR(req.ICAO, p.config.METARSource)
+}
+
+// getWeatherMETAR reads raw METAR text from the configured source and decodes
+// the report matching icao
+func getWeatherMETAR(icao string, source METARSource) (WeatherData, error) {
+	logger.Infoln("getting weather from raw METAR...")
+
+	text := source.Text
+	if text == "" {
+		b, err := os.ReadFile(source.File)
+		if err != nil {
+			return WeatherData{}, fmt.Errorf("unable to read METAR file: %v", err)
+		}
+		text = string(b)
+	}
+
+	reports := SplitMETARs(text)
+	if len(reports) == 0 {
+		return WeatherData{}, fmt.Errorf("no METAR found in source")
+	}
+
+	// prefer the report for the configured icao, otherwise use the first one
+	report := reports[0]
+	for _, r := range reports {
+		if fields := strings.Fields(r); len(fields) > 0 {
+			if i := slices.IndexFunc(fields, metarICAORE.MatchString); i >= 0 &&
+				strings.EqualFold(fields[i], icao) {
+				report = r
+				break
+			}
+		}
+	}
+
+	logger.Infoln("got weather data:", report)
+	logger.Infoln("parsing weather...")
+
+	data, err := DecodeMETAR(report, time.Now().UTC())
+	if err != nil {
+		return WeatherData{}, fmt.Errorf("error decoding METAR: %v", err)
+	}
+
+	if !strings.EqualFold(data.Data[0].ICAO, icao) {
+		logger.Warnf(
+			"no METAR found for %s, using report from %s",
+			strings.ToUpper(icao),
+			data.Data[0].ICAO,
+		)
+	}
+
+	logger.Infoln("parsed weather")
+
+	return data, nil
+}
+
+// SplitMETARs splits text containing one or more raw METARs into individual
+// reports. Reports are separated by "=" terminators or new lines, and lines
+// starting with whitespace are treated as a continuation of the previous line
+func SplitMETARs(text string) []string {
+	var reports []string
+	var current string
+
+	flush := func() {
+		if s := strings.Join(strings.Fields(current), " "); s != "" {
+			reports = append(reports, s)
+		}
+		current = ""
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			current += " " + line
+		} else {
+			flush()
+			current = line
+		}
+
+		// handle explicit terminators, which may appear mid line
+		for strings.Contains(current, "=") {
+			before, after, _ := strings.Cut(current, "=")
+			current = before
+			flush()
+			current = after
+		}
+	}
+	flush()
+
+	return reports
+}
+
+// DecodeMETAR decodes a raw METAR or SPECI report into WeatherData. The day of
+// the observation is resolved against ref, which should be a time at or
+// shortly after the report was issued
+func DecodeMETAR(raw string, ref time.Time) (WeatherData, error) {
+	tokens := strings.Fields(strings.TrimSuffix(strings.TrimSpace(raw), "="))
+
+	var data Data
+	data.RawText = strings.Join(tokens, " ")
+
+	i := 0
+
+	// report type is optional
+	if i < len(tokens) && (tokens[i] == "METAR" || tokens[i] == "SPECI") {
+		i++
+	}
+
+	// station identifier
+	if i >= len(tokens) || !metarICAORE.MatchString(tokens[i]) {
+		return WeatherData{}, fmt.Errorf("missing station identifier")
+	}
+	data.ICAO = tokens[i]
+	i++
+
+	// observation time
+	if i >= len(tokens) || !metarTimeRE.MatchString(tokens[i]) {
+		return WeatherData{}, fmt.Errorf("missing observation time")
+	}
+	t, err := decodeMETARTime(tokens[i], ref)
+	if err != nil {
+		return WeatherData{}, err
+	}
+	data.Observed = t.Format("2006-01-02T15:04:05")
+	i++
+
+	// remaining groups may appear in any order and most are optional, so
+	// decode each by matching its format
+	for ; i < len(tokens); i++ {
+		token := tokens[i]
+
+		if slices.Contains(metarStopTokens, token) {
+			break
+		}
+
+		switch token {
+		case "AUTO", "COR", "CCA":
+			continue
+		case "NIL":
+			return WeatherData{}, fmt.Errorf("METAR for %s is NIL", data.ICAO)
+		}
+
+		n := decodeMETARGroup(&data, tokens[i:])
+		if n == 0 {
+			logger.Debugf("ignoring unrecognized METAR group \"%s\"", token)
+			continue
+		}
+		i += n - 1
+	}
+
+	return WeatherData{Data: []Data{data}, NumResults: 1}, nil
+}
+
+// decodeMETARGroup decodes the group at the start of tokens into data and
+// returns the number of tokens consumed, or 0 if the group is not recognized.
+// Groups shared by METARs and TAFs are handled here
+func decodeMETARGroup(data *Data, tokens []string) int {
+	token := tokens[0]
+
+	switch {
+	case metarWindRE.MatchString(token):
+		data.Wind = decodeMETARWind(token)
+
+	case metarVariableRE.MatchString(token):
+		if data.Wind == nil {
+			data.Wind = &Wind{}
+		}
+		m := metarVariableRE.FindStringSubmatch(token)
+		data.Wind.VariableFrom, _ = strconv.ParseFloat(m[1], 64)
+		data.Wind.VariableTo, _ = strconv.ParseFloat(m[2], 64)
+
+	case token == "CAVOK":
+		data.Visibility = &Visibility{MetersFloat: 10000}
+		data.Clouds = append(data.Clouds, Clouds{Code: "CAVOK"})
+
+	case metarVisMetersRE.MatchString(token):
+		m := metarVisMetersRE.FindStringSubmatch(token)
+		meters, _ := strconv.ParseFloat(m[1], 64)
+		if meters == 9999 {
+			// 9999 is reported for 10 km or more
+			meters = 10000
+		}
+		data.Visibility = &Visibility{MetersFloat: meters}
+
+	case metarVisDirRE.MatchString(token):
+		// directional visibility is only used if no prevailing visibility
+		// has been reported
+		if data.Visibility == nil {
+			m := metarVisDirRE.FindStringSubmatch(token)
+			meters, _ := strconv.ParseFloat(m[1], 64)
+			data.Visibility = &Visibility{MetersFloat: meters}
+		}
+
+	case metarVisWholeRE.MatchString(token) &&
+		len(tokens) > 1 &&
+		metarVisSMRE.MatchString(tokens[1]):
+		// whole number followed by a fraction, e.g. 1 1/2SM
+		whole, _ := strconv.ParseFloat(token, 64)
+		miles := whole + decodeMETARMiles(tokens[1])
+		data.Visibility = &Visibility{MetersFloat: miles * MilesToMeters}
+		return 2
+
+	case metarVisSMRE.MatchString(token):
+		miles := decodeMETARMiles(token)
+		data.Visibility = &Visibility{MetersFloat: miles * MilesToMeters}
+
+	case metarRVRRE.MatchString(token):
+		data.RunwayVisualRange = append(data.RunwayVisualRange, decodeMETARRVR(token))
+
+	case metarCloudRE.MatchString(token):
+		data.Clouds = append(data.Clouds, decodeMETARCloud(token))
+
+	case slices.Contains(ClearCodes(), token):
+		data.Clouds = append(data.Clouds, Clouds{Code: token})
+
+	case token == "NSW":
+		// no significant weather, only used in trends and forecasts
+		data.Conditions = append(data.Conditions, Conditions{Code: token})
+
+	case metarTempRE.MatchString(token):
+		m := metarTempRE.FindStringSubmatch(token)
+		data.Temperature = &Temperature{Celsius: decodeMETARTemp(m[1])}
+		if m[2] != "" {
+			data.Dewpoint = &Dewpoint{Celsius: decodeMETARTemp(m[2])}
+		}
+
+	case metarAltimeterRE.MatchString(token):
+		m := metarAltimeterRE.FindStringSubmatch(token)
+		v, _ := strconv.ParseFloat(m[2], 64)
+		if m[1] == "A" {
+			data.Barometer = &Barometer{Hg: v / 100}
+		} else {
+			data.Barometer = &Barometer{Hg: v * HPaToInHg}
+		}
+
+	case token != "" && metarWeatherRE.MatchString(token):
+		data.Conditions = append(data.Conditions, decodeMETARWeather(token)...)
+
+	default:
+		return 0
+	}
+
+	return 1
+}
+
+// decodeMETARTime decodes a DDHHMMZ group, taking the year and month from ref.
+// If the day is in the future relative to ref, the previous month is used
+func decodeMETARTime(token string, ref time.Time) (time.Time, error) {
+	m := metarTimeRE.FindStringSubmatch(token)
+	day, _ := strconv.Atoi(m[1])
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+
+	if day < 1 || day > 31 || hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid observation time \"%s\"", token)
+	}
+
+	ref = ref.UTC()
+	year, month := ref.Year(), ref.Month()
+
+	// allow a day of slack for reports issued just before midnight UTC
+	if day > ref.Day()+1 {
+		month--
+		if month < time.January {
+			month = time.December
+			year--
+		}
+	}
+
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC), nil
+}
+
+// decodeMETARWind decodes a wind group such as 27015G25KT or VRB03KT
+func decodeMETARWind(token string) *Wind {
+	m := metarWindRE.FindStringSubmatch(token)
+
+	var scale float64
+	switch m[4] {
+	case "KT":
+		scale = KtToMPS
+	case "MPS":
+		scale = 1
+	case "KMH":
+		scale = 1 / 3.6
+	}
+
+	wind := &Wind{}
+
+	switch m[1] {
+	case "VRB":
+		wind.Variable = true
+	case "///":
+		logger.Warnln("wind direction missing from METAR")
+	default:
+		wind.Degrees, _ = strconv.ParseFloat(m[1], 64)
+	}
+
+	if speed, err := strconv.ParseFloat(m[2], 64); err == nil {
+		wind.SpeedMPS = speed * scale
+	}
+
+	if m[3] != "" {
+		gust, _ := strconv.ParseFloat(m[3], 64)
+		wind.GustMPS = gust * scale
+	}
+
+	return wind
+}
+
+// decodeMETARMiles decodes statute mile visibility such as 10SM, 1/2SM, M1/4SM
+// or P6SM and returns the value in miles
+func decodeMETARMiles(token string) float64 {
+	m := metarVisSMRE.FindStringSubmatch(token)
+	miles, _ := strconv.ParseFloat(m[2], 64)
+	if m[3] != "" {
+		denominator, _ := strconv.ParseFloat(m[3], 64)
+		if denominator > 0 {
+			miles /= denominator
+		}
+	}
+	return miles
+}
+
+// decodeMETARRVR decodes a runway visual range group such as R24/P1500N or
+// R09L/1200V1800FT
+func decodeMETARRVR(token string) RunwayVisualRange {
+	m := metarRVRRE.FindStringSubmatch(token)
+
+	scale := 1.0
+	if m[6] == "FT" {
+		scale = FeetToMeters
+	}
+
+	rvr := RunwayVisualRange{Runway: m[1], Prefix: m[2]}
+	v, _ := strconv.ParseFloat(m[3], 64)
+	rvr.Meters = v * scale
+
+	if m[5] != "" {
+		v, _ := strconv.ParseFloat(m[5], 64)
+		rvr.MaxMeters = v * scale
+	}
+
+	return rvr
+}
+
+// decodeMETARCloud decodes a cloud layer such as BKN025CB. Vertical
+// visibility is treated as an overcast layer since the sky is obscured
+func decodeMETARCloud(token string) Clouds {
+	m := metarCloudRE.FindStringSubmatch(token)
+
+	cloud := Clouds{Code: m[1]}
+	if cloud.Code == "VV" {
+		cloud.Code = "OVC"
+	}
+
+	if hundreds, err := strconv.ParseFloat(m[2], 64); err == nil {
+		cloud.Meters = hundreds * 100 * FeetToMeters
+	}
+
+	if m[3] == "CB" || m[3] == "TCU" {
+		cloud.Type = m[3]
+	}
+
+	return cloud
+}
+
+// decodeMETARTemp decodes a temperature where M denotes a negative value
+func decodeMETARTemp(s string) float64 {
+	var sign float64 = 1
+	if strings.HasPrefix(s, "M") {
+		sign = -1
+		s = s[1:]
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return sign * v
+}
+
+// decodeMETARWeather decodes a present weather group into conditions. Groups
+// with a descriptor are kept whole (e.g. SHRA, BLSN, or FZFG) as the API
+// providers report them, so showers, storms, and blowing or shallow phenomena
+// can be told apart. Other groups are split into their individual codes.
+// Weather in the vicinity of the station is ignored since it is not at the
+// airfield
+func decodeMETARWeather(token string) []Conditions {
+	m := metarWeatherRE.FindStringSubmatch(token)
+	prefix, descriptor, phenomena := m[1], m[2], m[3]
+
+	if prefix == "VC" {
+		logger.Debugf("ignoring weather in vicinity \"%s\"", token)
+		return nil
+	}
+
+	if descriptor != "" {
+		return []Conditions{{Code: descriptor + phenomena, Prefix: prefix}}
+	}
+
+	var conditions []Conditions
+	for _, code := range metarPhenomenonRE.FindAllString(phenomena, -1) {
+		conditions = append(conditions, Conditions{Code: code, Prefix: prefix})
+	}
+
+	return conditions
+}
@@ -0,0 +1,186 @@
+package weather
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestDecodeMETAR decodes a variety of METARs and checks the decoded values
+func TestDecodeMETAR(t *testing.T) {
+	ref := time.Date(2024, time.April, 13, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		raw         string
+		observed    string
+		degrees     float64
+		speed       float64
+		gust        float64
+		vrb         bool
+		variable    [2]float64
+		visibility  float64
+		rvr         int
+		conditions  []Conditions
+		clouds      []Clouds
+		temperature float64
+		dewpoint    float64
+		hg          float64
+	}{
+		{
+			raw:         "METAR UGKO 130100Z 22004KT 9999 BKN018 OVC045 12/11 Q1021 NOSIG",
+			observed:    "2024-04-13T01:00:00",
+			degrees:     220,
+			speed:       4 * KtToMPS,
+			visibility:  10000,
+			clouds:      []Clouds{{Code: "BKN", Meters: 1800 * FeetToMeters}, {Code: "OVC", Meters: 4500 * FeetToMeters}},
+			temperature: 12,
+			dewpoint:    11,
+			hg:          1021 * HPaToInHg,
+		},
+		{
+			raw:         "KJFK 122351Z 31015G25KT 280V340 1 1/2SM R04R/2200V4000FT -SHRA BR FEW030 BKN080CB OVC200 M02/M05 A2992 RMK AO2",
+			observed:    "2024-04-12T23:51:00",
+			degrees:     310,
+			speed:       15 * KtToMPS,
+			gust:        25 * KtToMPS,
+			variable:    [2]float64{280, 340},
+			visibility:  1.5 * MilesToMeters,
+			rvr:         1,
+			conditions:  []Conditions{{Code: "SHRA", Prefix: "-"}, {Code: "BR"}},
+			clouds:      []Clouds{{Code: "FEW", Meters: 3000 * FeetToMeters}, {Code: "BKN", Meters: 8000 * FeetToMeters, Type: "CB"}, {Code: "OVC", Meters: 20000 * FeetToMeters}},
+			temperature: -2,
+			dewpoint:    -5,
+			hg:          29.92,
+		},
+		{
+			raw:         "SPECI OKBK 310600Z VRB02MPS 0800 +TSRAGR VV002 20/19 Q1008=",
+			observed:    "2024-03-31T06:00:00",
+			speed:       2,
+			vrb:         true,
+			visibility:  800,
+			conditions:  []Conditions{{Code: "TSRAGR", Prefix: "+"}},
+			clouds:      []Clouds{{Code: "OVC", Meters: 200 * FeetToMeters}},
+			temperature: 20,
+			dewpoint:    19,
+			hg:          1008 * HPaToInHg,
+		},
+		{
+			raw:         "UUEE 130130Z 00000KT CAVOK M10/M12 Q1030",
+			observed:    "2024-04-13T01:30:00",
+			visibility:  10000,
+			clouds:      []Clouds{{Code: "CAVOK"}},
+			temperature: -10,
+			dewpoint:    -12,
+			hg:          1030 * HPaToInHg,
+		},
+	}
+
+	for _, test := range tests {
+		wx, err := DecodeMETAR(test.raw, ref)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.raw, err)
+		}
+		data := wx.Data[0]
+
+		if data.Observed != test.observed {
+			t.Errorf("%s: observed got %s expected %s", test.raw, data.Observed, test.observed)
+		}
+
+		if data.Wind.Degrees != test.degrees || data.Wind.Variable != test.vrb {
+			t.Errorf(
+				"%s: wind direction got %v (variable %t) expected %v (variable %t)",
+				test.raw, data.Wind.Degrees, data.Wind.Variable, test.degrees, test.vrb,
+			)
+		}
+		if !approx(data.Wind.SpeedMPS, test.speed) || !approx(data.Wind.GustMPS, test.gust) {
+			t.Errorf("%s: wind got %v G%v expected %v G%v", test.raw, data.Wind.SpeedMPS, data.Wind.GustMPS, test.speed, test.gust)
+		}
+		if data.Wind.VariableFrom != test.variable[0] || data.Wind.VariableTo != test.variable[1] {
+			t.Errorf("%s: variable wind got %vV%v expected %vV%v", test.raw, data.Wind.VariableFrom, data.Wind.VariableTo, test.variable[0], test.variable[1])
+		}
+
+		if !approx(data.Visibility.MetersFloat, test.visibility) {
+			t.Errorf("%s: visibility got %v expected %v", test.raw, data.Visibility.MetersFloat, test.visibility)
+		}
+
+		if len(data.RunwayVisualRange) != test.rvr {
+			t.Errorf("%s: got %d RVR groups expected %d", test.raw, len(data.RunwayVisualRange), test.rvr)
+		}
+
+		if len(data.Conditions) != len(test.conditions) {
+			t.Errorf("%s: conditions got %v expected %v", test.raw, data.Conditions, test.conditions)
+		} else {
+			for i := range test.conditions {
+				if data.Conditions[i] != test.conditions[i] {
+					t.Errorf("%s: conditions got %v expected %v", test.raw, data.Conditions, test.conditions)
+				}
+			}
+		}
+
+		if len(data.Clouds) != len(test.clouds) {
+			t.Errorf("%s: clouds got %v expected %v", test.raw, data.Clouds, test.clouds)
+		} else {
+			for i, cloud := range test.clouds {
+				if data.Clouds[i].Code != cloud.Code ||
+					data.Clouds[i].Type != cloud.Type ||
+					!approx(data.Clouds[i].Meters, cloud.Meters) {
+					t.Errorf("%s: clouds got %v expected %v", test.raw, data.Clouds, test.clouds)
+				}
+			}
+		}
+
+		if data.Temperature.Celsius != test.temperature || data.Dewpoint.Celsius != test.dewpoint {
+			t.Errorf("%s: temperature got %v/%v expected %v/%v", test.raw, data.Temperature.Celsius, data.Dewpoint.Celsius, test.temperature, test.dewpoint)
+		}
+
+		if !approx(data.Barometer.Hg, test.hg) {
+			t.Errorf("%s: altimeter got %v expected %v", test.raw, data.Barometer.Hg, test.hg)
+		}
+	}
+}
+
+// TestDecodeMETARWeather checks descriptors are kept with their phenomena and
+// groups without one are split into their codes
+func TestDecodeMETARWeather(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected []Conditions
+	}{
+		{"-SHRA", []Conditions{{Code: "SHRA", Prefix: "-"}}},
+		{"+SHSN", []Conditions{{Code: "SHSN", Prefix: "+"}}},
+		{"+TSRAGR", []Conditions{{Code: "TSRAGR", Prefix: "+"}}},
+		{"TS", []Conditions{{Code: "TS"}}},
+		{"BLSN", []Conditions{{Code: "BLSN"}}},
+		{"DRSN", []Conditions{{Code: "DRSN"}}},
+		{"BLDU", []Conditions{{Code: "BLDU"}}},
+		{"FZFG", []Conditions{{Code: "FZFG"}}},
+		{"MIFG", []Conditions{{Code: "MIFG"}}},
+		{"BCFG", []Conditions{{Code: "BCFG"}}},
+		{"-FZRA", []Conditions{{Code: "FZRA", Prefix: "-"}}},
+		{"-RASN", []Conditions{{Code: "RA", Prefix: "-"}, {Code: "SN", Prefix: "-"}}},
+		{"BR", []Conditions{{Code: "BR"}}},
+		{"VCSH", nil},
+	}
+
+	for _, test := range tests {
+		conditions := decodeMETARWeather(test.token)
+		if !slices.Equal(conditions, test.expected) {
+			t.Errorf("%s: got %v expected %v", test.token, conditions, test.expected)
+		}
+	}
+}
+
+// TestDecodeMETARInvalid checks that reports missing required groups return
+// an error
+func TestDecodeMETARInvalid(t *testing.T) {
+	for _, raw := range []string{"", "METAR", "UGKO 22004KT", "UGKO 130100Z NIL"} {
+		if _, err := DecodeMETAR(raw, time.Now()); err == nil {
+			t.Errorf("%q: expected error", raw)
+		}
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
@@ -0,0 +1,579 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+type OpenMeteoData struct {
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	Elevation        float64 `json:"elevation"`
+	GenerationTime   float64 `json:"generationtime_ms"`
+	UTCOffsetSeconds int     `json:"utc_offset_seconds"`
+	Timezone         string  `json:"timezone"`
+	TimezoneAbbr     string  `json:"timezone_abbreviation"`
+	Current          struct {
+		Time          string   `json:"time"`
+		Temperature   *float64 `json:"temperature_2m"`
+		Dewpoint      *float64 `json:"dew_point_2m"`
+		PressureMSL   *float64 `json:"pressure_msl"`
+		WindSpeed     *float64 `json:"wind_speed_10m"`
+		WindDirection *float64 `json:"wind_direction_10m"`
+		WindGusts     *float64 `json:"wind_gusts_10m"`
+		Visibility    *float64 `json:"visibility"`
+		CloudCoverLow *float64 `json:"cloud_cover_low"`
+		CloudCoverMid *float64 `json:"cloud_cover_mid"`
+		CloudCoverHi  *float64 `json:"cloud_cover_high"`
+		WeatherCode   *int     `json:"weather_code"`
+	} `json:"current"`
+	// Hourly holds the time and each requested variable by name, e.g.
+	// wind_speed_800hPa
+	Hourly map[string]json.RawMessage `json:"hourly"`
+}
+
+// openMeteo gets surface weather and winds aloft from the Open-Meteo forecast
+// API. Surface weather is synthesized from the weather model, so it is
+// available at any location, including where no station reports METARs
+type openMeteo struct {
+	config struct {
+		Enable bool `toml:"enable"`
+	}
+}
+
+func init() {
+	Register(&openMeteo{})
+}
+
+func (p *openMeteo) Name() API {
+	return APIOpenMeteo
+}
+
+func (p *openMeteo) Capabilities() Capability {
+	return CapSurface | CapWindsAloft
+}
+
+func (p *openMeteo) Configure(decode func(v any) error) error {
+	return decode(&p.config)
+}
+
+func (p *openMeteo) Enabled() bool {
+	return p.config.Enable
+}
+
+// Modeled returns true since surface weather is synthesized from the model
+func (p *openMeteo) Modeled() bool {
+	return true
+}
+
+// GetWeather gets the current conditions at the station in the station
+// database matching the icao, or at the requested location if the station is
+// unknown
+func (p *openMeteo) GetWeather(req Request) (WeatherData, error) {
+	location := req.Location
+	if station, ok := LookupStation(req.ICAO); ok {
+		location = []float64{station.Longitude, station.Latitude}
+	}
+
+	if len(location) < 2 {
+		return WeatherData{}, fmt.Errorf(
+			"station \"%s\" not in station database and no location given",
+			req.ICAO,
+		)
+	}
+
+	return getWeatherOpenMeteo(req.ICAO, location)
+}
+
+func (p *openMeteo) GetWindsAloft(req Request) (WindsAloft, error) {
+	if len(req.Location) < 2 {
+		return WindsAloft{}, fmt.Errorf("missing location for winds aloft")
+	}
+
+	t := req.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return getWindsAloftOpenMeteo(req.Location, t.UTC())
+}
+
+// openMeteoCurrent are the current conditions used to synthesize surface
+// weather
+var openMeteoCurrent = []string{
+	"temperature_2m",
+	"dew_point_2m",
+	"pressure_msl",
+	"wind_speed_10m",
+	"wind_direction_10m",
+	"wind_gusts_10m",
+	"visibility",
+	"cloud_cover_low",
+	"cloud_cover_mid",
+	"cloud_cover_high",
+	"weather_code",
+}
+
+func getWeatherOpenMeteo(icao string, location []float64) (WeatherData, error) {
+	logger.Infoln("getting weather from open meteo...")
+
+	res, err := requestOpenMeteo(location, url.Values{
+		"current": {strings.Join(openMeteoCurrent, ",")},
+	})
+	if err != nil {
+		return WeatherData{}, err
+	}
+
+	logger.Infoln("got weather data")
+	logger.Infoln("parsing weather...")
+
+	data, err := convertOpenMeteo(res, icao)
+	if err != nil {
+		return WeatherData{}, err
+	}
+
+	logger.Infoln("parsed weather")
+
+	return data, nil
+}
+
+// requestOpenMeteo requests data from the Open-Meteo forecast API at location
+// using the given query parameters
+func requestOpenMeteo(location []float64, query url.Values) (OpenMeteoData, error) {
+	body, err := fetchOpenMeteo(
+		[]string{fmt.Sprintf("%.6f", location[1])},
+		[]string{fmt.Sprintf("%.6f", location[0])},
+		query,
+	)
+	if err != nil {
+		return OpenMeteoData{}, err
+	}
+
+	var res OpenMeteoData
+	if err := json.Unmarshal(body, &res); err != nil {
+		return OpenMeteoData{}, err
+	}
+
+	return res, nil
+}
+
+// requestOpenMeteoLocations requests data from the Open-Meteo forecast API at
+// several locations at once using the given query parameters. Results are in
+// the same order as the locations
+func requestOpenMeteoLocations(locations [][]float64, query url.Values) ([]OpenMeteoData, error) {
+	var latitudes, longitudes []string
+	for _, location := range locations {
+		latitudes = append(latitudes, fmt.Sprintf("%.6f", location[1]))
+		longitudes = append(longitudes, fmt.Sprintf("%.6f", location[0]))
+	}
+
+	body, err := fetchOpenMeteo(latitudes, longitudes, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single location is returned as an object instead of a list
+	if len(locations) == 1 {
+		var res OpenMeteoData
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, err
+		}
+		return []OpenMeteoData{res}, nil
+	}
+
+	var res []OpenMeteoData
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res) != len(locations) {
+		return nil, fmt.Errorf(
+			"open meteo returned %d locations, expected %d",
+			len(res),
+			len(locations),
+		)
+	}
+
+	return res, nil
+}
+
+// fetchOpenMeteo requests the body of a response from the Open-Meteo forecast
+// API at the given latitudes and longitudes
+func fetchOpenMeteo(latitudes, longitudes []string, query url.Values) ([]byte, error) {
+	// create http client to fetch weather data, timeout after 5 sec
+	timeout := time.Duration(5 * time.Second)
+	client := http.Client{Timeout: timeout}
+
+	request, err := http.NewRequest(
+		"GET",
+		"https://api.open-meteo.com/v1/forecast",
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// add query parameters
+	q := request.URL.Query()
+	q.Add("latitude", strings.Join(latitudes, ","))
+	q.Add("longitude", strings.Join(longitudes, ","))
+	for key, values := range query {
+		for _, value := range values {
+			q.Add(key, value)
+		}
+	}
+	q.Add("wind_speed_unit", "ms")
+
+	request.URL.RawQuery = q.Encode()
+
+	// make request
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// verify response
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open meteo bad status: %v", resp.Status)
+	}
+
+	// parse response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing open meteo response: %v", err)
+	}
+
+	return body, nil
+}
+
+// convertOpenMeteo converts the current conditions from Open-Meteo to
+// WeatherData as if reported by a station with the given icao
+func convertOpenMeteo(res OpenMeteoData, icao string) (WeatherData, error) {
+	current := res.Current
+	if current.Time == "" {
+		return WeatherData{}, fmt.Errorf("open meteo returned no current conditions")
+	}
+
+	data := Data{
+		ICAO: strings.ToUpper(icao),
+		Station: &Station{
+			Geometry: &Geometry{Coordinates: []float64{res.Longitude, res.Latitude}},
+		},
+	}
+
+	if t, err := time.Parse("2006-01-02T15:04", current.Time); err == nil {
+		data.Observed = t.Format("2006-01-02T15:04:05")
+	}
+
+	if current.Temperature != nil {
+		data.Temperature = &Temperature{Celsius: *current.Temperature}
+	}
+
+	if current.Dewpoint != nil {
+		data.Dewpoint = &Dewpoint{Celsius: *current.Dewpoint}
+	}
+
+	if current.PressureMSL != nil {
+		data.Barometer = &Barometer{Hg: *current.PressureMSL * HPaToInHg}
+	}
+
+	if current.WindSpeed != nil && current.WindDirection != nil {
+		data.Wind = &Wind{
+			Degrees:  math.Round(*current.WindDirection),
+			SpeedMPS: *current.WindSpeed,
+		}
+
+		if current.WindGusts != nil && *current.WindGusts > *current.WindSpeed {
+			data.Wind.GustMPS = *current.WindGusts
+		}
+	}
+
+	if current.Visibility != nil {
+		data.Visibility = &Visibility{MetersFloat: *current.Visibility}
+	}
+
+	var conditions []Conditions
+	if current.WeatherCode != nil {
+		conditions = convertWMOCode(*current.WeatherCode)
+	}
+	data.Conditions = conditions
+
+	data.Clouds = convertOpenMeteoClouds(current.CloudCoverLow, current.CloudCoverMid, current.CloudCoverHi, data)
+
+	return WeatherData{
+		Data:       []Data{data},
+		NumResults: 1,
+	}, nil
+}
+
+// convertOpenMeteoClouds converts the cloud cover of the low, mid, and high
+// levels of the model into cloud layers. Low clouds are based on the
+// temperature and dewpoint spread, since the model does not give a cloud base,
+// while mid and high clouds are placed at the bottom of their levels
+func convertOpenMeteoClouds(low, mid, high *float64, data Data) []Clouds {
+	// about 125 meters per degree of spread, within the low cloud level
+	lowBase := 1000.0
+	if data.Temperature != nil && data.Dewpoint != nil {
+		spread := data.Temperature.Celsius - data.Dewpoint.Celsius
+		lowBase = math.Min(math.Max(spread*125, 100), 2500)
+	}
+
+	var clouds []Clouds
+	for _, level := range []struct {
+		cover *float64
+		base  float64
+	}{
+		{low, lowBase},
+		{mid, 3000},
+		{high, 8000},
+	} {
+		if level.cover == nil {
+			continue
+		}
+
+		code := cloudCoverCode(*level.cover)
+		if code == "" {
+			continue
+		}
+
+		clouds = append(clouds, Clouds{Code: code, Meters: level.base})
+	}
+
+	// thunderstorms are reported with cumulonimbus
+	if len(clouds) > 0 && slices.ContainsFunc(data.Conditions, func(c Conditions) bool {
+		return strings.HasPrefix(c.Code, "TS")
+	}) {
+		clouds[0].Type = "CB"
+	}
+
+	return clouds
+}
+
+// cloudCoverCode converts cloud cover in percent to its METAR code, rounding
+// to the nearest okta
+func cloudCoverCode(percent float64) string {
+	switch oktas := math.Round(percent / 12.5); {
+	case oktas < 1:
+		return ""
+	case oktas <= 2:
+		return "FEW"
+	case oktas <= 4:
+		return "SCT"
+	case oktas <= 7:
+		return "BKN"
+	default:
+		return "OVC"
+	}
+}
+
+// convertWMOCode converts a WMO weather interpretation code as used by
+// Open-Meteo to METAR weather conditions
+func convertWMOCode(code int) []Conditions {
+	weather := map[int]Conditions{
+		45: {Code: "FG"},
+		48: {Code: "FZFG"},
+		51: {Prefix: "-", Code: "DZ"},
+		53: {Code: "DZ"},
+		55: {Prefix: "+", Code: "DZ"},
+		56: {Prefix: "-", Code: "FZDZ"},
+		57: {Code: "FZDZ"},
+		61: {Prefix: "-", Code: "RA"},
+		63: {Code: "RA"},
+		65: {Prefix: "+", Code: "RA"},
+		66: {Prefix: "-", Code: "FZRA"},
+		67: {Code: "FZRA"},
+		71: {Prefix: "-", Code: "SN"},
+		73: {Code: "SN"},
+		75: {Prefix: "+", Code: "SN"},
+		77: {Code: "SG"},
+		80: {Prefix: "-", Code: "SHRA"},
+		81: {Code: "SHRA"},
+		82: {Prefix: "+", Code: "SHRA"},
+		85: {Prefix: "-", Code: "SHSN"},
+		86: {Code: "SHSN"},
+		95: {Code: "TSRA"},
+		96: {Code: "TSGR"},
+		99: {Prefix: "+", Code: "TSGR"},
+	}
+
+	if condition, ok := weather[code]; ok {
+		return []Conditions{condition}
+	}
+
+	return nil
+}
+
+// openMeteoLevels are the pressure levels in hPa requested for winds aloft,
+// from near the surface to above 8000 m
+var openMeteoLevels = []int{1000, 975, 950, 925, 900, 850, 800, 700, 600, 500, 400, 300}
+
+// Range of the Open-Meteo forecast API relative to now
+const (
+	openMeteoPastDays     = 92
+	openMeteoForecastDays = 16
+)
+
+// getWindsAloftOpenMeteo gets winds aloft at time t, interpolating between the
+// forecast hours either side of it
+func getWindsAloftOpenMeteo(location []float64, t time.Time) (WindsAloft, error) {
+	logger.Infoln("getting winds aloft data from open meteo...")
+
+	if err := checkOpenMeteoTime(t); err != nil {
+		return WindsAloft{}, err
+	}
+
+	var variables []string
+	for _, level := range openMeteoLevels {
+		variables = append(variables,
+			fmt.Sprintf("wind_speed_%dhPa", level),
+			fmt.Sprintf("wind_direction_%dhPa", level),
+			fmt.Sprintf("geopotential_height_%dhPa", level),
+		)
+	}
+
+	// request the forecast hours either side of t
+	hour := t.Truncate(time.Hour)
+	res, err := requestOpenMeteo(location, url.Values{
+		"hourly":     {strings.Join(variables, ",")},
+		"start_hour": {hour.Format("2006-01-02T15:04")},
+		"end_hour":   {hour.Add(time.Hour).Format("2006-01-02T15:04")},
+	})
+	if err != nil {
+		return WindsAloft{}, err
+	}
+
+	logger.Infoln("got winds aloft data")
+	logger.Infoln("parsing winds aloft data...")
+
+	data, err := openMeteoWindsAloft(res, t)
+	if err != nil {
+		return WindsAloft{}, err
+	}
+
+	logger.Infow(
+		"parsed winds aloft:",
+		"time", t.Format(time.RFC3339),
+		"2000-meters", map[string]any{
+			"mps": data.WindSpeed2000,
+			"dir": data.WindDirection2000,
+		},
+		"8000-meters", map[string]any{
+			"mps": data.WindSpeed8000,
+			"dir": data.WindDirection8000,
+		},
+	)
+
+	return data, nil
+}
+
+// checkOpenMeteoTime returns an error if t is outside the range of the
+// Open-Meteo forecast API
+func checkOpenMeteoTime(t time.Time) error {
+	now := time.Now().UTC()
+	if t.Before(now.AddDate(0, 0, -openMeteoPastDays)) ||
+		t.After(now.AddDate(0, 0, openMeteoForecastDays-1)) {
+		return fmt.Errorf(
+			"%s is outside the range of open meteo forecasts (%d days ago to %d days ahead)",
+			t.Format(time.RFC3339),
+			openMeteoPastDays,
+			openMeteoForecastDays-1,
+		)
+	}
+
+	return nil
+}
+
+// openMeteoWindsAloft returns the winds aloft at time t, interpolating
+// between the forecast hours either side of it. An error is returned if the
+// response has no forecast hour at or before t
+func openMeteoWindsAloft(res OpenMeteoData, t time.Time) (WindsAloft, error) {
+	var times []string
+	if err := json.Unmarshal(res.Hourly["time"], &times); err != nil {
+		return WindsAloft{}, fmt.Errorf("error parsing open meteo times: %v", err)
+	}
+
+	hour := t.UTC().Truncate(time.Hour)
+	i := slices.Index(times, hour.Format("2006-01-02T15:04"))
+	if i < 0 {
+		return WindsAloft{}, fmt.Errorf(
+			"open meteo returned no forecast for %s",
+			hour.Format(time.RFC3339),
+		)
+	}
+
+	levels, err := openMeteoProfile(res, i)
+	if err != nil {
+		return WindsAloft{}, err
+	}
+
+	data, err := windsAloftFromProfile(levels)
+	if err != nil {
+		return WindsAloft{}, err
+	}
+
+	f := t.Sub(hour).Hours()
+	if f == 0 || i+1 >= len(times) {
+		return data, nil
+	}
+
+	levels, err = openMeteoProfile(res, i+1)
+	if err != nil {
+		// the next hour is only used to interpolate, so use this hour
+		logger.Warnf("unable to interpolate winds aloft: %v", err)
+		return data, nil
+	}
+
+	next, err := windsAloftFromProfile(levels)
+	if err != nil {
+		logger.Warnf("unable to interpolate winds aloft: %v", err)
+		return data, nil
+	}
+
+	return InterpolateWindsAloft(data, next, f), nil
+}
+
+// openMeteoProfile returns the wind at each pressure level at hour i. The
+// height of each level is its geopotential height, which varies with the
+// temperature of the air below it. Levels missing any value are skipped
+func openMeteoProfile(res OpenMeteoData, i int) ([]WindLevel, error) {
+	value := func(name string) (float64, bool) {
+		var values []*float64
+		if err := json.Unmarshal(res.Hourly[name], &values); err != nil ||
+			i >= len(values) || values[i] == nil {
+			return 0, false
+		}
+		return *values[i], true
+	}
+
+	var levels []WindLevel
+	for _, level := range openMeteoLevels {
+		speed, okSpeed := value(fmt.Sprintf("wind_speed_%dhPa", level))
+		direction, okDirection := value(fmt.Sprintf("wind_direction_%dhPa", level))
+		height, okHeight := value(fmt.Sprintf("geopotential_height_%dhPa", level))
+		if !okSpeed || !okDirection || !okHeight {
+			continue
+		}
+
+		levels = append(levels, WindLevel{
+			Meters:    height,
+			SpeedMPS:  speed,
+			Direction: direction,
+		})
+	}
+
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("open meteo returned no pressure levels")
+	}
+
+	return levels, nil
+}
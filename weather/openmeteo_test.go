@@ -0,0 +1,124 @@
+package weather
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestConvertOpenMeteo checks current conditions are converted like a METAR
+func TestConvertOpenMeteo(t *testing.T) {
+	body := `{
+		"latitude": 42.18,
+		"longitude": 42.48,
+		"elevation": 45,
+		"current": {
+			"time": "2024-03-01T12:00",
+			"temperature_2m": 12.0,
+			"dew_point_2m": 10.0,
+			"pressure_msl": 1013.2,
+			"wind_speed_10m": 5.0,
+			"wind_direction_10m": 268.6,
+			"wind_gusts_10m": 11.0,
+			"visibility": 4000,
+			"cloud_cover_low": 70,
+			"cloud_cover_mid": 20,
+			"cloud_cover_high": 0,
+			"weather_code": 95
+		}
+	}`
+
+	var res OpenMeteoData
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+
+	wx, err := convertOpenMeteo(res, "ugko")
+	if err != nil {
+		t.Fatalf("error converting: %v", err)
+	}
+
+	data := wx.Data[0]
+	if data.ICAO != "UGKO" {
+		t.Errorf("got icao %s, expected UGKO", data.ICAO)
+	}
+	if data.Observed != "2024-03-01T12:00:00" {
+		t.Errorf("got observed %s", data.Observed)
+	}
+	if data.Wind.Degrees != 269 || data.Wind.SpeedMPS != 5 || data.Wind.GustMPS != 11 {
+		t.Errorf("got wind %+v", *data.Wind)
+	}
+	if data.Visibility.MetersFloat != 4000 {
+		t.Errorf("got visibility %.0f, expected 4000", data.Visibility.MetersFloat)
+	}
+
+	// low cloud base from a 2 degree spread, no high cloud
+	if len(data.Clouds) != 2 {
+		t.Fatalf("got %d cloud layers, expected 2", len(data.Clouds))
+	}
+	if data.Clouds[0].Code != "BKN" || data.Clouds[0].Meters != 250 || data.Clouds[0].Type != "CB" {
+		t.Errorf("got low cloud %+v", data.Clouds[0])
+	}
+	if data.Clouds[1].Code != "FEW" || data.Clouds[1].Meters != 3000 {
+		t.Errorf("got mid cloud %+v", data.Clouds[1])
+	}
+
+	if len(data.Conditions) != 1 || data.Conditions[0].Code != "TSRA" {
+		t.Errorf("got conditions %v, expected TSRA", data.Conditions)
+	}
+
+	res.Current.Time = ""
+	if _, err := convertOpenMeteo(res, "UGKO"); err == nil {
+		t.Errorf("expected error without current conditions")
+	}
+}
+
+// TestOpenMeteoWindsAloft checks winds aloft are interpolated to the requested
+// time and fail when the time is not in the forecast
+func TestOpenMeteoWindsAloft(t *testing.T) {
+	body := `{
+		"hourly": {
+			"time": ["2024-03-01T12:00", "2024-03-01T13:00"],
+			"wind_speed_800hPa": [10, 20],
+			"wind_direction_800hPa": [350, 30],
+			"geopotential_height_800hPa": [2000, 2000],
+			"wind_speed_300hPa": [30, 50],
+			"wind_direction_300hPa": [260, 280],
+			"geopotential_height_300hPa": [8000, 8000]
+		}
+	}`
+
+	var res OpenMeteoData
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+
+	data, err := openMeteoWindsAloft(res, time.Date(2024, 3, 1, 12, 15, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("error getting winds aloft: %v", err)
+	}
+
+	if data.WindSpeed2000 != 12.5 || data.WindDirection2000 != 0 {
+		t.Errorf("got %.1f mps from %d at 2000 m", data.WindSpeed2000, data.WindDirection2000)
+	}
+	if data.WindSpeed8000 != 35 || data.WindDirection8000 != 265 {
+		t.Errorf("got %.1f mps from %d at 8000 m", data.WindSpeed8000, data.WindDirection8000)
+	}
+
+	// last hour is used as is
+	data, err = openMeteoWindsAloft(res, time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("error getting winds aloft: %v", err)
+	}
+	if data.WindSpeed2000 != 20 || data.WindDirection2000 != 30 {
+		t.Errorf("got %.1f mps from %d at 2000 m", data.WindSpeed2000, data.WindDirection2000)
+	}
+
+	if _, err := openMeteoWindsAloft(res, time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC)); err == nil {
+		t.Errorf("expected error for time outside the forecast")
+	}
+
+	if _, err := getWindsAloftOpenMeteo([]float64{42, 42}, time.Date(1991, 1, 17, 12, 0, 0, 0, time.UTC)); err == nil {
+		t.Errorf("expected error for time outside the forecast range")
+	}
+}
@@ -0,0 +1,157 @@
+package weather
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+//go:embed presets.toml
+var presetsTOML []byte
+
+// CloudPresets lists the presets usable for each kind of clouds, e.g. "BKN" or
+// "BKN+RA" for broken clouds with rain
+var CloudPresets map[string][]CloudPreset
+
+// DecodePreset maps each preset to its cloud layers as shown in a METAR
+var DecodePreset map[string][]Cloud
+
+// presetCatalog is the format of a cloud preset catalog file
+type presetCatalog struct {
+	Presets []struct {
+		Name          string `toml:"name"`
+		Description   string `toml:"description"`
+		Coverage      string `toml:"coverage"`
+		Precipitation bool   `toml:"precipitation"`
+		Snow          bool   `toml:"snow"`
+		MinBase       int    `toml:"min-base"`
+		MaxBase       int    `toml:"max-base"`
+		Thickness     int    `toml:"thickness"`
+		Layers        []struct {
+			Coverage string `toml:"coverage"`
+			Base     int    `toml:"base"` // hundreds of feet
+		} `toml:"layers"`
+	} `toml:"preset"`
+}
+
+func init() {
+	presets, decode, err := parsePresets(presetsTOML)
+	if err != nil {
+		// the catalog is embedded, so this is a build problem
+		panic(fmt.Sprintf("invalid cloud preset catalog: %v", err))
+	}
+
+	CloudPresets, DecodePreset = presets, decode
+}
+
+// LoadPresets reads the preset catalog file at path. Presets in the file
+// replace presets of the same name and any other presets are added
+func LoadPresets(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read preset catalog: %v", err)
+	}
+
+	presets, decode, err := parsePresets(b)
+	if err != nil {
+		return fmt.Errorf("invalid preset catalog %s: %v", path, err)
+	}
+
+	// remove replaced presets from their current kind
+	for kind, list := range CloudPresets {
+		CloudPresets[kind] = slices.DeleteFunc(list, func(preset CloudPreset) bool {
+			_, ok := decode[preset.Name]
+			return ok
+		})
+	}
+
+	for kind, list := range presets {
+		CloudPresets[kind] = append(CloudPresets[kind], list...)
+	}
+
+	for name, layers := range decode {
+		DecodePreset[name] = layers
+	}
+
+	return nil
+}
+
+// parsePresets parses a preset catalog into presets by kind and the cloud
+// layers of each preset
+func parsePresets(b []byte) (map[string][]CloudPreset, map[string][]Cloud, error) {
+	var catalog presetCatalog
+	if err := toml.Unmarshal(b, &catalog); err != nil {
+		return nil, nil, err
+	}
+
+	coverages := []string{"FEW", "SCT", "BKN", "OVC"}
+
+	presets := make(map[string][]CloudPreset)
+	decode := make(map[string][]Cloud)
+	for _, p := range catalog.Presets {
+		if p.Name == "" {
+			return nil, nil, fmt.Errorf("preset missing name")
+		}
+
+		// names are quoted as in the mission file
+		name := `"` + p.Name + `"`
+		if _, ok := decode[name]; ok {
+			return nil, nil, fmt.Errorf("preset %s listed twice", p.Name)
+		}
+
+		if !slices.Contains(coverages, p.Coverage) {
+			return nil, nil, fmt.Errorf("preset %s has invalid coverage \"%s\"", p.Name, p.Coverage)
+		}
+
+		if p.MinBase < 0 || p.MaxBase < p.MinBase {
+			return nil, nil, fmt.Errorf("preset %s has invalid base range", p.Name)
+		}
+
+		if p.Thickness < 0 {
+			return nil, nil, fmt.Errorf("preset %s has invalid thickness", p.Name)
+		}
+
+		if len(p.Layers) == 0 {
+			return nil, nil, fmt.Errorf("preset %s has no layers", p.Name)
+		}
+
+		var layers []Cloud
+		for _, layer := range p.Layers {
+			if !slices.Contains(coverages, layer.Coverage) || layer.Base < 0 || layer.Base > 999 {
+				return nil, nil, fmt.Errorf("preset %s has invalid layer", p.Name)
+			}
+			layers = append(layers, Cloud{layer.Coverage, fmt.Sprintf("%03d", layer.Base)})
+		}
+
+		kind := p.Coverage
+		if p.Precipitation {
+			kind += "+RA"
+		}
+
+		presets[kind] = append(presets[kind], CloudPreset{
+			Name:      name,
+			MinBase:   p.MinBase,
+			MaxBase:   p.MaxBase,
+			Thickness: p.Thickness,
+			Snow:      p.Precipitation && p.Snow,
+		})
+		decode[name] = layers
+	}
+
+	return presets, decode, nil
+}
+
+// LookupPreset returns the preset with the given quoted name
+func LookupPreset(name string) (CloudPreset, bool) {
+	for _, list := range CloudPresets {
+		for _, preset := range list {
+			if preset.Name == name {
+				return preset, true
+			}
+		}
+	}
+	return CloudPreset{}, false
+}
@@ -0,0 +1,127 @@
+package weather
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPresets checks the embedded preset catalog
+func TestPresets(t *testing.T) {
+	var n int
+	for kind, list := range CloudPresets {
+		for _, preset := range list {
+			n++
+			if _, ok := DecodePreset[preset.Name]; !ok {
+				t.Errorf("preset %s of kind %s has no layers", preset.Name, kind)
+			}
+		}
+	}
+
+	if n != len(DecodePreset) {
+		t.Errorf("got %d presets and %d decoded presets", n, len(DecodePreset))
+	}
+
+	layers := DecodePreset[`"Preset7"`]
+	if len(layers) != 3 || layers[0] != (Cloud{"BKN", "075"}) {
+		t.Errorf("got Preset7 layers %v", layers)
+	}
+
+	// only the overcast rain presets turn to snow in DCS
+	snow := map[string]bool{
+		`"RainyPreset1"`:    true,
+		`"RainyPreset2"`:    true,
+		`"RainyPreset3"`:    true,
+		`"RainyPreset4"`:    false,
+		`"RainyPreset5"`:    false,
+		`"RainyPreset6"`:    false,
+		`"NEWRAINPRESET4"`: false,
+	}
+	var rain, snowy int
+	for name, expected := range snow {
+		preset, ok := LookupPreset(name)
+		if !ok {
+			t.Errorf("missing rain preset %s", name)
+			continue
+		}
+		if preset.Snow != expected {
+			t.Errorf("got snow %t for %s, expected %t", preset.Snow, name, expected)
+		}
+	}
+	for kind, list := range CloudPresets {
+		for _, preset := range list {
+			if strings.HasSuffix(kind, "+RA") {
+				rain++
+				if preset.Snow {
+					snowy++
+				}
+			} else if preset.Snow {
+				t.Errorf("preset %s without rain has snow", preset.Name)
+			}
+		}
+	}
+	if rain == 0 || snowy == rain {
+		t.Errorf("got %d of %d rain presets with snow, expected some without", snowy, rain)
+	}
+}
+
+// TestLoadPresets checks a catalog file replaces and adds presets
+func TestLoadPresets(t *testing.T) {
+	defer func() {
+		CloudPresets, DecodePreset, _ = parsePresets(presetsTOML)
+	}()
+
+	path := filepath.Join(t.TempDir(), "presets.toml")
+	catalog := `
+[[preset]]
+name = "Preset1"
+coverage = "SCT"
+min-base = 500
+max-base = 1000
+layers = [{ coverage = "SCT", base = 20 }]
+
+[[preset]]
+name = "Preset99"
+coverage = "OVC"
+precipitation = true
+min-base = 300
+max-base = 3000
+thickness = 400
+layers = [{ coverage = "OVC", base = 10 }, { coverage = "BKN", base = 150 }]
+`
+	if err := os.WriteFile(path, []byte(catalog), 0644); err != nil {
+		t.Fatalf("unable to write catalog: %v", err)
+	}
+
+	if err := LoadPresets(path); err != nil {
+		t.Fatalf("error loading catalog: %v", err)
+	}
+
+	for _, preset := range CloudPresets["FEW"] {
+		if preset.Name == `"Preset1"` {
+			t.Errorf("replaced preset still listed as FEW")
+		}
+	}
+
+	preset, ok := LookupPreset(`"Preset1"`)
+	if !ok || preset.MinBase != 500 || DecodePreset[`"Preset1"`][0].Base != "020" {
+		t.Errorf("got Preset1 %+v, expected replacement", preset)
+	}
+
+	preset, ok = LookupPreset(`"Preset99"`)
+	if !ok || preset.Thickness != 400 || len(CloudPresets["OVC+RA"]) != 5 {
+		t.Errorf("got Preset99 %+v, expected new rain preset", preset)
+	}
+
+	// invalid catalogs leave the presets unchanged
+	if err := os.WriteFile(path, []byte("[[preset]]\nname = \"Preset2\"\n"), 0644); err != nil {
+		t.Fatalf("unable to write catalog: %v", err)
+	}
+	if err := LoadPresets(path); err == nil {
+		t.Errorf("expected error for preset without layers")
+	}
+	if _, ok := LookupPreset(`"Preset2"`); !ok {
+		t.Errorf("preset removed by invalid catalog")
+	}
+}
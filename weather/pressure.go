@@ -0,0 +1,161 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+// PressureSource is where the pressure field around a mission is taken from
+type PressureSource string
+
+const (
+	PressureSourceOpenMeteo PressureSource = "openmeteo" // grid of open meteo forecasts
+	PressureSourceStations  PressureSource = "stations"  // stations in icao-list
+)
+
+// PressureSample is the mean sea level pressure at a location
+type PressureSample struct {
+	Latitude  float64
+	Longitude float64
+	HPa       float64
+}
+
+// StationPressure returns a pressure sample for each station from its reported
+// altimeter setting, which is close to the mean sea level pressure. Stations
+// without a location or pressure are skipped
+func StationPressure(stations []WeatherData) []PressureSample {
+	var samples []PressureSample
+	for _, station := range stations {
+		if station.NumResults < 1 {
+			continue
+		}
+
+		data := station.Data[0]
+		if data.Barometer == nil || data.Barometer.Hg <= 0 ||
+			data.Station == nil || data.Station.Geometry == nil ||
+			len(data.Station.Geometry.Coordinates) < 2 {
+			continue
+		}
+
+		samples = append(samples, PressureSample{
+			Latitude:  data.Station.Geometry.Coordinates[1],
+			Longitude: data.Station.Geometry.Coordinates[0],
+			HPa:       data.Barometer.Hg * InHgToHPa,
+		})
+	}
+
+	return samples
+}
+
+// PressureGrid returns the locations, as longitude and latitude, of an n by n
+// grid centered on the given location. The grid extends radius km north,
+// south, east, and west of the center
+func PressureGrid(latitude, longitude, radius float64, n int) [][]float64 {
+	if n < 2 {
+		return [][]float64{{longitude, latitude}}
+	}
+
+	kmPerDegree := earthRadiusKM * degToRad
+	dLat := radius / kmPerDegree
+	dLon := dLat / max(math.Cos(latitude*degToRad), 0.01)
+
+	var locations [][]float64
+	for i := 0; i < n; i++ {
+		lat := latitude - dLat + 2*dLat*float64(i)/float64(n-1)
+		for j := 0; j < n; j++ {
+			lon := longitude - dLon + 2*dLon*float64(j)/float64(n-1)
+			locations = append(locations, []float64{lon, lat})
+		}
+	}
+
+	return locations
+}
+
+// GetPressureField gets the mean sea level pressure at time t at each location
+// from Open-Meteo, interpolating between the forecast hours either side of t
+func GetPressureField(locations [][]float64, t time.Time) ([]PressureSample, error) {
+	if !Enabled(APIOpenMeteo) {
+		return nil, fmt.Errorf("%w named \"%s\"", ErrNoProvider, APIOpenMeteo)
+	}
+
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("no locations for pressure field")
+	}
+
+	t = t.UTC()
+	if err := checkOpenMeteoTime(t); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("getting pressure at %d locations from open meteo...", len(locations))
+
+	hour := t.Truncate(time.Hour)
+	res, err := requestOpenMeteoLocations(locations, url.Values{
+		"hourly":     {"pressure_msl"},
+		"start_hour": {hour.Format("2006-01-02T15:04")},
+		"end_hour":   {hour.Add(time.Hour).Format("2006-01-02T15:04")},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]PressureSample, 0, len(res))
+	for i, r := range res {
+		hPa, err := openMeteoPressure(r, t)
+		if err != nil {
+			logger.Warnf(
+				"ignoring pressure at %.4f, %.4f: %v",
+				locations[i][1],
+				locations[i][0],
+				err,
+			)
+			continue
+		}
+
+		samples = append(samples, PressureSample{
+			Latitude:  locations[i][1],
+			Longitude: locations[i][0],
+			HPa:       hPa,
+		})
+	}
+
+	logger.Infof("got pressure at %d locations", len(samples))
+
+	return samples, nil
+}
+
+// openMeteoPressure returns the mean sea level pressure at time t,
+// interpolating between the forecast hours either side of it
+func openMeteoPressure(res OpenMeteoData, t time.Time) (float64, error) {
+	var times []string
+	if err := json.Unmarshal(res.Hourly["time"], &times); err != nil {
+		return 0, fmt.Errorf("error parsing open meteo times: %v", err)
+	}
+
+	var values []*float64
+	if err := json.Unmarshal(res.Hourly["pressure_msl"], &values); err != nil {
+		return 0, fmt.Errorf("error parsing open meteo pressure: %v", err)
+	}
+
+	hour := t.Truncate(time.Hour)
+	i := slices.Index(times, hour.Format("2006-01-02T15:04"))
+	if i < 0 || i >= len(values) || values[i] == nil {
+		return 0, fmt.Errorf(
+			"open meteo returned no pressure for %s",
+			hour.Format(time.RFC3339),
+		)
+	}
+
+	f := t.Sub(hour).Hours()
+	if f == 0 || i+1 >= len(values) || values[i+1] == nil {
+		return *values[i], nil
+	}
+
+	return *values[i] + (*values[i+1]-*values[i])*f, nil
+}
@@ -0,0 +1,76 @@
+package weather
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestPressureGrid checks the grid is centered on the location and spans the
+// radius in each direction
+func TestPressureGrid(t *testing.T) {
+	grid := PressureGrid(42, 42, 500, 5)
+	if len(grid) != 25 {
+		t.Fatalf("got %d locations, expected 25", len(grid))
+	}
+
+	center := grid[12]
+	if math.Abs(center[0]-42) > 1e-9 || math.Abs(center[1]-42) > 1e-9 {
+		t.Errorf("got center %v, expected 42, 42", center)
+	}
+
+	// north and south edges
+	for _, edge := range [][]float64{grid[2], grid[22]} {
+		if d := Distance(42, 42, edge[1], edge[0]); math.Abs(d-500) > 1 {
+			t.Errorf("got %.1f km to %v, expected 500", d, edge)
+		}
+	}
+
+	// east and west edges
+	for _, edge := range [][]float64{grid[10], grid[14]} {
+		if d := Distance(42, 42, edge[1], edge[0]); math.Abs(d-500) > 5 {
+			t.Errorf("got %.1f km to %v, expected about 500", d, edge)
+		}
+	}
+}
+
+// TestOpenMeteoPressure checks pressure is interpolated between forecast hours
+func TestOpenMeteoPressure(t *testing.T) {
+	body := `{
+		"hourly": {
+			"time": ["2024-03-01T12:00", "2024-03-01T13:00"],
+			"pressure_msl": [1010.0, 1012.0]
+		}
+	}`
+
+	var res OpenMeteoData
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+
+	tests := []struct {
+		time string
+		want float64
+	}{
+		{"2024-03-01T12:00:00Z", 1010},
+		{"2024-03-01T12:30:00Z", 1011},
+		{"2024-03-01T13:00:00Z", 1012},
+	}
+	for _, test := range tests {
+		tm, _ := time.Parse(time.RFC3339, test.time)
+		got, err := openMeteoPressure(res, tm)
+		if err != nil {
+			t.Errorf("error getting pressure at %s: %v", test.time, err)
+			continue
+		}
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("got %f at %s, expected %f", got, test.time, test.want)
+		}
+	}
+
+	tm, _ := time.Parse(time.RFC3339, "2024-03-01T14:00:00Z")
+	if _, err := openMeteoPressure(res, tm); err == nil {
+		t.Errorf("expected error for missing hour")
+	}
+}
@@ -0,0 +1,259 @@
+package weather
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+// Capability is a kind of data a provider is able to supply
+type Capability uint
+
+const (
+	CapSurface    Capability = 1 << iota // surface observations, e.g. METAR
+	CapWindsAloft                        // winds aloft
+	CapForecast                          // forecasts, e.g. TAF
+)
+
+// ErrNoProvider is returned when no enabled provider can supply the data
+var ErrNoProvider = errors.New("no enabled provider")
+
+// Request describes the weather being requested from a provider
+type Request struct {
+	ICAO     string
+	Location []float64 // longitude, latitude
+	Time     time.Time // time the weather is wanted for, zero for now
+
+	// Refresh skips cached surface weather so a new report is seen as soon as
+	// it is issued. The response is still cached
+	Refresh bool
+}
+
+// Provider is a source of weather data. Providers are registered with
+// Register, usually from an init func, and are configured from the api.<name>
+// table of the config. A provider must also implement SurfaceProvider or
+// WindsAloftProvider to match its capabilities
+type Provider interface {
+	// Name is the name of the provider used in the config
+	Name() API
+
+	// Capabilities returns the kinds of data the provider supplies
+	Capabilities() Capability
+
+	// Configure is called once the config is read. decode unmarshals the
+	// provider's config table into v. If an error is returned the provider
+	// is disabled
+	Configure(decode func(v any) error) error
+
+	// Enabled returns whether the provider is enabled in the config
+	Enabled() bool
+}
+
+// SurfaceProvider is implemented by providers with CapSurface
+type SurfaceProvider interface {
+	Provider
+	GetWeather(req Request) (WeatherData, error)
+}
+
+// WindsAloftProvider is implemented by providers with CapWindsAloft
+type WindsAloftProvider interface {
+	Provider
+	GetWindsAloft(req Request) (WindsAloft, error)
+}
+
+// Overrider is implemented by providers whose data may be used to override
+// the data of the other providers
+type Overrider interface {
+	Override() bool
+}
+
+// Modeler is implemented by providers whose surface weather comes from a
+// weather model instead of an observation, so it is available anywhere
+type Modeler interface {
+	Modeled() bool
+}
+
+// registration tracks a registered provider and if it failed to configure
+type registration struct {
+	provider Provider
+	disabled bool
+}
+
+// registry holds all registered providers in the order they were registered
+var registry []*registration
+
+// Register adds a provider to the registry. It panics if the name is already
+// registered or if the provider does not implement its capabilities
+func Register(p Provider) {
+	if _, ok := lookup(p.Name()); ok {
+		panic(fmt.Sprintf("weather provider \"%s\" registered twice", p.Name()))
+	}
+
+	if _, ok := p.(SurfaceProvider); p.Capabilities()&CapSurface != 0 && !ok {
+		panic(fmt.Sprintf("weather provider \"%s\" does not implement SurfaceProvider", p.Name()))
+	}
+
+	if _, ok := p.(WindsAloftProvider); p.Capabilities()&CapWindsAloft != 0 && !ok {
+		panic(fmt.Sprintf("weather provider \"%s\" does not implement WindsAloftProvider", p.Name()))
+	}
+
+	registry = append(registry, &registration{provider: p})
+}
+
+// Providers returns all registered providers in order of registration
+func Providers() []Provider {
+	providers := make([]Provider, len(registry))
+	for i, r := range registry {
+		providers[i] = r.provider
+	}
+	return providers
+}
+
+// LookupProvider returns the registered provider with the given name
+func LookupProvider(name API) (Provider, bool) {
+	r, ok := lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return r.provider, true
+}
+
+// ConfigureProvider configures the named provider using decode. If the
+// provider fails to configure it is disabled
+func ConfigureProvider(name API, decode func(v any) error) error {
+	r, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("provider \"%s\" not registered", name)
+	}
+
+	if err := r.provider.Configure(decode); err != nil {
+		r.disabled = true
+		return err
+	}
+
+	r.disabled = false
+	return nil
+}
+
+// Enabled returns whether the named provider is registered, configured, and
+// enabled
+func Enabled(name API) bool {
+	r, ok := lookup(name)
+	return ok && !r.disabled && r.provider.Enabled()
+}
+
+// GetWeather gets surface weather from the first enabled provider in priority
+// order that returns data. The name of the provider used is also returned. If
+// the cache is enabled, cached responses are used within the ttl and the last
+// known good observation is used if every provider fails
+func GetWeather(req Request, priority []API) (WeatherData, API, error) {
+	return getWeather(req, priority, true)
+}
+
+// getWeather gets surface weather from the providers in priority order, using
+// the last known good observation if fallback is set and every provider fails
+func getWeather(req Request, priority []API, fallback bool) (WeatherData, API, error) {
+	err := fmt.Errorf("%w for surface weather", ErrNoProvider)
+
+	for _, name := range priority {
+		p, ok := surfaceProvider(name)
+		if !ok {
+			continue
+		}
+
+		if data, ok := cache.cachedWeather(p, req); ok {
+			return data, name, nil
+		}
+
+		var data WeatherData
+		data, err = p.GetWeather(req)
+		if err == nil {
+			cache.storeWeather(p, req, data)
+			return data, name, nil
+		}
+
+		logger.Errorf("error getting weather from %s: %v", name, err)
+	}
+
+	if !fallback {
+		return WeatherData{}, "", err
+	}
+
+	if data, name, ok := cache.lastGoodWeather(req.ICAO); ok {
+		return data, name, nil
+	}
+
+	return WeatherData{}, "", err
+}
+
+// GetWeatherFrom gets surface weather from the named provider
+func GetWeatherFrom(name API, req Request) (WeatherData, error) {
+	p, ok := surfaceProvider(name)
+	if !ok {
+		return WeatherData{}, fmt.Errorf("%w named \"%s\"", ErrNoProvider, name)
+	}
+
+	return p.GetWeather(req)
+}
+
+// GetWindsAloft gets winds aloft from the first enabled provider that returns
+// data
+func GetWindsAloft(req Request) (WindsAloft, error) {
+	err := fmt.Errorf("%w for winds aloft", ErrNoProvider)
+
+	for _, r := range registry {
+		p, ok := r.provider.(WindsAloftProvider)
+		if !ok || r.disabled || !p.Enabled() {
+			continue
+		}
+
+		if data, ok := cache.cachedWindsAloft(p, req); ok {
+			return data, nil
+		}
+
+		var data WindsAloft
+		data, err = p.GetWindsAloft(req)
+		if err == nil {
+			cache.storeWindsAloft(p, req, data)
+			return data, nil
+		}
+
+		logger.Errorf("error getting winds aloft from %s: %v", p.Name(), err)
+	}
+
+	return WindsAloft{}, err
+}
+
+// surfaceProvider returns the named provider if it is enabled and provides
+// surface weather
+func surfaceProvider(name API) (SurfaceProvider, bool) {
+	if !Enabled(name) {
+		return nil, false
+	}
+
+	r, _ := lookup(name)
+	p, ok := r.provider.(SurfaceProvider)
+	return p, ok
+}
+
+// modeled returns whether surface weather from the named provider comes from
+// a weather model
+func modeled(name API) bool {
+	r, ok := lookup(name)
+	if !ok {
+		return false
+	}
+	m, ok := r.provider.(Modeler)
+	return ok && m.Modeled()
+}
+
+func lookup(name API) (*registration, bool) {
+	for _, r := range registry {
+		if r.provider.Name() == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,85 @@
+package weather
+
+import (
+	"errors"
+	"testing"
+)
+
+// testProvider is a surface provider that returns a fixed result
+type testProvider struct {
+	name   API
+	icao   string
+	err    error
+	config struct {
+		Enable bool `toml:"enable"`
+	}
+}
+
+func (p *testProvider) Name() API                { return p.name }
+func (p *testProvider) Capabilities() Capability { return CapSurface }
+func (p *testProvider) Enabled() bool            { return p.config.Enable }
+
+func (p *testProvider) Configure(decode func(v any) error) error {
+	return decode(&p.config)
+}
+
+func (p *testProvider) GetWeather(req Request) (WeatherData, error) {
+	if p.err != nil {
+		return WeatherData{}, p.err
+	}
+	return WeatherData{NumResults: 1, Data: []Data{{ICAO: p.icao}}}, nil
+}
+
+// TestGetWeatherPriority checks that providers are tried in priority order,
+// skipping disabled providers and providers which fail
+func TestGetWeatherPriority(t *testing.T) {
+	providers := []*testProvider{
+		{name: "test-failing", err: errors.New("unavailable")},
+		{name: "test-disabled", icao: "DISA"},
+		{name: "test-misconfigured", icao: "MISC"},
+		{name: "test-working", icao: "WORK"},
+	}
+	for _, p := range providers {
+		Register(p)
+	}
+
+	enable := func(v any) error {
+		v.(*struct {
+			Enable bool `toml:"enable"`
+		}).Enable = true
+		return nil
+	}
+
+	for _, name := range []API{"test-failing", "test-working"} {
+		if err := ConfigureProvider(name, enable); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	err := ConfigureProvider("test-misconfigured", func(v any) error {
+		enable(v)
+		return errors.New("bad config")
+	})
+	if err == nil || Enabled("test-misconfigured") {
+		t.Fatalf("misconfigured provider should be disabled")
+	}
+
+	priority := []API{"test-failing", "test-disabled", "test-misconfigured", "test-working"}
+	data, name, err := GetWeather(Request{ICAO: "TEST"}, priority)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "test-working" || data.Data[0].ICAO != "WORK" {
+		t.Errorf("got weather from %s (%s), expected test-working", name, data.Data[0].ICAO)
+	}
+
+	_, _, err = GetWeather(Request{ICAO: "TEST"}, priority[:3])
+	if err == nil {
+		t.Errorf("expected error when no provider succeeds")
+	}
+
+	_, _, err = GetWeather(Request{ICAO: "TEST"}, []API{"test-disabled"})
+	if !errors.Is(err, ErrNoProvider) {
+		t.Errorf("expected ErrNoProvider, got %v", err)
+	}
+}
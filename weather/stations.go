@@ -0,0 +1,215 @@
+package weather
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+const earthRadiusKM = 6371.0
+
+// ReportingStation is a weather reporting station from the station database
+type ReportingStation struct {
+	ICAO      string
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+//go:embed stations.csv
+var stationsCSV string
+
+var (
+	stations     []ReportingStation
+	stationsOnce sync.Once
+)
+
+// Stations returns all stations in the embedded station database
+func Stations() []ReportingStation {
+	stationsOnce.Do(func() {
+		var err error
+		stations, err = parseStations(stationsCSV)
+		if err != nil {
+			// the database is embedded, so this is a build problem
+			panic(fmt.Sprintf("invalid station database: %v", err))
+		}
+	})
+
+	return stations
+}
+
+// LookupStation finds the station with the given icao in the station database
+func LookupStation(icao string) (ReportingStation, bool) {
+	for _, station := range Stations() {
+		if strings.EqualFold(station.ICAO, icao) {
+			return station, true
+		}
+	}
+	return ReportingStation{}, false
+}
+
+// NearestStations returns up to n stations within maxDistance km of the given
+// location, ordered from nearest to farthest
+func NearestStations(latitude, longitude, maxDistance float64, n int) []ReportingStation {
+	type candidate struct {
+		station  ReportingStation
+		distance float64
+	}
+
+	var candidates []candidate
+	for _, station := range Stations() {
+		d := Distance(latitude, longitude, station.Latitude, station.Longitude)
+		if d <= maxDistance {
+			candidates = append(candidates, candidate{station, d})
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.distance < b.distance:
+			return -1
+		case a.distance > b.distance:
+			return 1
+		default:
+			return strings.Compare(a.station.ICAO, b.station.ICAO)
+		}
+	})
+
+	nearest := make([]ReportingStation, 0, min(n, len(candidates)))
+	for i := 0; i < len(candidates) && i < n; i++ {
+		nearest = append(nearest, candidates[i].station)
+	}
+
+	return nearest
+}
+
+// Distance returns the great circle distance in km between two locations
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * degToRad
+	dLon := (lon2 - lon1) * degToRad
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*degToRad)*math.Cos(lat2*degToRad)*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * earthRadiusKM * math.Asin(math.Sqrt(a))
+}
+
+// GetNearestWeather gets surface weather from the nearest station to the
+// location of req which has a current report. Up to n stations within
+// maxDistance km are tried from nearest to farthest with the providers that
+// report observations. Providers of model weather, which have weather for any
+// station, are only used for the nearest station once every station has been
+// tried, then the last known good observation of the nearest station with one
+// is used. Stations are requested by icao, refreshing the cache if req does
+func GetNearestWeather(req Request, maxDistance float64, n int, priority []API) (WeatherData, API, error) {
+	if len(req.Location) < 2 {
+		return WeatherData{}, "", fmt.Errorf("no location to find the nearest station to")
+	}
+
+	longitude, latitude := req.Location[0], req.Location[1]
+	nearest := NearestStations(latitude, longitude, maxDistance, n)
+	if len(nearest) == 0 {
+		return WeatherData{}, "", fmt.Errorf(
+			"no stations within %.0f km of %.4f, %.4f",
+			maxDistance,
+			latitude,
+			longitude,
+		)
+	}
+
+	var observed, models []API
+	for _, name := range priority {
+		if modeled(name) {
+			models = append(models, name)
+		} else {
+			observed = append(observed, name)
+		}
+	}
+
+	err := fmt.Errorf("%w for surface weather", ErrNoProvider)
+	if len(observed) > 0 {
+		for _, station := range nearest {
+			logger.Infof(
+				"trying nearest station %s (%s) %.0f km away...",
+				station.ICAO,
+				station.Name,
+				Distance(latitude, longitude, station.Latitude, station.Longitude),
+			)
+
+			var data WeatherData
+			var name API
+			data, name, err = getWeather(Request{ICAO: station.ICAO, Refresh: req.Refresh}, observed, false)
+			if err == nil {
+				return data, name, nil
+			}
+
+			logger.Warnf("no current report for %s: %v", station.ICAO, err)
+		}
+	}
+
+	if len(models) > 0 {
+		logger.Infof("no station has a current report, using model weather for %s", nearest[0].ICAO)
+
+		data, name, modelErr := getWeather(Request{ICAO: nearest[0].ICAO, Refresh: req.Refresh}, models, false)
+		if modelErr == nil {
+			return data, name, nil
+		}
+		err = modelErr
+	}
+
+	for _, station := range nearest {
+		if data, name, ok := cache.lastGoodWeather(station.ICAO); ok {
+			return data, name, nil
+		}
+	}
+
+	return WeatherData{}, "", err
+}
+
+// parseStations parses the station database
+func parseStations(text string) ([]ReportingStation, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 1 {
+		return nil, fmt.Errorf("missing header")
+	}
+
+	var result []ReportingStation
+	for _, record := range records[1:] {
+		if len(record) < 4 {
+			return nil, fmt.Errorf("station %v has too few fields", record)
+		}
+
+		latitude, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("station %s has invalid latitude: %v", record[0], err)
+		}
+
+		longitude, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("station %s has invalid longitude: %v", record[0], err)
+		}
+
+		result = append(result, ReportingStation{
+			ICAO:      record[0],
+			Name:      record[1],
+			Latitude:  latitude,
+			Longitude: longitude,
+		})
+	}
+
+	return result, nil
+}
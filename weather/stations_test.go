@@ -0,0 +1,105 @@
+package weather
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+// TestStations checks the embedded station database is valid
+func TestStations(t *testing.T) {
+	seen := map[string]bool{}
+	for _, station := range Stations() {
+		if !metarICAORE.MatchString(station.ICAO) {
+			t.Errorf("invalid icao \"%s\"", station.ICAO)
+		}
+		if seen[station.ICAO] {
+			t.Errorf("duplicate station %s", station.ICAO)
+		}
+		seen[station.ICAO] = true
+
+		if station.Latitude < -90 || station.Latitude > 90 ||
+			station.Longitude < -180 || station.Longitude > 180 {
+			t.Errorf("station %s has invalid location", station.ICAO)
+		}
+	}
+
+	if len(seen) == 0 {
+		t.Fatalf("station database is empty")
+	}
+}
+
+// TestNearestStations checks stations are found nearest first
+func TestNearestStations(t *testing.T) {
+	// between Kutaisi and Batumi, closer to Kutaisi
+	nearest := NearestStations(42.0, 42.2, 150, 3)
+	if len(nearest) != 3 {
+		t.Fatalf("got %d stations, expected 3", len(nearest))
+	}
+	if nearest[0].ICAO != "UGKO" || nearest[1].ICAO != "UGSB" {
+		t.Errorf("got %s, %s, expected UGKO, UGSB", nearest[0].ICAO, nearest[1].ICAO)
+	}
+
+	// nothing in the middle of the pacific
+	if nearest := NearestStations(0, -150, 500, 5); len(nearest) != 0 {
+		t.Errorf("expected no stations, got %v", nearest)
+	}
+
+	// Las Vegas to Nellis is about 20 km
+	if d := Distance(36.0840, -115.1537, 36.2362, -115.0343); math.Abs(d-20) > 1 {
+		t.Errorf("got distance %f, expected ~20", d)
+	}
+}
+
+// stationProvider is a surface provider with weather for some stations only
+type stationProvider struct {
+	testProvider
+	stations []string
+	model    bool
+}
+
+func (p *stationProvider) Modeled() bool { return p.model }
+
+func (p *stationProvider) GetWeather(req Request) (WeatherData, error) {
+	if !slices.Contains(p.stations, req.ICAO) {
+		return WeatherData{}, errors.New("no report")
+	}
+	return WeatherData{NumResults: 1, Data: []Data{{ICAO: req.ICAO, ID: string(p.name)}}}, nil
+}
+
+// TestGetNearestWeather checks stations are tried outward with the providers
+// of observations before model weather is used
+func TestGetNearestWeather(t *testing.T) {
+	observations := &stationProvider{testProvider: testProvider{name: "test-nearest-observed"}}
+	model := &stationProvider{testProvider: testProvider{name: "test-nearest-model"}, model: true}
+	for _, p := range []*stationProvider{observations, model} {
+		p.config.Enable = true
+		Register(p)
+	}
+
+	// model first, as if it were ahead of the observations in the priority
+	priority := []API{"test-nearest-model", "test-nearest-observed"}
+
+	// between Kutaisi and Batumi, closer to Kutaisi, only Batumi reports
+	observations.stations = []string{"UGSB"}
+	model.stations = []string{"UGKO", "UGSB"}
+
+	data, name, err := GetNearestWeather(Request{Location: []float64{42.2, 42.0}}, 150, 3, priority)
+	if err != nil || name != "test-nearest-observed" || data.Data[0].ICAO != "UGSB" {
+		t.Fatalf("expected observation for UGSB, got %v from %s: %v", data, name, err)
+	}
+
+	// no station reports, the model is used for the nearest station
+	observations.stations = nil
+	data, name, err = GetNearestWeather(Request{Location: []float64{42.2, 42.0}}, 150, 3, priority)
+	if err != nil || name != "test-nearest-model" || data.Data[0].ICAO != "UGKO" {
+		t.Fatalf("expected model weather for UGKO, got %v from %s: %v", data, name, err)
+	}
+
+	// nothing works
+	model.stations = nil
+	if _, _, err := GetNearestWeather(Request{Location: []float64{42.2, 42.0}}, 150, 3, priority); err == nil {
+		t.Errorf("expected error when no provider has weather")
+	}
+}
@@ -0,0 +1,277 @@
+package weather
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evogelsa/DCS-real-weather/v2/logger"
+)
+
+// regular expressions for TAF specific groups
+var (
+	tafValidityRE    = regexp.MustCompile(`^(\d{2})(\d{2})/(\d{2})(\d{2})$`)
+	tafFromRE        = regexp.MustCompile(`^FM(\d{2})(\d{2})(\d{2})$`)
+	tafProbabilityRE = regexp.MustCompile(`^PROB(\d{2})$`)
+	tafTemperatureRE = regexp.MustCompile(`^T[XN]M?\d{2}/\d{4}Z$`)
+)
+
+type ForecastChange string
+
+const (
+	ForecastBase     ForecastChange = "BASE"
+	ForecastFrom     ForecastChange = "FM"
+	ForecastBecoming ForecastChange = "BECMG"
+	ForecastTempo    ForecastChange = "TEMPO"
+	ForecastProb     ForecastChange = "PROB"
+)
+
+// Forecast is a decoded TAF
+type Forecast struct {
+	ICAO    string           `json:"icao,omitempty"`
+	RawText string           `json:"raw_text,omitempty"`
+	Issued  time.Time        `json:"issued"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Periods []ForecastPeriod `json:"periods,omitempty"`
+}
+
+// ForecastPeriod is a single group of a TAF. The first period is always the
+// base forecast, and each following period is a change group
+type ForecastPeriod struct {
+	Change      ForecastChange `json:"change"`
+	Probability int            `json:"probability,omitempty"` // PROB30/PROB40
+	Tempo       bool           `json:"tempo,omitempty"`       // PROB30 TEMPO
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Data        Data           `json:"data"`
+}
+
+// DecodeTAF decodes a raw TAF. The issue day of the TAF is resolved against
+// ref, which should be a time at or shortly after the TAF was issued
+func DecodeTAF(raw string, ref time.Time) (*Forecast, error) {
+	tokens := strings.Fields(strings.TrimSuffix(strings.TrimSpace(raw), "="))
+
+	f := &Forecast{RawText: strings.Join(tokens, " ")}
+
+	i := 0
+
+	// report type and amendments are optional
+	for i < len(tokens) && (tokens[i] == "TAF" || tokens[i] == "AMD" || tokens[i] == "COR") {
+		i++
+	}
+
+	// station identifier
+	if i >= len(tokens) || !metarICAORE.MatchString(tokens[i]) {
+		return nil, fmt.Errorf("missing station identifier")
+	}
+	f.ICAO = tokens[i]
+	i++
+
+	// issue time, may be omitted by some sources
+	if i < len(tokens) && metarTimeRE.MatchString(tokens[i]) {
+		issued, err := decodeMETARTime(tokens[i], ref)
+		if err != nil {
+			return nil, err
+		}
+		f.Issued = issued
+		i++
+	} else {
+		f.Issued = ref.UTC().Truncate(time.Hour)
+	}
+
+	// validity period
+	if i >= len(tokens) || !tafValidityRE.MatchString(tokens[i]) {
+		return nil, fmt.Errorf("missing validity period")
+	}
+	f.From, f.To = decodeTAFPeriod(tokens[i], f.Issued)
+	i++
+
+	if i < len(tokens) && tokens[i] == "NIL" {
+		return nil, fmt.Errorf("TAF for %s is NIL", f.ICAO)
+	}
+
+	f.Periods = []ForecastPeriod{{Change: ForecastBase, From: f.From, To: f.To}}
+	period := &f.Periods[0]
+
+	for ; i < len(tokens); i++ {
+		token := tokens[i]
+
+		switch {
+		case token == "RMK":
+			i = len(tokens)
+			continue
+
+		case tafFromRE.MatchString(token):
+			m := tafFromRE.FindStringSubmatch(token)
+			day, _ := strconv.Atoi(m[1])
+			hour, _ := strconv.Atoi(m[2])
+			minute, _ := strconv.Atoi(m[3])
+			from := resolveTAFTime(day, hour, f.Issued).Add(time.Duration(minute) * time.Minute)
+
+			f.Periods = append(f.Periods, ForecastPeriod{Change: ForecastFrom, From: from, To: f.To})
+			period = &f.Periods[len(f.Periods)-1]
+			continue
+
+		case token == "BECMG" || token == "TEMPO":
+			p := ForecastPeriod{Change: ForecastChange(token)}
+			if i+1 < len(tokens) && tafValidityRE.MatchString(tokens[i+1]) {
+				p.From, p.To = decodeTAFPeriod(tokens[i+1], f.Issued)
+				i++
+			}
+			f.Periods = append(f.Periods, p)
+			period = &f.Periods[len(f.Periods)-1]
+			continue
+
+		case tafProbabilityRE.MatchString(token):
+			p := ForecastPeriod{Change: ForecastProb}
+			p.Probability, _ = strconv.Atoi(tafProbabilityRE.FindStringSubmatch(token)[1])
+			if i+1 < len(tokens) && tokens[i+1] == "TEMPO" {
+				p.Tempo = true
+				i++
+			}
+			if i+1 < len(tokens) && tafValidityRE.MatchString(tokens[i+1]) {
+				p.From, p.To = decodeTAFPeriod(tokens[i+1], f.Issued)
+				i++
+			}
+			f.Periods = append(f.Periods, p)
+			period = &f.Periods[len(f.Periods)-1]
+			continue
+
+		case tafTemperatureRE.MatchString(token):
+			// max and min temperature forecasts are not used
+			continue
+		}
+
+		n := decodeMETARGroup(&period.Data, tokens[i:])
+		if n == 0 {
+			logger.Debugf("ignoring unrecognized TAF group \"%s\"", token)
+			continue
+		}
+		i += n - 1
+	}
+
+	// each FM group lasts until the next one starts
+	var last *ForecastPeriod
+	for i := range f.Periods {
+		if f.Periods[i].Change != ForecastFrom {
+			continue
+		}
+		if last != nil {
+			last.To = f.Periods[i].From
+		}
+		last = &f.Periods[i]
+	}
+
+	return f, nil
+}
+
+// decodeTAFPeriod decodes a DDHH/DDHH period relative to the issue time
+func decodeTAFPeriod(token string, issued time.Time) (from, to time.Time) {
+	m := tafValidityRE.FindStringSubmatch(token)
+	fromDay, _ := strconv.Atoi(m[1])
+	fromHour, _ := strconv.Atoi(m[2])
+	toDay, _ := strconv.Atoi(m[3])
+	toHour, _ := strconv.Atoi(m[4])
+
+	return resolveTAFTime(fromDay, fromHour, issued), resolveTAFTime(toDay, toHour, issued)
+}
+
+// resolveTAFTime resolves a day and hour into a time using the month of the
+// issue time. Days before the issue day are in the following month, and an
+// hour of 24 is midnight at the end of the day
+func resolveTAFTime(day, hour int, issued time.Time) time.Time {
+	year, month := issued.Year(), issued.Month()
+
+	// allow a day of slack since TAFs may be issued just before they are valid
+	if day < issued.Day()-1 {
+		month++
+	}
+
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+}
+
+// Prevailing returns the conditions forecast to prevail at the given time.
+// The base forecast is modified by any FM groups which have started and any
+// BECMG groups which have finished their transition. TEMPO and PROB groups
+// describe temporary fluctuations so they are not included
+func (f *Forecast) Prevailing(at time.Time) (Data, error) {
+	if at.Before(f.From) || !at.Before(f.To) {
+		return Data{}, fmt.Errorf(
+			"%s is outside of forecast validity %s to %s",
+			at.Format(time.RFC3339),
+			f.From.Format(time.RFC3339),
+			f.To.Format(time.RFC3339),
+		)
+	}
+
+	var data Data
+	for _, p := range f.Periods {
+		switch p.Change {
+		case ForecastBase:
+			overlayForecast(&data, p.Data)
+		case ForecastFrom:
+			if !at.Before(p.From) {
+				data = Data{}
+				overlayForecast(&data, p.Data)
+			}
+		case ForecastBecoming:
+			if !at.Before(p.To) {
+				overlayForecast(&data, p.Data)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// ApplyForecast replaces the wind, visibility, weather and clouds of the
+// observation with those forecast to prevail at the given time. Temperature
+// and pressure are not forecast and are left as observed
+func ApplyForecast(data *WeatherData, at time.Time) error {
+	if data.NumResults < 1 || len(data.Data) < 1 {
+		return fmt.Errorf("no data to apply forecast to")
+	}
+
+	if data.Forecast == nil {
+		return fmt.Errorf("no forecast available for %s", data.Data[0].ICAO)
+	}
+
+	prevailing, err := data.Forecast.Prevailing(at)
+	if err != nil {
+		return err
+	}
+
+	overlayForecast(&data.Data[0], prevailing)
+
+	return nil
+}
+
+// overlayForecast replaces each element of dst with the element in src if
+// src contains it. NSW clears the weather of dst
+func overlayForecast(dst *Data, src Data) {
+	if src.Wind != nil {
+		wind := *src.Wind
+		dst.Wind = &wind
+	}
+
+	if src.Visibility != nil {
+		visibility := *src.Visibility
+		dst.Visibility = &visibility
+	}
+
+	if len(src.Conditions) > 0 {
+		dst.Conditions = nil
+		for _, condition := range src.Conditions {
+			if condition.Code != "NSW" {
+				dst.Conditions = append(dst.Conditions, condition)
+			}
+		}
+	}
+
+	if len(src.Clouds) > 0 {
+		dst.Clouds = append([]Clouds(nil), src.Clouds...)
+	}
+}
@@ -0,0 +1,75 @@
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+// TestForecastPrevailing decodes a TAF and checks the prevailing conditions
+// at several times within it
+func TestForecastPrevailing(t *testing.T) {
+	const raw = "TAF AMD KJFK 121720Z 1218/1324 31015G25KT P6SM SCT050 " +
+		"TEMPO 1218/1222 3SM -SHRA BKN020 " +
+		"FM130200 30010KT 6SM BR OVC008 " +
+		"BECMG 1306/1308 P6SM NSW BKN030 " +
+		"PROB30 1320/1324 TSRA " +
+		"FM131800 VRB03KT P6SM SKC"
+
+	ref := time.Date(2024, time.April, 12, 18, 0, 0, 0, time.UTC)
+
+	f, err := DecodeTAF(raw, ref)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if f.ICAO != "KJFK" || len(f.Periods) != 6 {
+		t.Fatalf("got %s with %d periods, expected KJFK with 6", f.ICAO, len(f.Periods))
+	}
+
+	if !f.To.Equal(time.Date(2024, time.April, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("validity ends %v", f.To)
+	}
+
+	tests := []struct {
+		at         time.Time
+		speed      float64
+		visibility float64
+		conditions int
+		cloud      string
+	}{
+		// base forecast, tempo is ignored
+		{time.Date(2024, time.April, 12, 20, 0, 0, 0, time.UTC), 15 * KtToMPS, 6 * MilesToMeters, 0, "SCT"},
+		// first FM group
+		{time.Date(2024, time.April, 13, 3, 0, 0, 0, time.UTC), 10 * KtToMPS, 6 * MilesToMeters, 1, "OVC"},
+		// during BECMG transition the FM group still prevails
+		{time.Date(2024, time.April, 13, 7, 0, 0, 0, time.UTC), 10 * KtToMPS, 6 * MilesToMeters, 1, "OVC"},
+		// after BECMG, wind is unchanged but weather and clouds update
+		{time.Date(2024, time.April, 13, 9, 0, 0, 0, time.UTC), 10 * KtToMPS, 6 * MilesToMeters, 0, "BKN"},
+		// last FM group
+		{time.Date(2024, time.April, 13, 21, 0, 0, 0, time.UTC), 3 * KtToMPS, 6 * MilesToMeters, 0, "SKC"},
+	}
+
+	for _, test := range tests {
+		data, err := f.Prevailing(test.at)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.at, err)
+		}
+
+		if !approx(data.Wind.SpeedMPS, test.speed) {
+			t.Errorf("%v: wind got %v expected %v", test.at, data.Wind.SpeedMPS, test.speed)
+		}
+		if !approx(data.Visibility.MetersFloat, test.visibility) {
+			t.Errorf("%v: visibility got %v expected %v", test.at, data.Visibility.MetersFloat, test.visibility)
+		}
+		if len(data.Conditions) != test.conditions {
+			t.Errorf("%v: conditions got %v expected %d", test.at, data.Conditions, test.conditions)
+		}
+		if len(data.Clouds) == 0 || data.Clouds[0].Code != test.cloud {
+			t.Errorf("%v: clouds got %v expected %s", test.at, data.Clouds, test.cloud)
+		}
+	}
+
+	if _, err := f.Prevailing(f.To); err == nil {
+		t.Errorf("expected error outside of validity")
+	}
+}
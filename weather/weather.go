@@ -3,18 +3,19 @@ package weather
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
 	"time"
 
 	"github.com/evogelsa/DCS-real-weather/v2/logger"
 )
 
+// CloudPreset is a DCS cloud preset. Name is quoted as in the mission file
 type CloudPreset struct {
-	Name    string
-	MinBase int
-	MaxBase int
+	Name      string
+	MinBase   int  // meters
+	MaxBase   int  // meters
+	Thickness int  // meters
+	Snow      bool // precipitation turns to snow below freezing
 }
 
 type Cloud struct {
@@ -22,28 +23,13 @@ type Cloud struct {
 	Base string
 }
 
-type OpenMeteoData struct {
-	Latitude         float64 `json:"latitude"`
-	Longitude        float64 `json:"longitude"`
-	Elevation        float64 `json:"elevation"`
-	GenerationTime   float64 `json:"generationtime_ms"`
-	UTCOffsetSeconds int     `json:"utc_offset_seconds"`
-	Timezone         string  `json:"timezone"`
-	TimezoneAbbr     string  `json:"timezone_abbreviation"`
-	Hourly           struct {
-		Time              []string  `json:"time"`
-		WindSpeed1900     []float64 `json:"windspeed_800hPa"`
-		WindSpeed7200     []float64 `json:"windspeed_400hPa"`
-		WindDirection1900 []int     `json:"winddirection_800hPa"`
-		WindDirection7200 []int     `json:"winddirection_400hPa"`
-	} `json:"hourly"`
-}
-
+// WindsAloft is the wind at the heights DCS uses for winds aloft, 2000 m and
+// 8000 m MSL
 type WindsAloft struct {
-	WindSpeed1900     float64
-	WindSpeed7200     float64
-	WindDirection1900 int
-	WindDirection7200 int
+	WindSpeed2000     float64
+	WindSpeed8000     float64
+	WindDirection2000 int
+	WindDirection8000 int
 }
 
 type Fog string
@@ -54,12 +40,18 @@ const (
 	FogLegacy Fog = "legacy"
 )
 
+// ICAOAuto selects the nearest station to the configured location
+const ICAOAuto = "auto"
+
 type API string
 
 const (
 	APICheckWX         API = "checkwx"
 	APIAviationWeather API = "aviationweather"
 	APICustom          API = "custom"
+	APIMETAR           API = "metar"
+	APIArchive         API = "archive"
+	APIOpenMeteo       API = "openmeteo"
 )
 
 const (
@@ -86,94 +78,6 @@ var (
 	SelectedBase   int
 )
 
-var CloudPresets map[string][]CloudPreset = map[string][]CloudPreset{
-	"FEW": {
-		{`"Preset1"`, 840, 4200},  // Light Scattered 1
-		{`"Preset2"`, 1260, 2520}, // Light Scattered 2
-	},
-	"SCT": {
-		{`"Preset3"`, 840, 2520},   // High Scattered 1
-		{`"Preset4"`, 1260, 2520},  // High Scattered 2
-		{`"Preset5"`, 1260, 4620},  // Scattered 1
-		{`"Preset6"`, 1260, 4200},  // Scattered 2
-		{`"Preset7"`, 1680, 5040},  // Scattered 3
-		{`"Preset8"`, 3780, 5460},  // High Scattered 3
-		{`"Preset9"`, 1680, 3780},  // Scattered 4
-		{`"Preset10"`, 1260, 4200}, // Scattered 5
-		{`"Preset11"`, 2520, 5460}, // Scattered 6
-		{`"Preset12"`, 1680, 3360}, // Scattered 7
-	},
-	"SCT+RA": {
-		{`"RainyPreset4"`, 1260, 4200},  // Light Rain 1
-		{`"NEWRAINPRESET4"`, 840, 5174}, // Light Rain 4
-	},
-	"BKN": {
-		{`"Preset13"`, 1680, 3360}, // Broken 1
-		{`"Preset14"`, 1680, 3360}, // Broken 2
-		{`"Preset15"`, 840, 5040},  // Broken 3
-		{`"Preset16"`, 1260, 4200}, // Broken 4
-		{`"Preset17"`, 0, 2520},    // Broken 5
-		{`"Preset18"`, 0, 3780},    // Broken 6
-		{`"Preset19"`, 0, 2940},    // Broken 7
-		{`"Preset20"`, 0, 3780},    // Broken 8
-	},
-	"BKN+RA": {
-		{`"RainyPreset5"`, 1260, 2520}, // Light Rain 2
-	},
-	"OVC": {
-		{`"Preset21"`, 1260, 4200}, // Overcast 1
-		{`"Preset22"`, 420, 4200},  // Overcast 2
-		{`"Preset23"`, 840, 3360},  // Overcast 3
-		{`"Preset24"`, 420, 2520},  // Overcast 4
-		{`"Preset25"`, 420, 3360},  // Overcast 5
-		{`"Preset26"`, 420, 2940},  // Overcast 6
-		{`"Preset27"`, 420, 2520},  // Overcast 7
-	},
-	"OVC+RA": {
-		{`"RainyPreset1"`, 420, 2940},  // Overcast And Rain 1
-		{`"RainyPreset2"`, 840, 2520},  // Overcast And Rain 2
-		{`"RainyPreset3"`, 840, 2520},  // Overcast And Rain 3
-		{`"RainyPreset6"`, 1260, 2940}, // Light Rain 3
-	},
-}
-
-var DecodePreset = map[string][]Cloud{
-	`"Preset1"`:        {{"FEW", "070"}},
-	`"Preset2"`:        {{"FEW", "080"}, {"SCT", "230"}},
-	`"Preset3"`:        {{"SCT", "080"}, {"FEW", "210"}},
-	`"Preset4"`:        {{"SCT", "080"}, {"SCT", "240"}},
-	`"Preset5"`:        {{"SCT", "140"}, {"FEW", "270"}, {"BKN", "400"}},
-	`"Preset6"`:        {{"SCT", "080"}, {"FEW", "400"}},
-	`"Preset7"`:        {{"BKN", "075"}, {"SCT", "210"}, {"SCT", "400"}},
-	`"Preset8"`:        {{"SCT", "180"}, {"FEW", "360"}, {"FEW", "400"}},
-	`"Preset9"`:        {{"BKN", "075"}, {"SCT", "200"}, {"FEW", "410"}},
-	`"Preset10"`:       {{"SCT", "180"}, {"FEW", "360"}, {"FEW", "400"}},
-	`"Preset11"`:       {{"BKN", "180"}, {"BKN", "320"}, {"FEW", "410"}},
-	`"Preset12"`:       {{"BKN", "120"}, {"SCT", "220"}, {"FEW", "410"}},
-	`"Preset13"`:       {{"BKN", "120"}, {"BKN", "260"}, {"FEW", "410"}},
-	`"Preset14"`:       {{"BKN", "070"}, {"FEW", "410"}},
-	`"Preset15"`:       {{"SCT", "140"}, {"BKN", "240"}, {"FEW", "400"}},
-	`"Preset16"`:       {{"BKN", "140"}, {"BKN", "280"}, {"FEW", "400"}},
-	`"Preset17"`:       {{"BKN", "070"}, {"BKN", "200"}, {"BKN", "320"}},
-	`"Preset18"`:       {{"BKN", "130"}, {"BKN", "250"}, {"BKN", "380"}},
-	`"Preset19"`:       {{"OVC", "090"}, {"BKN", "230"}, {"BKN", "310"}},
-	`"Preset20"`:       {{"BKN", "130"}, {"BKN", "280"}, {"FEW", "380"}},
-	`"Preset21"`:       {{"BKN", "070"}, {"OVC", "170"}},
-	`"Preset22"`:       {{"OVC", "070"}, {"BKN", "170"}},
-	`"Preset23"`:       {{"OVC", "110"}, {"BKN", "180"}, {"SCT", "320"}},
-	`"Preset24"`:       {{"OVC", "030"}, {"OVC", "170"}, {"BKN", "340"}},
-	`"Preset25"`:       {{"OVC", "120"}, {"OVC", "220"}, {"OVC", "400"}},
-	`"Preset26"`:       {{"OVC", "090"}, {"BKN", "230"}, {"SCT", "320"}},
-	`"Preset27"`:       {{"OVC", "080"}, {"BKN", "250"}, {"BKN", "340"}},
-	`"RainyPreset1"`:   {{"OVC", "030"}, {"OVC", "280"}, {"FEW", "400"}},
-	`"RainyPreset2"`:   {{"OVC", "030"}, {"SCT", "180"}, {"FEW", "400"}},
-	`"RainyPreset3"`:   {{"OVC", "060"}, {"OVC", "190"}, {"SCT", "340"}},
-	`"RainyPreset4"`:   {{"SCT", "080"}, {"FEW", "360"}},
-	`"RainyPreset5"`:   {{"BKN", "070"}, {"BKN", "200"}, {"BKN", "320"}},
-	`"RainyPreset6"`:   {{"OVC", "090"}, {"BKN", "230"}, {"BKN", "310"}},
-	`"NEWRAINPRESET4"`: {{"SCT", "080"}, {"SCT", "120"}},
-}
-
 var DefaultWeather WeatherData = WeatherData{
 	Data: []Data{
 		{
@@ -201,7 +105,7 @@ var DefaultWeather WeatherData = WeatherData{
 			},
 			ICAO: "DGAA",
 			Visibility: &Visibility{
-				MetersFloat: 9000,
+				MetersFloat: 9999, // 10 km or more
 			},
 			Dewpoint: &Dewpoint{
 				Celsius: 10,
@@ -230,7 +134,6 @@ func FogCodes() []string {
 
 func DustCodes() []string {
 	return []string{
-		"HZ", // haze
 		"DU", // widespread dust
 		"SA", // sand
 		"PO", // dust/sand whirls
@@ -239,6 +142,14 @@ func DustCodes() []string {
 	}
 }
 
+// HazeCodes are obscurations which only reduce visibility
+func HazeCodes() []string {
+	return []string{
+		"HZ", // haze
+		"FU", // smoke
+	}
+}
+
 func PrecipCodes() []string {
 	return []string{
 		"RA", // rain
@@ -253,6 +164,18 @@ func PrecipCodes() []string {
 	}
 }
 
+// SnowCodes are the precipitation codes of frozen precipitation
+func SnowCodes() []string {
+	return []string{
+		"SN", // snow
+		"SG", // snow grains
+		"GS", // snow pellets or small hail
+		"GR", // hail
+		"PL", // ice pellets
+		"IC", // ice crystals
+	}
+}
+
 func StormCodes() []string {
 	return []string{
 		"TS", // thunderstorm
@@ -286,106 +209,20 @@ func QNHToQFF(qnh, elevation, temperature, latitude float64) float64 {
 	return qff
 }
 
-func GetWindsAloft(location []float64) (WindsAloft, error) {
-	logger.Infoln("getting winds aloft data from open meteo...")
-
-	// create http client to fetch weather data, timeout after 5 sec
-	timeout := time.Duration(5 * time.Second)
-	client := http.Client{Timeout: timeout}
-
-	request, err := http.NewRequest(
-		"GET",
-		"https://api.open-meteo.com/v1/forecast",
-		nil,
-	)
+// Clone returns a deep copy of the weather data, so it can be changed for one
+// mission without changing it for others
+func (wx WeatherData) Clone() (WeatherData, error) {
+	b, err := json.Marshal(wx)
 	if err != nil {
-		return WindsAloft{}, err
+		return WeatherData{}, fmt.Errorf("error copying weather: %v", err)
 	}
 
-	// add query parameters
-	q := request.URL.Query()
-	q.Add("latitude", fmt.Sprintf("%.6f", location[1]))
-	q.Add("longitude", fmt.Sprintf("%.6f", location[0]))
-	q.Add("hourly", "windspeed_800hPa,windspeed_400hPa,winddirection_800hPa,winddirection_400hPa")
-	q.Add("wind_speed_unit", "ms")
-
-	request.URL.RawQuery = q.Encode()
-
-	// make request
-	resp, err := client.Do(request)
-	if err != nil {
-		return WindsAloft{}, err
-	}
-
-	// verify response
-	if resp.StatusCode != http.StatusOK {
-		return WindsAloft{}, fmt.Errorf("open meteo bad status: %v", resp.Status)
-	}
-
-	// parse response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return WindsAloft{}, fmt.Errorf("error parsing open meteo response: %v", err)
-	}
-
-	logger.Infoln("got winds aloft data")
-	logger.Infoln("parsing winds aloft data...")
-
-	// format response into winds aloft struct
-	var res OpenMeteoData
-	err = json.Unmarshal(body, &res)
-	if err != nil {
-		return WindsAloft{}, err
-	}
-
-	// get current time
-	t := time.Now().UTC().Format("2006-01-02T15") + ":00"
-
-	// find index of current timestamp
-	var i int
-	var ts string
-	for i, ts = range res.Hourly.Time {
-		if t == ts {
-			break
-		}
+	var clone WeatherData
+	if err := json.Unmarshal(b, &clone); err != nil {
+		return WeatherData{}, fmt.Errorf("error copying weather: %v", err)
 	}
 
-	// create return windspeed and winddir arrays
-	data := WindsAloft{
-		WindSpeed1900:     res.Hourly.WindSpeed1900[i],
-		WindSpeed7200:     res.Hourly.WindSpeed7200[i],
-		WindDirection1900: res.Hourly.WindDirection1900[i],
-		WindDirection7200: res.Hourly.WindDirection7200[i],
-	}
-
-	logger.Infow(
-		"parsed winds aloft:",
-		"1900-meters", map[string]any{
-			"mps": res.Hourly.WindSpeed1900[i],
-			"dir": res.Hourly.WindDirection1900[i],
-		},
-		"7200-meters", map[string]any{
-			"mps": res.Hourly.WindSpeed7200[i],
-			"dir": res.Hourly.WindDirection7200[i],
-		},
-	)
-
-	return data, nil
-}
-
-// GetWeather calls the appropriate function to get weather from the desired
-// API.
-func GetWeather(icao string, api API, meta any) (WeatherData, error) {
-	switch api {
-	case APIAviationWeather:
-		return getWeatherAviationWeather(icao)
-	case APICheckWX:
-		return getWeatherCheckWX(icao, meta.(string))
-	case APICustom:
-		return getWeatherCustom(meta.(string))
-	default:
-		return WeatherData{}, fmt.Errorf("invalid API provider")
-	}
+	return clone, nil
 }
 
 // ValidateWeather takes in weather data from the API and checks the first
@@ -423,12 +260,9 @@ func ValidateWeather(data *WeatherData) error {
 	}
 
 	if data.Data[0].Visibility == nil {
-		logger.Warnln("no visibility data, defaulting to 10+ SM")
+		logger.Warnln("no visibility data, defaulting to 10 km or more")
 		data.Data[0].Visibility = &Visibility{
-			// Miles:       "Greater than 10 miles",
-			// MilesFloat:  10,
-			// Meters:      "Greater than 9000 meters",
-			MetersFloat: 9000,
+			MetersFloat: 9999, // 10 km or more
 		}
 	}
 
@@ -441,6 +275,17 @@ func ValidateWeather(data *WeatherData) error {
 		}
 	}
 
+	if data.Data[0].Station == nil {
+		if station, ok := LookupStation(data.Data[0].ICAO); ok {
+			logger.Infof("no station data, using location of %s from station database", station.ICAO)
+			data.Data[0].Station = &Station{
+				Geometry: &Geometry{
+					Coordinates: []float64{station.Longitude, station.Latitude},
+				},
+			}
+		}
+	}
+
 	if data.Data[0].Station == nil {
 		logger.Warnln("no station data, defaulting to (0, 0)")
 		data.Data[0].Station = &Station{
@@ -519,7 +364,7 @@ func GenerateMETAR(wx WeatherData, rmk string) (string, error) {
 
 	// conditions
 	for _, cond := range data.Conditions {
-		metar += fmt.Sprintf("%s ", cond.Code)
+		metar += fmt.Sprintf("%s%s ", cond.Prefix, cond.Code)
 	}
 
 	// clouds
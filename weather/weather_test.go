@@ -0,0 +1,43 @@
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+// TestClone checks changing a clone does not change the original
+func TestClone(t *testing.T) {
+	data := WeatherData{
+		NumResults: 1,
+		Data: []Data{{
+			ICAO:      "KJFK",
+			Barometer: &Barometer{Hg: 29.92},
+			Clouds:    []Clouds{{Code: "BKN", Meters: 1200}},
+			Wind:      &Wind{Degrees: 270, SpeedMPS: 5},
+		}},
+		Forecast: &Forecast{
+			ICAO: "KJFK",
+			From: time.Date(2024, time.April, 13, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	clone, err := data.Clone()
+	if err != nil {
+		t.Fatalf("error cloning weather: %v", err)
+	}
+
+	if clone.Data[0].ICAO != "KJFK" || clone.Data[0].Barometer.Hg != 29.92 ||
+		!clone.Forecast.From.Equal(data.Forecast.From) {
+		t.Fatalf("got %+v, expected a copy of %+v", clone, data)
+	}
+
+	clone.Data[0].Barometer.Hg = 30.12
+	clone.Data[0].Clouds[0].Meters = 300
+	clone.Data[0].Wind.SpeedMPS = 10
+	clone.Forecast.ICAO = "KLGA"
+
+	if data.Data[0].Barometer.Hg != 29.92 || data.Data[0].Clouds[0].Meters != 1200 ||
+		data.Data[0].Wind.SpeedMPS != 5 || data.Forecast.ICAO != "KJFK" {
+		t.Errorf("changing clone changed original: %+v", data.Data[0])
+	}
+}
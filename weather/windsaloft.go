@@ -0,0 +1,119 @@
+package weather
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Heights in meters MSL of the winds aloft used by DCS
+const (
+	WindsAloftLowMeters  = 2000
+	WindsAloftHighMeters = 8000
+)
+
+// WindLevel is the wind at a height in meters MSL, usually from a pressure
+// level of a weather model
+type WindLevel struct {
+	Meters    float64
+	SpeedMPS  float64
+	Direction float64 // degrees from
+}
+
+// InterpolateWind interpolates the wind of a profile to the given height.
+// Speed is interpolated linearly with height and direction is interpolated
+// along the shorter way around. Heights outside the profile use the nearest
+// level
+func InterpolateWind(levels []WindLevel, meters float64) (WindLevel, error) {
+	if len(levels) == 0 {
+		return WindLevel{}, fmt.Errorf("no wind levels to interpolate")
+	}
+
+	levels = slices.Clone(levels)
+	slices.SortFunc(levels, func(a, b WindLevel) int {
+		switch {
+		case a.Meters < b.Meters:
+			return -1
+		case a.Meters > b.Meters:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	if meters <= levels[0].Meters {
+		return WindLevel{meters, levels[0].SpeedMPS, levels[0].Direction}, nil
+	}
+
+	last := levels[len(levels)-1]
+	if meters >= last.Meters {
+		return WindLevel{meters, last.SpeedMPS, last.Direction}, nil
+	}
+
+	i := slices.IndexFunc(levels, func(level WindLevel) bool {
+		return level.Meters > meters
+	})
+	below, above := levels[i-1], levels[i]
+
+	f := (meters - below.Meters) / (above.Meters - below.Meters)
+	speed, direction := interpolateWind(
+		below.SpeedMPS, below.Direction,
+		above.SpeedMPS, above.Direction,
+		f,
+	)
+
+	return WindLevel{meters, speed, direction}, nil
+}
+
+// InterpolateWindsAloft interpolates between winds aloft a and b, where f is
+// the fraction of the way from a to b
+func InterpolateWindsAloft(a, b WindsAloft, f float64) WindsAloft {
+	speed2000, dir2000 := interpolateWind(
+		a.WindSpeed2000, float64(a.WindDirection2000),
+		b.WindSpeed2000, float64(b.WindDirection2000),
+		f,
+	)
+
+	speed8000, dir8000 := interpolateWind(
+		a.WindSpeed8000, float64(a.WindDirection8000),
+		b.WindSpeed8000, float64(b.WindDirection8000),
+		f,
+	)
+
+	return WindsAloft{
+		WindSpeed2000:     speed2000,
+		WindSpeed8000:     speed8000,
+		WindDirection2000: int(math.Round(dir2000)) % 360,
+		WindDirection8000: int(math.Round(dir8000)) % 360,
+	}
+}
+
+// interpolateWind interpolates speed linearly and direction along the shorter
+// way around, where f is the fraction of the way from the first wind to the
+// second
+func interpolateWind(speedA, dirA, speedB, dirB, f float64) (speed, direction float64) {
+	// difference in direction between -180 and 180
+	turn := math.Mod(dirB-dirA+540, 360) - 180
+
+	return speedA + f*(speedB-speedA), math.Mod(dirA+f*turn+360, 360)
+}
+
+// windsAloftFromProfile interpolates a wind profile to the heights used by DCS
+func windsAloftFromProfile(levels []WindLevel) (WindsAloft, error) {
+	low, err := InterpolateWind(levels, WindsAloftLowMeters)
+	if err != nil {
+		return WindsAloft{}, err
+	}
+
+	high, err := InterpolateWind(levels, WindsAloftHighMeters)
+	if err != nil {
+		return WindsAloft{}, err
+	}
+
+	return WindsAloft{
+		WindSpeed2000:     low.SpeedMPS,
+		WindSpeed8000:     high.SpeedMPS,
+		WindDirection2000: int(math.Round(low.Direction)) % 360,
+		WindDirection8000: int(math.Round(high.Direction)) % 360,
+	}, nil
+}
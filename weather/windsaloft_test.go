@@ -0,0 +1,107 @@
+package weather
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// TestInterpolateWind checks speed and direction are interpolated by height
+func TestInterpolateWind(t *testing.T) {
+	levels := []WindLevel{
+		{Meters: 9200, SpeedMPS: 40, Direction: 270},
+		{Meters: 1950, SpeedMPS: 10, Direction: 350},
+		{Meters: 3050, SpeedMPS: 20, Direction: 30},
+	}
+
+	tests := []struct {
+		meters    float64
+		speed     float64
+		direction float64
+	}{
+		{0, 10, 350},     // below profile uses lowest level
+		{1950, 10, 350},  // exactly on a level
+		{2500, 15, 10},   // direction turns through north
+		{20000, 40, 270}, // above profile uses highest level
+		{6125, 30, 330},  // turning the shorter way from 30 to 270
+		{3050, 20, 30},   // exactly on a level
+	}
+
+	for _, test := range tests {
+		wind, err := InterpolateWind(levels, test.meters)
+		if err != nil {
+			t.Fatalf("error interpolating: %v", err)
+		}
+
+		if math.Abs(wind.SpeedMPS-test.speed) > 1e-9 ||
+			math.Abs(wind.Direction-test.direction) > 1e-9 {
+			t.Errorf(
+				"at %.1f m got %.2f mps from %.2f, expected %.2f mps from %.2f",
+				test.meters, wind.SpeedMPS, wind.Direction, test.speed, test.direction,
+			)
+		}
+	}
+
+	if _, err := InterpolateWind(nil, 2000); err == nil {
+		t.Errorf("expected error for empty profile")
+	}
+}
+
+// TestOpenMeteoProfile checks pressure levels are read at their geopotential
+// height instead of a fixed height
+func TestOpenMeteoProfile(t *testing.T) {
+	body := `{
+		"hourly": {
+			"time": ["2024-03-01T00:00", "2024-03-01T01:00"],
+			"wind_speed_850hPa": [1, 8],
+			"wind_direction_850hPa": [0, 90],
+			"geopotential_height_850hPa": [1500, 1500],
+			"wind_speed_800hPa": [1, 12],
+			"wind_direction_800hPa": [0, 110],
+			"geopotential_height_800hPa": [2100, 2100],
+			"wind_speed_400hPa": [1, 30],
+			"wind_direction_400hPa": [0, 250],
+			"geopotential_height_400hPa": [7600, 7600],
+			"wind_speed_300hPa": [1, 40],
+			"wind_direction_300hPa": [0, 270],
+			"geopotential_height_300hPa": [null, 9600]
+		}
+	}`
+
+	var res OpenMeteoData
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+
+	levels, err := openMeteoProfile(res, 1)
+	if err != nil {
+		t.Fatalf("error reading profile: %v", err)
+	}
+	if len(levels) != 4 {
+		t.Fatalf("got %d levels, expected 4", len(levels))
+	}
+
+	data, err := windsAloftFromProfile(levels)
+	if err != nil {
+		t.Fatalf("error interpolating profile: %v", err)
+	}
+
+	// 2000 m is 5/6 of the way from 1500 m to 2100 m
+	if math.Abs(data.WindSpeed2000-(8+4*5.0/6)) > 1e-9 || data.WindDirection2000 != 107 {
+		t.Errorf("got %.2f mps from %d at 2000 m", data.WindSpeed2000, data.WindDirection2000)
+	}
+
+	// 8000 m is 1/5 of the way from 7600 m to 9600 m
+	if math.Abs(data.WindSpeed8000-32) > 1e-9 || data.WindDirection8000 != 254 {
+		t.Errorf("got %.2f mps from %d at 8000 m", data.WindSpeed8000, data.WindDirection8000)
+	}
+
+	// the missing height skips the 300 hPa level
+	levels, err = openMeteoProfile(res, 0)
+	if err != nil {
+		t.Fatalf("error reading profile: %v", err)
+	}
+	if len(levels) != 3 {
+		t.Errorf("got %d levels, expected 3", len(levels))
+	}
+}